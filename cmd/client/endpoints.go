@@ -0,0 +1,344 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// endpointsScheme is the scheme of gRPC targets naming a Kubernetes service, e.g. k8s-endpoints:///net
+const endpointsScheme = "k8s-endpoints"
+
+// roundRobinServiceConfig makes gRPC balance calls across all addresses the resolver reports
+const roundRobinServiceConfig = `{"loadBalancingConfig":[{"round_robin":{}}]}`
+
+// dialKubernetesService connects to all ready endpoints of a Kubernetes service and balances calls
+// across them. Endpoints are reached through port forwarding to their pods.
+func dialKubernetesService(kubecfg *rest.Config, clientSet kubernetes.Interface, namespace, service string) (closableGrpcClientConnInterface, error) {
+	endpoints := &endpointsResolverBuilder{
+		ClientSet: clientSet,
+		Namespace: namespace,
+		Port:      rootCmdOpts.K8sPodPort,
+	}
+	dialer := &endpointsDialer{
+		Config:    kubecfg,
+		ClientSet: clientSet,
+		Namespace: namespace,
+		Endpoints: endpoints,
+	}
+	endpoints.PodsGone = dialer.StopPods
+
+	res, err := grpc.Dial(endpointsScheme+":///"+service,
+		grpc.WithInsecure(),
+		grpc.WithResolvers(endpoints),
+		grpc.WithContextDialer(dialer.Dial),
+		grpc.WithDefaultServiceConfig(roundRobinServiceConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial service %s: %w", service, err)
+	}
+
+	return closableConn{
+		ClientConnInterface: res,
+		Closer: func() error {
+			err := res.Close()
+			dialer.Close()
+			return err
+		},
+	}, nil
+}
+
+// endpointsResolverBuilder resolves the ready endpoints of a Kubernetes service using its EndpointSlices.
+// The resolvers it builds watch the EndpointSlices and keep gRPC updated as endpoints come and go.
+type endpointsResolverBuilder struct {
+	ClientSet kubernetes.Interface
+	Namespace string
+	// Port is the name or number of the endpoint port to connect to. If a service has a single port,
+	// that port is used regardless.
+	Port string
+	// PodsGone is called with the pods which no longer back any ready endpoint, if set
+	PodsGone func(pods []string)
+
+	mu   sync.RWMutex
+	pods map[string]string
+}
+
+var _ resolver.Builder = &endpointsResolverBuilder{}
+
+// Scheme returns the scheme of the targets this builder resolves
+func (b *endpointsResolverBuilder) Scheme() string {
+	return endpointsScheme
+}
+
+// Build starts watching the EndpointSlices of the service named by the target
+func (b *endpointsResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	service := target.URL.Path
+	if len(service) > 0 && service[0] == '/' {
+		service = service[1:]
+	}
+	if service == "" {
+		return nil, fmt.Errorf("target %s does not name a service", target.URL.String())
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(b.ClientSet, 0,
+		informers.WithNamespace(b.Namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = discoveryv1.LabelServiceName + "=" + service
+		}),
+	)
+	res := &endpointsResolver{
+		builder:  b,
+		cc:       cc,
+		service:  service,
+		informer: factory.Discovery().V1().EndpointSlices().Informer(),
+		stop:     make(chan struct{}),
+	}
+	res.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { res.update() },
+		UpdateFunc: func(interface{}, interface{}) { res.update() },
+		DeleteFunc: func(interface{}) { res.update() },
+	})
+	go res.informer.Run(res.stop)
+	go func() {
+		// without any EndpointSlices there are no events, but gRPC should learn that there are no endpoints
+		if cache.WaitForCacheSync(res.stop, res.informer.HasSynced) {
+			res.update()
+		}
+	}()
+
+	return res, nil
+}
+
+// podFor returns the pod backing an endpoint address
+func (b *endpointsResolverBuilder) podFor(addr string) (pod string, ok bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	pod, ok = b.pods[addr]
+	return
+}
+
+// setPods replaces the pods backing the endpoint addresses and returns the pods which no longer back any
+func (b *endpointsResolverBuilder) setPods(pods map[string]string) (gone []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	seen := make(map[string]struct{}, len(pods))
+	for _, pod := range pods {
+		seen[pod] = struct{}{}
+	}
+	for _, pod := range b.pods {
+		if _, ok := seen[pod]; ok {
+			continue
+		}
+		seen[pod] = struct{}{}
+		gone = append(gone, pod)
+	}
+	b.pods = pods
+	return gone
+}
+
+type endpointsResolver struct {
+	builder  *endpointsResolverBuilder
+	cc       resolver.ClientConn
+	service  string
+	informer cache.SharedIndexInformer
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// ResolveNow does nothing because the informer keeps the addresses up to date
+func (r *endpointsResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+// Close stops watching the EndpointSlices
+func (r *endpointsResolver) Close() {
+	r.once.Do(func() { close(r.stop) })
+}
+
+func (r *endpointsResolver) update() {
+	var slices []*discoveryv1.EndpointSlice
+	for _, obj := range r.informer.GetStore().List() {
+		if slice, ok := obj.(*discoveryv1.EndpointSlice); ok {
+			slices = append(slices, slice)
+		}
+	}
+
+	addrs, pods := readyEndpoints(slices, r.builder.Port)
+	if gone := r.builder.setPods(pods); len(gone) > 0 && r.builder.PodsGone != nil {
+		r.builder.PodsGone(gone)
+	}
+	log.WithField("service", r.service).WithField("endpoints", len(addrs)).Debug("endpoints changed")
+	if len(addrs) == 0 {
+		r.cc.ReportError(fmt.Errorf("service %s has no ready endpoints", r.service))
+		return
+	}
+	err := r.cc.UpdateState(resolver.State{Addresses: addrs})
+	if err != nil {
+		log.WithError(err).WithField("service", r.service).Debug("cannot update endpoints")
+	}
+}
+
+// readyEndpoints returns the addresses of all ready endpoints which are backed by a pod, sorted by address,
+// and the pods backing them.
+func readyEndpoints(slices []*discoveryv1.EndpointSlice, port string) (addrs []resolver.Address, pods map[string]string) {
+	pods = make(map[string]string)
+	for _, slice := range slices {
+		p, ok := endpointPort(slice.Ports, port)
+		if !ok {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+				continue
+			}
+			for _, ip := range ep.Addresses {
+				addr := net.JoinHostPort(ip, strconv.Itoa(int(p)))
+				if _, exists := pods[addr]; exists {
+					continue
+				}
+				pods[addr] = ep.TargetRef.Name
+				addrs = append(addrs, resolver.Address{Addr: addr})
+			}
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Addr < addrs[j].Addr })
+	return addrs, pods
+}
+
+// endpointPort finds the port named port, or numbered port, among the ports of an EndpointSlice
+func endpointPort(ports []discoveryv1.EndpointPort, port string) (int32, bool) {
+	if len(ports) == 1 && ports[0].Port != nil {
+		return *ports[0].Port, true
+	}
+	for _, p := range ports {
+		if p.Port == nil {
+			continue
+		}
+		if p.Name != nil && *p.Name == port || strconv.Itoa(int(*p.Port)) == port {
+			return *p.Port, true
+		}
+	}
+	return 0, false
+}
+
+// endpointsDialer connects to service endpoints by forwarding a port to the pod backing each endpoint.
+// Broken forwardings are re-established when gRPC reconnects.
+type endpointsDialer struct {
+	Config    *rest.Config
+	ClientSet kubernetes.Interface
+	Namespace string
+	Endpoints *endpointsResolverBuilder
+
+	mu          sync.Mutex
+	forwardings map[string]*forwarding
+}
+
+// Dial connects to an endpoint address reported by the resolver. It's meant for grpc.WithContextDialer.
+func (d *endpointsDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	pod, ok := d.Endpoints.podFor(addr)
+	if !ok {
+		return nil, fmt.Errorf("unknown endpoint %s", addr)
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := d.forward(ctx, pod, port)
+	if err != nil {
+		return nil, err
+	}
+	var nd net.Dialer
+	return nd.DialContext(ctx, "tcp", local)
+}
+
+// forward returns the local address of a working port forwarding to a pod
+func (d *endpointsDialer) forward(ctx context.Context, pod, port string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := pod + ":" + port
+	if fw, ok := d.forwardings[key]; ok {
+		select {
+		case <-fw.done:
+			log.WithError(fw.err).WithField("pod", pod).Debug("port forwarding ended - reconnecting")
+			delete(d.forwardings, key)
+		default:
+			return fw.Addr, nil
+		}
+	}
+
+	fw, err := forwardPort(ctx, d.Config, d.ClientSet.CoreV1().RESTClient(), d.Namespace, pod, port)
+	if err != nil {
+		return "", fmt.Errorf("cannot forward port to pod %s: %w", pod, err)
+	}
+	if d.forwardings == nil {
+		d.forwardings = make(map[string]*forwarding)
+	}
+	d.forwardings[key] = fw
+	return fw.Addr, nil
+}
+
+// StopPods stops the port forwardings to the given pods
+func (d *endpointsDialer) StopPods(pods []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, pod := range pods {
+		for key, fw := range d.forwardings {
+			if fw.Pod != pod {
+				continue
+			}
+			log.WithField("pod", pod).Debug("pod left the service - stopping port forwarding")
+			close(fw.stop)
+			delete(d.forwardings, key)
+		}
+	}
+}
+
+// Close stops all port forwardings
+func (d *endpointsDialer) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, fw := range d.forwardings {
+		close(fw.stop)
+		delete(d.forwardings, key)
+	}
+}
@@ -0,0 +1,181 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEndpointsResolver(t *testing.T) {
+	boolPtr := func(b bool) *bool { return &b }
+	int32Ptr := func(i int32) *int32 { return &i }
+	stringPtr := func(s string) *string { return &s }
+	endpoint := func(ip, pod string, ready bool) discoveryv1.Endpoint {
+		return discoveryv1.Endpoint{
+			Addresses:  []string{ip},
+			Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(ready)},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: pod},
+		}
+	}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "net-abcde",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "net"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			endpoint("10.0.0.2", "net-b", true),
+			endpoint("10.0.0.1", "net-a", true),
+			endpoint("10.0.0.3", "net-c", false),
+		},
+		Ports: []discoveryv1.EndpointPort{
+			{Name: stringPtr("metrics"), Port: int32Ptr(9500)},
+			{Name: stringPtr("grpc"), Port: int32Ptr(7777)},
+		},
+	}
+	otherService := slice.DeepCopy()
+	otherService.Name = "other-abcde"
+	otherService.Labels[discoveryv1.LabelServiceName] = "other"
+
+	clientSet := fake.NewSimpleClientset(slice, otherService)
+	gone := make(chan []string, 10)
+	builder := &endpointsResolverBuilder{
+		ClientSet: clientSet,
+		Namespace: "default",
+		Port:      "7777",
+		PodsGone:  func(pods []string) { gone <- pods },
+	}
+	cc := &testClientConn{updates: make(chan []string, 100)}
+	target, err := url.Parse(endpointsScheme + ":///net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := builder.Build(resolver.Target{URL: *target}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	expectAddrs(t, cc, "10.0.0.1:7777", "10.0.0.2:7777")
+	if pod, _ := builder.podFor("10.0.0.2:7777"); pod != "net-b" {
+		t.Errorf("expected 10.0.0.2:7777 to be backed by net-b, got %q", pod)
+	}
+
+	// net-a stops being ready while net-c becomes ready
+	slice = slice.DeepCopy()
+	slice.Endpoints[1].Conditions.Ready = boolPtr(false)
+	slice.Endpoints[2].Conditions.Ready = boolPtr(true)
+	_, err = clientSet.DiscoveryV1().EndpointSlices("default").Update(context.Background(), slice, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAddrs(t, cc, "10.0.0.2:7777", "10.0.0.3:7777")
+	if pod, ok := builder.podFor("10.0.0.1:7777"); ok {
+		t.Errorf("expected 10.0.0.1:7777 to be forgotten, still backed by %q", pod)
+	}
+	if pods := <-gone; len(pods) != 1 || pods[0] != "net-a" {
+		t.Errorf("expected net-a to be gone, got %v", pods)
+	}
+
+	err = clientSet.DiscoveryV1().EndpointSlices("default").Delete(context.Background(), slice.Name, metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAddrs(t, cc)
+}
+
+func TestEndpointsDialerStopPods(t *testing.T) {
+	forwardingTo := func(pod string) *forwarding {
+		return &forwarding{Pod: pod, stop: make(chan struct{}), done: make(chan struct{})}
+	}
+	a, b := forwardingTo("net-a"), forwardingTo("net-b")
+	d := &endpointsDialer{forwardings: map[string]*forwarding{"net-a:7777": a, "net-b:7777": b}}
+
+	d.StopPods([]string{"net-a"})
+	select {
+	case <-a.stop:
+	default:
+		t.Error("forwarding to net-a was not stopped")
+	}
+	select {
+	case <-b.stop:
+		t.Error("forwarding to net-b was stopped")
+	default:
+	}
+	if _, ok := d.forwardings["net-a:7777"]; ok || len(d.forwardings) != 1 {
+		t.Errorf("unexpected forwardings %v", d.forwardings)
+	}
+}
+
+// expectAddrs waits for the resolver to report the expected addresses
+func expectAddrs(t *testing.T, cc *testClientConn, expected ...string) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	var last []string
+	for {
+		select {
+		case last = <-cc.updates:
+		case <-timeout:
+			t.Fatalf("expected addresses %v, last update was %v", expected, last)
+		}
+		if len(last) != len(expected) {
+			continue
+		}
+		match := true
+		for i := range last {
+			match = match && last[i] == expected[i]
+		}
+		if match {
+			return
+		}
+	}
+}
+
+// testClientConn records the addresses reported by a resolver. Errors count as an update without addresses.
+type testClientConn struct {
+	resolver.ClientConn
+
+	updates chan []string
+}
+
+func (c *testClientConn) UpdateState(state resolver.State) error {
+	var addrs []string
+	for _, a := range state.Addresses {
+		addrs = append(addrs, a.Addr)
+	}
+	c.updates <- addrs
+	return nil
+}
+
+func (c *testClientConn) ReportError(err error) {
+	c.updates <- nil
+}
@@ -0,0 +1,189 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/logs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// engineCmd represents the engine command
+var engineCmd = &cobra.Command{
+	Use:   "engine",
+	Short: "Starts and follows Bhojpur Network engines",
+	Args:  cobra.NoArgs,
+}
+
+var engineCmdOpts struct {
+	Output string
+}
+
+func init() {
+	rootCmd.AddCommand(engineCmd)
+
+	engineCmd.PersistentFlags().StringVarP(&engineCmdOpts.Output, "output", "o", outputTable, "output format: table, json or yaml")
+}
+
+// parseAnnotations parses annotations given as key=value
+func parseAnnotations(annotations []string) ([]*v1.Annotation, error) {
+	var res []*v1.Annotation
+	for _, a := range annotations {
+		segs := strings.SplitN(a, "=", 2)
+		if len(segs) != 2 {
+			return nil, fmt.Errorf("annotation %q must have the form key=value", a)
+		}
+		res = append(res, &v1.Annotation{Key: segs[0], Value: segs[1]})
+	}
+	return res, nil
+}
+
+// parseWaitUntil parses either a duration from now, e.g. 2h, or an RFC 3339 timestamp.
+// An empty value yields nil.
+func parseWaitUntil(val string) (*timestamppb.Timestamp, error) {
+	if val == "" {
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(val); err == nil {
+		return timestamppb.New(time.Now().Add(d)), nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a duration nor an RFC 3339 time", val)
+	}
+	return timestamppb.New(t), nil
+}
+
+// maxListenRetries is how often followEngine listens again after losing the connection
+// without having received anything in between
+const maxListenRetries = 5
+
+// followEngine renders the log output and status of an engine until it's done. It fails with
+// an exitError if the engine did not succeed.
+//
+// If the connection breaks, e.g. because the server's pod went away, followEngine listens
+// again. The server replays all logs then, so slices which were rendered already are skipped.
+func followEngine(ctx context.Context, client v1.NetServiceClient, name string, out *os.File) error {
+	r := &logs.TerminalRenderer{Out: out}
+	if fd := int(out.Fd()); term.IsTerminal(fd) {
+		r.Interactive = true
+		r.Width, _, _ = term.GetSize(fd)
+	}
+
+	var (
+		rendered  int
+		retries   int
+		connected bool
+	)
+	for {
+		received, err := listenEngine(ctx, client, name, r, &rendered)
+		if err == nil {
+			break
+		}
+		if received {
+			connected = true
+			retries = 0
+		}
+		// we don't retry if we've never been able to listen at all
+		if status.Code(err) != codes.Unavailable || !connected || retries >= maxListenRetries {
+			r.Close()
+			return err
+		}
+		retries++
+		log.WithError(err).WithField("attempt", retries).Debug("lost connection while following engine - listening again")
+
+		select {
+		case <-time.After(time.Duration(retries) * time.Second):
+		case <-ctx.Done():
+			r.Close()
+			return ctx.Err()
+		}
+	}
+
+	return engineOutcome(r.Close())
+}
+
+// listenEngine renders the events of a single Listen call, skipping the first rendered slices and
+// counting those it renders. The stream ends once the engine is done; for engines which are done
+// already the final status comes first, followed by the logs. If the stream ends before the
+// engine is done, listenEngine fails with codes.Unavailable.
+func listenEngine(ctx context.Context, client v1.NetServiceClient, name string, r *logs.TerminalRenderer, rendered *int) (received bool, err error) {
+	stream, err := client.Listen(ctx, &v1.ListenRequest{
+		Name:    name,
+		Updates: true,
+		Logs:    v1.ListenRequestLogs_LOGS_RAW,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var (
+		slices int
+		done   bool
+	)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return received, err
+		}
+		received = true
+
+		switch c := resp.Content.(type) {
+		case *v1.ListenResponse_Slice:
+			slices++
+			if slices <= *rendered {
+				continue
+			}
+			r.Slice(c.Slice)
+			*rendered++
+		case *v1.ListenResponse_Update:
+			r.Update(c.Update)
+			done = done || c.Update.Phase == v1.EnginePhase_PHASE_DONE
+		}
+	}
+	if !done {
+		return received, status.Errorf(codes.Unavailable, "server stopped sending updates before engine %s was done", name)
+	}
+	return received, nil
+}
+
+// engineOutcome returns an exitError if the engine failed
+func engineOutcome(st *v1.EngineStatus) error {
+	if st.Conditions.GetSuccess() {
+		return nil
+	}
+	return &exitError{Code: exitCodeEngineFailed}
+}
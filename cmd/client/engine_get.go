@@ -0,0 +1,69 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/spf13/cobra"
+)
+
+// engineGetCmd represents the engine get command
+var engineGetCmd = &cobra.Command{
+	Use:   "get <name>",
+	Short: "Prints the status of an engine",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conn := dial()
+		defer conn.Close()
+		client := v1.NewNetServiceClient(conn)
+
+		resp, err := client.GetEngine(context.Background(), &v1.GetEngineRequest{Name: args[0]})
+		if err != nil {
+			return err
+		}
+		st := resp.Result
+		return printOutput(os.Stdout, engineCmdOpts.Output, st, func(w io.Writer) error {
+			err := printEngineTable(w, []*v1.EngineStatus{st})
+			if err != nil {
+				return err
+			}
+			if st.Details != "" {
+				fmt.Fprintf(w, "\nDetails:\t%s\n", st.Details)
+			}
+			if len(st.GetMetadata().GetAnnotations()) > 0 {
+				fmt.Fprintln(w, "\nAnnotations:")
+				for _, a := range st.Metadata.Annotations {
+					fmt.Fprintf(w, "  %s\t%s\n", a.Key, a.Value)
+				}
+			}
+			return nil
+		})
+	},
+}
+
+func init() {
+	engineCmd.AddCommand(engineGetCmd)
+}
@@ -0,0 +1,106 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/filterexpr"
+	"github.com/spf13/cobra"
+)
+
+var engineListCmdOpts struct {
+	Filter []string
+	Order  []string
+	Start  int32
+	Limit  int32
+}
+
+// engineListCmd represents the engine list command
+var engineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists engines",
+	Long: `Lists engines, newest first unless --order is given.
+
+Each --filter is an expression of terms separated by |, any of which must match.
+All filters must match for an engine to be listed. Terms have the form
+
+  field==value  field!=value  field~=value (contains)
+  field^=value (starts with)  field$=value (ends with)
+  field (exists)  !field (does not exist)
+
+Orders have the form field, field:asc or field:desc.`,
+	Example: `  net engine list --filter phase==running --filter metadata.owner==me
+  net engine list --filter "annotation.env==staging|annotation.env==prod" --order name:asc`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req := &v1.ListEnginesRequest{
+			Start: engineListCmdOpts.Start,
+			Limit: engineListCmdOpts.Limit,
+		}
+		for _, f := range engineListCmdOpts.Filter {
+			expr, err := filterexpr.Parse(f)
+			if err != nil {
+				return fmt.Errorf("invalid filter %q: %w", f, err)
+			}
+			req.Filter = append(req.Filter, expr)
+		}
+		for _, o := range engineListCmdOpts.Order {
+			expr, err := filterexpr.ParseOrder(o)
+			if err != nil {
+				return fmt.Errorf("invalid order %q: %w", o, err)
+			}
+			req.Order = append(req.Order, expr)
+		}
+
+		conn := dial()
+		defer conn.Close()
+		client := v1.NewNetServiceClient(conn)
+
+		resp, err := client.ListEngines(context.Background(), req)
+		if err != nil {
+			return err
+		}
+		return printOutput(os.Stdout, engineCmdOpts.Output, resp, func(w io.Writer) error {
+			err := printEngineTable(w, resp.Result)
+			if err != nil {
+				return err
+			}
+			if shown := req.Start + int32(len(resp.Result)); shown < resp.Total {
+				fmt.Fprintf(os.Stderr, "showing %d-%d of %d engines\n", req.Start+1, shown, resp.Total)
+			}
+			return nil
+		})
+	},
+}
+
+func init() {
+	engineCmd.AddCommand(engineListCmd)
+
+	engineListCmd.Flags().StringArrayVar(&engineListCmdOpts.Filter, "filter", nil, "only lists engines matching the filter expression (can be given multiple times)")
+	engineListCmd.Flags().StringArrayVar(&engineListCmdOpts.Order, "order", nil, "orders engines by a field (can be given multiple times)")
+	engineListCmd.Flags().Int32Var(&engineListCmdOpts.Start, "start", 0, "number of engines to skip")
+	engineListCmd.Flags().Int32Var(&engineListCmdOpts.Limit, "limit", 50, "maximum number of engines to list")
+}
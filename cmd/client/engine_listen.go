@@ -0,0 +1,54 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"os"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/spf13/cobra"
+)
+
+// engineListenCmd represents the engine listen command
+var engineListenCmd = &cobra.Command{
+	Use:   "listen <name>",
+	Short: "Follows the log output of an engine until it's done",
+	Long: `Follows the log output of an engine until it's done.
+
+Log slices are grouped into sections and results are highlighted. On a terminal the current
+phase of the engine is shown in a status line and sections collapse once they're done.
+
+The command exits with status 0 if the engine succeeded and with status 2 if it failed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		conn := dial()
+		defer conn.Close()
+		client := v1.NewNetServiceClient(conn)
+
+		return followEngine(context.Background(), client, args[0], os.Stdout)
+	},
+}
+
+func init() {
+	engineCmd.AddCommand(engineListenCmd)
+}
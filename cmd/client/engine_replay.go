@@ -0,0 +1,75 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"os"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/spf13/cobra"
+)
+
+var engineReplayCmdOpts struct {
+	GitopsToken string
+	WaitUntil   string
+	Follow      bool
+}
+
+// engineReplayCmd represents the engine replay command
+var engineReplayCmd = &cobra.Command{
+	Use:   "replay <name>",
+	Short: "Starts a new engine based on a previous one",
+	Long: `Starts a new engine based on a previous one, using the same repository revision,
+spec and annotations. Engines started from a local working copy cannot be replayed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		waitUntil, err := parseWaitUntil(engineReplayCmdOpts.WaitUntil)
+		if err != nil {
+			return err
+		}
+
+		// from here on errors are not caused by wrong usage
+		cmd.SilenceUsage = true
+		conn := dial()
+		defer conn.Close()
+		client := v1.NewNetServiceClient(conn)
+
+		ctx := context.Background()
+		resp, err := client.StartFromPreviousEngine(ctx, &v1.StartFromPreviousEngineRequest{
+			PreviousEngine: args[0],
+			GitopsToken:    engineReplayCmdOpts.GitopsToken,
+			WaitUntil:      waitUntil,
+		})
+		if err != nil {
+			return err
+		}
+		return startedEngine(ctx, client, resp.Status, engineReplayCmdOpts.Follow)
+	},
+}
+
+func init() {
+	engineCmd.AddCommand(engineReplayCmd)
+
+	engineReplayCmd.Flags().StringVar(&engineReplayCmdOpts.GitopsToken, "gitops-token", os.Getenv("NET_GITOPS_TOKEN"), "token used to fetch the sources of the engine (defaults to NET_GITOPS_TOKEN env var)")
+	engineReplayCmd.Flags().StringVar(&engineReplayCmdOpts.WaitUntil, "wait-until", "", "delays the start of the engine, either by a duration like 2h or until an RFC 3339 time")
+	engineReplayCmd.Flags().BoolVarP(&engineReplayCmdOpts.Follow, "follow", "f", false, "follow the engine's log output once it started and exit with status 2 if it fails")
+}
@@ -0,0 +1,150 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/local"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var engineStartCmdOpts struct {
+	Path        string
+	File        string
+	Repo        string
+	Ref         string
+	Revision    string
+	Annotations []string
+	NameSuffix  string
+	WaitUntil   string
+	Follow      bool
+}
+
+// engineStartCmd represents the engine start command
+var engineStartCmd = &cobra.Command{
+	Use:   "start [spec-name]",
+	Short: "Starts an engine from a repository",
+	Long: `Starts an engine from a repository known to the server.
+
+The engine is either given by the name of its spec, by its path within the repository
+(--path) or by a local engine YAML file (--file). Unless --repo is given, the repository
+is that of the working copy in the current directory.`,
+	Example: `  net engine start build -a version=1.0
+  net engine start --path net/nightly.yaml --wait-until 2h`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := engineStartCmdOpts
+		req := &v1.StartEngineRequest{
+			EnginePath: opts.Path,
+			NameSuffix: opts.NameSuffix,
+			Metadata: &v1.EngineMetadata{
+				Trigger: v1.EngineTrigger_TRIGGER_MANUAL,
+			},
+		}
+		if len(args) > 0 {
+			req.Metadata.EngineSpecName = args[0]
+		}
+		if opts.File != "" {
+			fc, err := os.ReadFile(opts.File)
+			if err != nil {
+				return fmt.Errorf("cannot read engine YAML: %w", err)
+			}
+			req.EngineYaml = fc
+		}
+		if req.Metadata.EngineSpecName == "" && req.EnginePath == "" && len(req.EngineYaml) == 0 {
+			return fmt.Errorf("either a spec name, --path or --file is required")
+		}
+
+		repo := local.Repository(".")
+		if opts.Repo != "" {
+			segs := strings.Split(opts.Repo, "/")
+			if len(segs) != 3 {
+				return fmt.Errorf("repository %q must have the form host/owner/repo", opts.Repo)
+			}
+			repo = &v1.Repository{Host: segs[0], Owner: segs[1], Repo: segs[2]}
+		}
+		if opts.Ref != "" {
+			repo.Ref = opts.Ref
+		}
+		if opts.Revision != "" {
+			repo.Revision = opts.Revision
+		}
+		req.Metadata.Repository = repo
+		if u, err := user.Current(); err == nil {
+			req.Metadata.Owner = u.Username
+		}
+
+		var err error
+		req.Metadata.Annotations, err = parseAnnotations(opts.Annotations)
+		if err != nil {
+			return err
+		}
+		req.WaitUntil, err = parseWaitUntil(opts.WaitUntil)
+		if err != nil {
+			return err
+		}
+
+		// from here on errors are not caused by wrong usage
+		cmd.SilenceUsage = true
+		conn := dial()
+		defer conn.Close()
+		client := v1.NewNetServiceClient(conn)
+
+		ctx := context.Background()
+		resp, err := client.StartEngine(ctx, req)
+		if err != nil {
+			return err
+		}
+		return startedEngine(ctx, client, resp.Status, opts.Follow)
+	},
+}
+
+// startedEngine reports a newly started engine and follows it if requested
+func startedEngine(ctx context.Context, client v1.NetServiceClient, st *v1.EngineStatus, follow bool) error {
+	log.WithField("name", st.Name).WithField("phase", phaseName(st.Phase)).Info("engine started")
+	fmt.Println(st.Name)
+
+	if !follow {
+		return nil
+	}
+	return followEngine(ctx, client, st.Name, os.Stdout)
+}
+
+func init() {
+	engineCmd.AddCommand(engineStartCmd)
+
+	engineStartCmd.Flags().StringVar(&engineStartCmdOpts.Path, "path", "", "path of the engine YAML within the repository")
+	engineStartCmd.Flags().StringVar(&engineStartCmdOpts.File, "file", "", "local engine YAML file to run")
+	engineStartCmd.Flags().StringVar(&engineStartCmdOpts.Repo, "repo", "", "repository to start the engine from as host/owner/repo (defaults to the working copy's origin)")
+	engineStartCmd.Flags().StringVar(&engineStartCmdOpts.Ref, "ref", "", "ref to start the engine from, e.g. refs/heads/main (defaults to the working copy's branch)")
+	engineStartCmd.Flags().StringVar(&engineStartCmdOpts.Revision, "revision", "", "revision to start the engine from (defaults to the working copy's HEAD)")
+	engineStartCmd.Flags().StringArrayVarP(&engineStartCmdOpts.Annotations, "annotation", "a", nil, "adds an annotation to the engine (key=value)")
+	engineStartCmd.Flags().StringVar(&engineStartCmdOpts.NameSuffix, "name-suffix", "", "suffix added to the engine's name")
+	engineStartCmd.Flags().StringVar(&engineStartCmdOpts.WaitUntil, "wait-until", "", "delays the start of the engine, either by a duration like 2h or until an RFC 3339 time")
+	engineStartCmd.Flags().BoolVarP(&engineStartCmdOpts.Follow, "follow", "f", false, "follow the engine's log output once it started and exit with status 2 if it fails")
+}
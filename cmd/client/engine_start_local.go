@@ -0,0 +1,141 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/local"
+	"github.com/bhojpur/net/pkg/spec"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var engineStartLocalCmdOpts struct {
+	Dir         string
+	Engine      string
+	Annotations []string
+	Follow      bool
+}
+
+// engineStartLocalCmd represents the engine start-local command
+var engineStartLocalCmd = &cobra.Command{
+	Use:   "start-local",
+	Short: "Starts an engine from the local working copy",
+	Long: `Starts an engine from the local working copy.
+
+The engine YAML is resolved using net/config.yaml: unless --engine is given, its
+defaultEngine is run. The application directory is uploaded as well, leaving out
+everything listed in its .netignore file.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := filepath.Abs(engineStartLocalCmdOpts.Dir)
+		if err != nil {
+			return err
+		}
+		cfg, configYAML, err := spec.LoadConfig(dir)
+		if err != nil {
+			return err
+		}
+		enginePath, err := cfg.EnginePath(engineStartLocalCmdOpts.Engine)
+		if err != nil {
+			return err
+		}
+		engineYAML, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(enginePath)))
+		if err != nil {
+			return fmt.Errorf("cannot read engine YAML: %w", err)
+		}
+		ignore, err := local.LoadIgnore(dir)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", local.IgnoreFile, err)
+		}
+
+		md := &v1.EngineMetadata{
+			Repository:     local.Repository(dir),
+			Trigger:        v1.EngineTrigger_TRIGGER_MANUAL,
+			EngineSpecName: spec.EngineName(enginePath),
+		}
+		if u, err := user.Current(); err == nil {
+			md.Owner = u.Username
+		}
+		md.Annotations, err = parseAnnotations(engineStartLocalCmdOpts.Annotations)
+		if err != nil {
+			return err
+		}
+
+		// from here on errors are not caused by wrong usage
+		cmd.SilenceUsage = true
+		conn := dial()
+		defer conn.Close()
+		client := v1.NewNetServiceClient(conn)
+
+		var progress func(int64)
+		if term.IsTerminal(int(os.Stderr.Fd())) {
+			progress = func(sent int64) {
+				fmt.Fprintf(os.Stderr, "\r\033[Kuploading application: %s", formatBytes(sent))
+			}
+		}
+		ctx := context.Background()
+		st, err := local.Start(ctx, client, local.Engine{
+			Metadata:   md,
+			ConfigYAML: configYAML,
+			EngineYAML: engineYAML,
+			Dir:        dir,
+			Ignore:     ignore,
+			Progress:   progress,
+		})
+		if progress != nil {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			return err
+		}
+		return startedEngine(ctx, client, st, engineStartLocalCmdOpts.Follow)
+	},
+}
+
+// formatBytes renders a number of bytes in human-readable form
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	engineCmd.AddCommand(engineStartLocalCmd)
+
+	engineStartLocalCmd.Flags().StringVar(&engineStartLocalCmdOpts.Dir, "dir", ".", "application directory containing net/config.yaml")
+	engineStartLocalCmd.Flags().StringVarP(&engineStartLocalCmdOpts.Engine, "engine", "e", "", "engine to run, either a name like \"build\" for net/build.yaml or a path relative to the application directory (defaults to the defaultEngine of net/config.yaml)")
+	engineStartLocalCmd.Flags().StringArrayVarP(&engineStartLocalCmdOpts.Annotations, "annotation", "a", nil, "adds an annotation to the engine (key=value)")
+	engineStartLocalCmd.Flags().BoolVarP(&engineStartLocalCmdOpts.Follow, "follow", "f", false, "follow the engine's log output once it started and exit with status 2 if it fails")
+}
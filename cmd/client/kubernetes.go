@@ -0,0 +1,315 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// podStrategy determines which pod we connect to if there are several ready ones
+type podStrategy string
+
+const (
+	// podStrategyFirst picks the first pod ordered by name
+	podStrategyFirst podStrategy = "first"
+	// podStrategyRandom picks a random pod, which spreads clients across all pods
+	podStrategyRandom podStrategy = "random"
+	// podStrategyNewest picks the most recently created pod, i.e. the one most likely to survive a rollout
+	podStrategyNewest podStrategy = "newest"
+)
+
+func dialKubernetes() (closableGrpcClientConnInterface, error) {
+	kubecfg, namespace, err := getKubeconfig(rootCmdOpts.Kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load kubeconfig %s: %w", rootCmdOpts.Kubeconfig, err)
+	}
+	if rootCmdOpts.K8sNamespace != "" {
+		namespace = rootCmdOpts.K8sNamespace
+	}
+	clientSet, err := kubernetes.NewForConfig(kubecfg)
+	if err != nil {
+		return nil, err
+	}
+	if rootCmdOpts.K8sService != "" {
+		return dialKubernetesService(kubecfg, clientSet, namespace, rootCmdOpts.K8sService)
+	}
+
+	strategy := podStrategy(rootCmdOpts.K8sPodStrategy)
+	switch strategy {
+	case podStrategyFirst, podStrategyRandom, podStrategyNewest:
+	default:
+		return nil, fmt.Errorf("unknown pod strategy %q: must be one of %s, %s or %s", strategy, podStrategyFirst, podStrategyRandom, podStrategyNewest)
+	}
+
+	fwd := &podForwarder{
+		Config:    kubecfg,
+		ClientSet: clientSet,
+		Namespace: namespace,
+		Selector:  rootCmdOpts.K8sLabelSelector,
+		PodPort:   rootCmdOpts.K8sPodPort,
+		Strategy:  strategy,
+	}
+	// establish the first forwarding right away so that we fail early if there's no pod
+	_, err = fwd.ensure(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := grpc.Dial("localhost", grpc.WithInsecure(), grpc.WithContextDialer(fwd.Dial))
+	if err != nil {
+		fwd.Close()
+		return nil, fmt.Errorf("cannot dial forwarded connection: %w", err)
+	}
+
+	return closableConn{
+		ClientConnInterface: res,
+		Closer: func() error {
+			err := res.Close()
+			fwd.Close()
+			return err
+		},
+	}, nil
+}
+
+type closableConn struct {
+	grpc.ClientConnInterface
+	Closer func() error
+}
+
+func (c closableConn) Close() error {
+	return c.Closer()
+}
+
+// isPodReady returns true if a pod is running, ready and not about to terminate
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// selectPod picks one of the ready pods according to the strategy
+func selectPod(pods []corev1.Pod, strategy podStrategy) (*corev1.Pod, error) {
+	var ready []*corev1.Pod
+	for i := range pods {
+		if isPodReady(&pods[i]) {
+			ready = append(ready, &pods[i])
+		}
+	}
+	if len(ready) == 0 {
+		return nil, fmt.Errorf("none of the %d pods is ready", len(pods))
+	}
+
+	switch strategy {
+	case podStrategyRandom:
+		return ready[rand.Intn(len(ready))], nil
+	case podStrategyNewest:
+		sort.SliceStable(ready, func(i, j int) bool {
+			ci, cj := ready[i].CreationTimestamp, ready[j].CreationTimestamp
+			if ci.Equal(&cj) {
+				return ready[i].Name < ready[j].Name
+			}
+			return cj.Before(&ci)
+		})
+	default:
+		sort.Slice(ready, func(i, j int) bool { return ready[i].Name < ready[j].Name })
+	}
+	return ready[0], nil
+}
+
+// findNetPod returns a ready Bhojpur Network pod chosen according to the strategy
+func findNetPod(ctx context.Context, clientSet kubernetes.Interface, namespace, selector string, strategy podStrategy) (podName string, err error) {
+	pods, err := clientSet.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("no pod in %s with label %s", namespace, selector)
+	}
+	pod, err := selectPod(pods.Items, strategy)
+	if err != nil {
+		return "", fmt.Errorf("no pod in %s with label %s is ready: %w", namespace, selector, err)
+	}
+	return pod.Name, nil
+}
+
+// podForwarder forwards a local port to a Bhojpur Network pod and dials connections through it.
+// If the forwarding breaks or the pod stops being ready, e.g. during a rollout, the next dial
+// re-establishes the forwarding against another pod. gRPC dials whenever it reconnects, so
+// clients survive pods going away.
+type podForwarder struct {
+	Config    *rest.Config
+	ClientSet kubernetes.Interface
+	Namespace string
+	Selector  string
+	PodPort   string
+	Strategy  podStrategy
+
+	mu      sync.Mutex
+	current *forwarding
+}
+
+// forwarding is a single port forwarding to a pod
+type forwarding struct {
+	Pod  string
+	Addr string
+
+	stop chan struct{}
+	done chan struct{}
+	err  error
+}
+
+// Dial connects to the Bhojpur Network server through the port forwarding. It's meant for grpc.WithContextDialer.
+func (f *podForwarder) Dial(ctx context.Context, _ string) (net.Conn, error) {
+	addr, err := f.ensure(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// Close stops the port forwarding
+func (f *podForwarder) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.current != nil {
+		close(f.current.stop)
+		f.current = nil
+	}
+}
+
+// ensure returns the local address of a working port forwarding, establishing one if needed
+func (f *podForwarder) ensure(ctx context.Context) (addr string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if cur := f.current; cur != nil {
+		select {
+		case <-cur.done:
+			log.WithError(cur.err).WithField("pod", cur.Pod).Warn("port forwarding ended - reconnecting")
+		default:
+			if f.podReady(ctx, cur.Pod) {
+				return cur.Addr, nil
+			}
+			log.WithField("pod", cur.Pod).Warn("pod is no longer ready - reconnecting")
+			close(cur.stop)
+		}
+		f.current = nil
+	}
+
+	pod, err := findNetPod(ctx, f.ClientSet, f.Namespace, f.Selector, f.Strategy)
+	if err != nil {
+		return "", fmt.Errorf("cannot find Bhojpur Network pod: %w", err)
+	}
+	fw, err := forwardPort(ctx, f.Config, f.ClientSet.CoreV1().RESTClient(), f.Namespace, pod, f.PodPort)
+	if err != nil {
+		return "", fmt.Errorf("cannot forward port to pod %s: %w", pod, err)
+	}
+	log.WithField("pod", pod).WithField("addr", fw.Addr).Debug("forwarding port")
+
+	f.current = fw
+	return fw.Addr, nil
+}
+
+// podReady checks if a pod still exists and is ready
+func (f *podForwarder) podReady(ctx context.Context, name string) bool {
+	pod, err := f.ClientSet.CoreV1().Pods(f.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		log.WithError(err).WithField("pod", name).Debug("cannot get pod")
+		return false
+	}
+	return isPodReady(pod)
+}
+
+// forwardPort establishes a TCP port forwarding from a random local port to a Kubernetes pod.
+// It returns once the forwarding is ready.
+func forwardPort(ctx context.Context, config *rest.Config, restClient rest.Interface, namespace, pod, port string) (*forwarding, error) {
+	roundTripper, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return nil, err
+	}
+	serverURL := restClient.Post().Resource("pods").Namespace(namespace).Name(pod).SubResource("portforward").URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, serverURL)
+
+	res := &forwarding{
+		Pod:  pod,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	ready := make(chan struct{})
+	// errors of individual connections are reported by gRPC already
+	errOut := log.WithField("pod", pod).WriterLevel(log.DebugLevel)
+	forwarder, err := portforward.New(dialer, []string{":" + port}, res.stop, ready, io.Discard, errOut)
+	if err != nil {
+		errOut.Close()
+		return nil, err
+	}
+	go func() {
+		defer close(res.done)
+		defer errOut.Close()
+		res.err = forwarder.ForwardPorts()
+	}()
+
+	select {
+	case <-ready:
+	case <-res.done:
+		if res.err == nil {
+			res.err = fmt.Errorf("port forwarding ended before it was ready")
+		}
+		return nil, res.err
+	case <-ctx.Done():
+		close(res.stop)
+		return nil, ctx.Err()
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		close(res.stop)
+		return nil, err
+	}
+	res.Addr = fmt.Sprintf("localhost:%d", ports[0].Local)
+	return res, nil
+}
@@ -0,0 +1,137 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFindNetPod(t *testing.T) {
+	now := time.Now()
+	pod := func(name string, age time.Duration, phase corev1.PodPhase, ready bool, terminating bool) *corev1.Pod {
+		res := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            map[string]string{"app.kubernetes.io/name": "net"},
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+		cond := corev1.ConditionFalse
+		if ready {
+			cond = corev1.ConditionTrue
+		}
+		res.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: cond}}
+		if terminating {
+			ts := metav1.NewTime(now)
+			res.DeletionTimestamp = &ts
+		}
+		return res
+	}
+
+	tests := []struct {
+		Name        string
+		Pods        []*corev1.Pod
+		Strategy    podStrategy
+		Expectation []string
+		Error       bool
+	}{
+		{
+			Name:  "no pods",
+			Error: true,
+		},
+		{
+			Name: "none ready",
+			Pods: []*corev1.Pod{
+				pod("net-a", time.Hour, corev1.PodPending, false, false),
+				pod("net-b", time.Hour, corev1.PodRunning, false, false),
+				pod("net-c", time.Hour, corev1.PodRunning, true, true),
+			},
+			Error: true,
+		},
+		{
+			Name: "first skips unready pods",
+			Pods: []*corev1.Pod{
+				pod("net-a", time.Hour, corev1.PodRunning, true, true),
+				pod("net-c", time.Hour, corev1.PodRunning, true, false),
+				pod("net-b", time.Hour, corev1.PodRunning, true, false),
+			},
+			Strategy:    podStrategyFirst,
+			Expectation: []string{"net-b"},
+		},
+		{
+			Name: "newest",
+			Pods: []*corev1.Pod{
+				pod("net-a", time.Hour, corev1.PodRunning, true, false),
+				pod("net-b", time.Minute, corev1.PodRunning, true, false),
+				pod("net-c", time.Second, corev1.PodRunning, false, false),
+			},
+			Strategy:    podStrategyNewest,
+			Expectation: []string{"net-b"},
+		},
+		{
+			Name: "random",
+			Pods: []*corev1.Pod{
+				pod("net-a", time.Hour, corev1.PodRunning, true, false),
+				pod("net-b", time.Minute, corev1.PodRunning, true, false),
+				pod("net-c", time.Second, corev1.PodFailed, false, false),
+			},
+			Strategy:    podStrategyRandom,
+			Expectation: []string{"net-a", "net-b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			clientSet := fake.NewSimpleClientset()
+			for _, p := range test.Pods {
+				_, err := clientSet.CoreV1().Pods(p.Namespace).Create(context.Background(), p, metav1.CreateOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			act, err := findNetPod(context.Background(), clientSet, "default", "app.kubernetes.io/name=net", test.Strategy)
+			if test.Error {
+				if err == nil {
+					t.Errorf("expected an error, got pod %s", act)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, exp := range test.Expectation {
+				if act == exp {
+					return
+				}
+			}
+			t.Errorf("expected one of %v, got %s", test.Expectation, act)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// printOutput prints msg in the requested format. The table format is rendered by table.
+func printOutput(out io.Writer, format string, msg proto.Message, table func(w io.Writer) error) error {
+	switch format {
+	case outputTable:
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		err := table(tw)
+		if err != nil {
+			return err
+		}
+		return tw.Flush()
+	case outputJSON:
+		res, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(res))
+		return err
+	case outputYAML:
+		res, err := protojson.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		// JSON is valid YAML: parsing it keeps the field names and their order
+		var doc yaml.Node
+		err = yaml.Unmarshal(res, &doc)
+		if err != nil {
+			return err
+		}
+		blockStyle(&doc)
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		err = enc.Encode(&doc)
+		if err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unknown output format %q: must be one of %s, %s or %s", format, outputTable, outputJSON, outputYAML)
+	}
+}
+
+// blockStyle drops the JSON flow style of a YAML document, so that it's rendered in block style
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// printEngineTable prints a table with one row per engine
+func printEngineTable(w io.Writer, engines []*v1.EngineStatus) error {
+	fmt.Fprintln(w, "NAME\tPHASE\tSUCCESS\tOWNER\tREPOSITORY\tAGE")
+	for _, st := range engines {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\t%s\n",
+			st.Name,
+			phaseName(st.Phase),
+			st.GetConditions().GetSuccess(),
+			st.GetMetadata().GetOwner(),
+			repositoryName(st.GetMetadata().GetRepository()),
+			age(st.GetMetadata()),
+		)
+	}
+	return nil
+}
+
+// phaseName renders a phase without its prefix, e.g. running for PHASE_RUNNING
+func phaseName(p v1.EnginePhase) string {
+	return strings.ToLower(strings.TrimPrefix(p.String(), "PHASE_"))
+}
+
+// repositoryName renders a repository as owner/repo@ref
+func repositoryName(repo *v1.Repository) string {
+	if repo.GetRepo() == "" {
+		return "-"
+	}
+	res := repo.Repo
+	if repo.Owner != "" {
+		res = repo.Owner + "/" + res
+	}
+	if ref := strings.TrimPrefix(repo.Ref, "refs/heads/"); ref != "" {
+		res += "@" + ref
+	}
+	return res
+}
+
+// age renders how long ago an engine was created
+func age(md *v1.EngineMetadata) string {
+	if md.GetCreated() == nil {
+		return "-"
+	}
+	d := time.Since(md.Created.AsTime())
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
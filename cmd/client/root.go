@@ -21,27 +21,17 @@ package cmd
 // THE SOFTWARE.
 
 import (
-	"bytes"
-	"context"
+	"errors"
 	"fmt"
 	"io"
-	"net"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
-	"sync"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/tools/portforward"
-	"k8s.io/client-go/transport/spdy"
 )
 
 var (
@@ -56,6 +46,8 @@ var rootCmdOpts struct {
 	K8sNamespace     string
 	K8sLabelSelector string
 	K8sPodPort       string
+	K8sPodStrategy   string
+	K8sService       string
 	DialMode         string
 }
 
@@ -63,6 +55,8 @@ var rootCmdOpts struct {
 var rootCmd = &cobra.Command{
 	Use:   "net",
 	Short: "Bhojpur Network is a protocol engine powered by Kubernetes",
+	// errors are printed by Execute
+	SilenceErrors: true,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		if verbose {
 			log.SetLevel(log.DebugLevel)
@@ -74,10 +68,29 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	err := rootCmd.Execute()
+	if err == nil {
+		return
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
 	}
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+// exitCodeEngineFailed is the exit code of commands following an engine that did not succeed
+const exitCodeEngineFailed = 2
+
+// exitError makes the CLI exit with a particular code. The command is expected to have
+// explained the reason already, so nothing gets printed.
+type exitError struct {
+	Code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
 }
 
 type dialMode string
@@ -110,6 +123,11 @@ func init() {
 	if netPodPort == "" {
 		netPodPort = "7777"
 	}
+	netPodStrategy := os.Getenv("NET_K8S_POD_STRATEGY")
+	if netPodStrategy == "" {
+		netPodStrategy = string(podStrategyFirst)
+	}
+	netService := os.Getenv("NET_K8S_SERVICE")
 	dialMode := os.Getenv("NET_DIAL_MODE")
 	if dialMode == "" {
 		dialMode = string(dialModeHost)
@@ -120,6 +138,8 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Host, "host", netHost, "[host dial mode] Bhojpur Network host to talk to (defaults to NET_HOST env var)")
 	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Kubeconfig, "kubeconfig", netKubeconfig, "[kubernetes dial mode] kubeconfig file to use (defaults to KUEBCONFIG env var)")
 	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.K8sNamespace, "k8s-namespace", netNamespace, "[kubernetes dial mode] Kubernetes namespace in which to look for the Bhojpur Network pods (defaults to NET_K8S_NAMESPACE env var, or configured kube context namespace)")
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.K8sPodStrategy, "k8s-pod-strategy", netPodStrategy, "[kubernetes dial mode] which of several ready Bhojpur Network pods to connect to: first, random or newest (defaults to NET_K8S_POD_STRATEGY env var)")
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.K8sService, "k8s-service", netService, "[kubernetes dial mode] Kubernetes service whose ready endpoints to balance calls across, instead of connecting to a single pod, requires Kubernetes 1.21 or later (defaults to NET_K8S_SERVICE env var)")
 	// The following are such specific flags that really only matters if one doesn't use the stock helm charts.
 	// They can still be set using an env var, but there's no need to clutter the CLI with them.
 	rootCmdOpts.K8sLabelSelector = netLabelSelector
@@ -148,72 +168,6 @@ func dial() (res closableGrpcClientConnInterface) {
 	return
 }
 
-func dialKubernetes() (closableGrpcClientConnInterface, error) {
-	kubecfg, namespace, err := getKubeconfig(rootCmdOpts.Kubeconfig)
-	if err != nil {
-		return nil, fmt.Errorf("cannot load kubeconfig %s: %w", rootCmdOpts.Kubeconfig, err)
-	}
-	if rootCmdOpts.K8sNamespace != "" {
-		namespace = rootCmdOpts.K8sNamespace
-	}
-
-	clientSet, err := kubernetes.NewForConfig(kubecfg)
-	if err != nil {
-		return nil, err
-	}
-
-	pod, err := findNetPod(clientSet, namespace, rootCmdOpts.K8sLabelSelector)
-	if err != nil {
-		return nil, fmt.Errorf("cannot find Bhojpur Network pod: %w", err)
-	}
-
-	localPort, err := findFreeLocalPort()
-
-	ctx, cancel := context.WithCancel(context.Background())
-	readychan, errchan := forwardPort(ctx, kubecfg, namespace, pod, fmt.Sprintf("%d:%s", localPort, rootCmdOpts.K8sPodPort))
-	select {
-	case err := <-errchan:
-		cancel()
-		return nil, err
-	case <-readychan:
-	}
-
-	res, err := grpc.Dial(fmt.Sprintf("localhost:%d", localPort), grpc.WithInsecure())
-	if err != nil {
-		cancel()
-		return nil, fmt.Errorf("cannot dial forwarded connection: %w", err)
-	}
-
-	return closableConn{
-		ClientConnInterface: res,
-		Closer:              func() error { cancel(); return nil },
-	}, nil
-}
-
-type closableConn struct {
-	grpc.ClientConnInterface
-	Closer func() error
-}
-
-func (c closableConn) Close() error {
-	return c.Closer()
-}
-
-func findFreeLocalPort() (int, error) {
-	const (
-		start = 30000
-		end   = 60000
-	)
-	for p := start; p <= end; p++ {
-		l, err := net.Listen("tcp", fmt.Sprintf(":%d", p))
-		if err == nil {
-			l.Close()
-			return p, nil
-		}
-	}
-	return 0, fmt.Errorf("no free local port found")
-}
-
 // GetKubeconfig loads kubernetes connection config from a kubeconfig file
 func getKubeconfig(kubeconfig string) (res *rest.Config, namespace string, err error) {
 	cfg := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
@@ -232,74 +186,3 @@ func getKubeconfig(kubeconfig string) (res *rest.Config, namespace string, err e
 
 	return res, namespace, nil
 }
-
-// findNetPod returns the first pod we found for a particular component
-func findNetPod(clientSet kubernetes.Interface, namespace, selector string) (podName string, err error) {
-	pods, err := clientSet.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{
-		LabelSelector: selector,
-	})
-	if err != nil {
-		return "", err
-	}
-	if len(pods.Items) == 0 {
-		return "", fmt.Errorf("no pod in %s with label component=%s", namespace, selector)
-	}
-	return pods.Items[0].Name, nil
-}
-
-// ForwardPort establishes a TCP port forwarding to a Kubernetes pod
-func forwardPort(ctx context.Context, config *rest.Config, namespace, pod, port string) (readychan chan struct{}, errchan chan error) {
-	errchan = make(chan error, 1)
-	readychan = make(chan struct{}, 1)
-
-	roundTripper, upgrader, err := spdy.RoundTripperFor(config)
-	if err != nil {
-		errchan <- err
-		return
-	}
-
-	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", namespace, pod)
-	hostIP := strings.TrimLeft(config.Host, "https://")
-	serverURL := url.URL{Scheme: "https", Path: path, Host: hostIP}
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, &serverURL)
-
-	stopChan := make(chan struct{}, 1)
-	fwdReadyChan := make(chan struct{}, 1)
-	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
-	forwarder, err := portforward.New(dialer, []string{port}, stopChan, fwdReadyChan, out, errOut)
-	if err != nil {
-		panic(err)
-	}
-
-	var once sync.Once
-	go func() {
-		err := forwarder.ForwardPorts()
-		if err != nil {
-			errchan <- err
-		}
-		once.Do(func() { close(readychan) })
-	}()
-
-	go func() {
-		select {
-		case <-readychan:
-			// we're out of here
-		case <-ctx.Done():
-			close(stopChan)
-		}
-	}()
-
-	go func() {
-		for range fwdReadyChan {
-		}
-
-		if errOut.Len() != 0 {
-			errchan <- fmt.Errorf(errOut.String())
-			return
-		}
-
-		once.Do(func() { close(readychan) })
-	}()
-
-	return
-}
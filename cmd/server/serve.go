@@ -0,0 +1,218 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/chat"
+	"github.com/bhojpur/net/pkg/engine"
+	"github.com/bhojpur/net/pkg/gateway"
+	"github.com/bhojpur/net/pkg/store"
+	"github.com/bhojpur/net/pkg/store/postgres"
+	"github.com/bhojpur/net/pkg/transport"
+	"github.com/bhojpur/net/pkg/webui"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+)
+
+var serveCmdOpts struct {
+	Addr      string
+	DBDSN     string
+	UploadDir string
+
+	SubscriberBuffer     int
+	EvictSlowSubscribers bool
+	StatsInterval        time.Duration
+
+	ReadOnly bool
+	Executor string
+
+	RepoCheckouts    []string
+	SpecScanInterval time.Duration
+
+	StrictAnnotations bool
+}
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Starts the Bhojpur Network engine server",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var (
+			engines store.Engines = store.NewInMemoryEngineStore()
+			logs    store.Logs    = store.NewInMemoryLogStore()
+			specs   store.Specs   = store.NewInMemorySpecStore()
+		)
+		if serveCmdOpts.DBDSN != "" {
+			db, err := sql.Open("postgres", serveCmdOpts.DBDSN)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			err = db.Ping()
+			if err != nil {
+				return fmt.Errorf("cannot connect to database: %w", err)
+			}
+			err = postgres.Migrate(context.Background(), db)
+			if err != nil {
+				return err
+			}
+
+			engines = postgres.NewEngineStore(db)
+			logs = postgres.NewLogStore(db)
+			specs = postgres.NewSpecStore(db)
+		} else {
+			log.Warn("no database configured - engines will be lost when the server stops")
+		}
+		var executor engine.Executor
+		switch serveCmdOpts.Executor {
+		case "process":
+			processes := &engine.ProcessExecutor{}
+			defer processes.Close()
+			executor = processes
+		case "none":
+		default:
+			return fmt.Errorf("unknown executor %q: use process or none", serveCmdOpts.Executor)
+		}
+		service := engine.NewService(engines, logs, executor)
+		service.Specs = specs
+		service.UploadDir = serveCmdOpts.UploadDir
+		service.Sources = engine.GitSourceFetcher{BaseDir: serveCmdOpts.UploadDir}
+		service.SubscriberBuffer = serveCmdOpts.SubscriberBuffer
+		if serveCmdOpts.EvictSlowSubscribers {
+			service.SlowSubscribers = engine.OverflowEvict
+		}
+		if serveCmdOpts.ReadOnly {
+			// waiting engines are left to the server that started them
+			log.Info("serving read-only - engines cannot be started or stopped")
+		} else if executor == nil {
+			// waiting engines are left to a server that can run them
+			log.Info("serving without executor - engines cannot be started")
+		} else {
+			err := service.ResumeWaiting(context.Background())
+			if err != nil {
+				return fmt.Errorf("cannot resume waiting engines: %w", err)
+			}
+		}
+		defer service.Close()
+
+		lis, err := net.Listen("tcp", serveCmdOpts.Addr)
+		if err != nil {
+			return err
+		}
+
+		scanner := &engine.SpecScanner{
+			Checkouts: serveCmdOpts.RepoCheckouts,
+			Interval:  serveCmdOpts.SpecScanInterval,
+		}
+		bgCtx, stopBackground := context.WithCancel(context.Background())
+		defer stopBackground()
+		go scanner.Run(bgCtx)
+		if serveCmdOpts.StatsInterval > 0 {
+			go service.ReportSubscriberStats(bgCtx, serveCmdOpts.StatsInterval)
+		}
+
+		var (
+			opts []grpc.ServerOption
+			gw   = &gateway.Gateway{}
+		)
+		if serveCmdOpts.ReadOnly {
+			opts = append(opts,
+				grpc.UnaryInterceptor(engine.ReadOnlyUnaryInterceptor()),
+				grpc.StreamInterceptor(engine.ReadOnlyStreamInterceptor()),
+			)
+			gw.UnaryInterceptor = engine.ReadOnlyUnaryInterceptor()
+			gw.StreamInterceptor = engine.ReadOnlyStreamInterceptor()
+		} else if executor == nil {
+			opts = append(opts,
+				grpc.UnaryInterceptor(engine.NoExecutorUnaryInterceptor()),
+				grpc.StreamInterceptor(engine.NoExecutorStreamInterceptor()),
+			)
+			gw.UnaryInterceptor = engine.NoExecutorUnaryInterceptor()
+			gw.StreamInterceptor = engine.NoExecutorStreamInterceptor()
+		}
+		if len(serveCmdOpts.RepoCheckouts) > 0 {
+			// without checkouts every spec would be unknown
+			service.EngineSpecs = scanner
+		}
+		service.StrictAnnotations = serveCmdOpts.StrictAnnotations
+		ui := &engine.UIService{Specs: scanner, ReadOnly: serveCmdOpts.ReadOnly}
+
+		grpcServer := grpc.NewServer(opts...)
+		for _, reg := range []grpc.ServiceRegistrar{grpcServer, gw} {
+			v1.RegisterNetServiceServer(reg, service)
+			v1.RegisterNetUIServer(reg, ui)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/socket.io/", chat.NewServer(transport.GetDefaultPollingTransport()))
+		gw.Mount(mux)
+		mux.Handle("/debug/subscribers", service.SubscriberStatsHandler())
+		mux.Handle("/", webui.Handler(webui.Assets()))
+		httpServer := &http.Server{Handler: gateway.WithGRPC(grpcServer, mux)}
+
+		go func() {
+			sigChan := make(chan os.Signal, 1)
+			signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+			<-sigChan
+
+			log.Info("shutting down")
+			grpcServer.GracefulStop()
+			httpServer.Shutdown(context.Background())
+		}()
+
+		log.WithField("addr", lis.Addr().String()).Info("serving Bhojpur Network API")
+		err = httpServer.Serve(lis)
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveCmdOpts.Addr, "addr", ":7777", "address to serve the gRPC, gRPC-Web and JSON API on")
+	serveCmd.Flags().StringVar(&serveCmdOpts.DBDSN, "db", os.Getenv("NET_DB_DSN"), "PostgreSQL connection string used to store engines (defaults to NET_DB_DSN env var). Engines are kept in memory if this is empty.")
+	serveCmd.Flags().StringVar(&serveCmdOpts.UploadDir, "upload-dir", "", "directory where applications of local engines are extracted to (defaults to the system's temp directory)")
+	serveCmd.Flags().IntVar(&serveCmdOpts.SubscriberBuffer, "subscriber-buffer", engine.DefaultSubscriberBuffer, "number of engine events buffered for each subscriber")
+	serveCmd.Flags().DurationVar(&serveCmdOpts.StatsInterval, "stats-interval", 5*time.Minute, "how often subscriber statistics such as dropped events and lag are logged, 0 disables them. They are always served on /debug/subscribers")
+	serveCmd.Flags().BoolVar(&serveCmdOpts.EvictSlowSubscribers, "evict-slow-subscribers", false, "disconnect subscribers whose buffer is full instead of having them resync")
+	serveCmd.Flags().StringVar(&serveCmdOpts.Executor, "executor", "process", "how engines are run: process runs the run script of their YAML on this machine, none rejects all requests that start engines")
+	serveCmd.Flags().BoolVar(&serveCmdOpts.ReadOnly, "read-only", os.Getenv("NET_READ_ONLY") == "true", "reject all requests that start or stop engines, e.g. to run a public status mirror (defaults to NET_READ_ONLY env var)")
+	serveCmd.Flags().StringSliceVar(&serveCmdOpts.RepoCheckouts, "repo", nil, "repository checkout whose engine specs are offered by the UI (can be given multiple times)")
+	serveCmd.Flags().BoolVar(&serveCmdOpts.StrictAnnotations, "strict-annotations", false, "reject annotations that aren't arguments of the engine spec an engine is started from")
+	serveCmd.Flags().DurationVar(&serveCmdOpts.SpecScanInterval, "spec-scan-interval", engine.DefaultScanInterval, "how often repository checkouts are checked for changed engine specs")
+}
@@ -7,90 +7,95 @@ require (
 	github.com/lib/pq v1.10.4
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.3.0
+	golang.org/x/net v0.7.0
+	golang.org/x/term v0.5.0
+	google.golang.org/genproto v0.0.0-20220111164026-67b88f271998
 	google.golang.org/grpc v1.43.0
 	google.golang.org/protobuf v1.27.1
-	k8s.io/apimachinery v0.23.1
-	k8s.io/client-go v1.5.2
+	gopkg.in/yaml.v3 v3.0.1
+	k8s.io/api v0.23.17
+	k8s.io/apimachinery v0.23.17
+	k8s.io/client-go v0.23.17
 )
 
 require (
 	cloud.google.com/go/compute v1.0.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/docker/spdystream v0.1.0 // indirect
+	github.com/evanphx/json-patch v4.12.0+incompatible // indirect
 	github.com/go-logr/logr v1.2.2 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/google/go-cmp v0.5.6 // indirect
 	github.com/google/gofuzz v1.2.0 // indirect
 	github.com/googleapis/gnostic v0.5.5 // indirect
 	github.com/imdario/mergo v0.3.12 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/moby/spdystream v0.2.0 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3 // indirect
-	golang.org/x/net v0.0.0-20220111093109-d55c255bac03 // indirect
 	golang.org/x/oauth2 v0.0.0-20211104180415-d3ed0bb246c8 // indirect
-	golang.org/x/sys v0.0.0-20220111092808-5a964db01320 // indirect
-	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211 // indirect
-	golang.org/x/text v0.3.7 // indirect
-	golang.org/x/time v0.0.0-20211116232009-f0f3c7e86c11 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/text v0.7.0 // indirect
+	golang.org/x/time v0.0.0-20220210224613-90d013bbcef8 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
-	google.golang.org/genproto v0.0.0-20220111164026-67b88f271998 // indirect
 	gopkg.in/inf.v0 v0.9.1 // indirect
+	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
-	k8s.io/api v0.23.1 // indirect
 	k8s.io/klog/v2 v2.40.1 // indirect
+	k8s.io/kube-openapi v0.0.0-20211115234752-e816edb12b65 // indirect
 	k8s.io/utils v0.0.0-20211208161948-7d6a63dca704 // indirect
-	sigs.k8s.io/structured-merge-diff/v4 v4.2.0 // indirect
+	sigs.k8s.io/json v0.0.0-20211020170558-c049b76a60c6 // indirect
+	sigs.k8s.io/structured-merge-diff/v4 v4.2.3 // indirect
 	sigs.k8s.io/yaml v1.3.0 // indirect
 )
 
-replace k8s.io/api => k8s.io/api v0.20.4
+replace k8s.io/api => k8s.io/api v0.23.17
 
-replace k8s.io/apiextensions-apiserver => k8s.io/apiextensions-apiserver v0.20.4
+replace k8s.io/apiextensions-apiserver => k8s.io/apiextensions-apiserver v0.23.17
 
-replace k8s.io/apimachinery => k8s.io/apimachinery v0.20.4
+replace k8s.io/apimachinery => k8s.io/apimachinery v0.23.17
 
-replace k8s.io/apiserver => k8s.io/apiserver v0.20.4
+replace k8s.io/apiserver => k8s.io/apiserver v0.23.17
 
-replace k8s.io/cli-runtime => k8s.io/cli-runtime v0.20.4
+replace k8s.io/cli-runtime => k8s.io/cli-runtime v0.23.17
 
-replace k8s.io/client-go => k8s.io/client-go v0.20.4
+replace k8s.io/client-go => k8s.io/client-go v0.23.17
 
-replace k8s.io/cloud-provider => k8s.io/cloud-provider v0.20.4
+replace k8s.io/cloud-provider => k8s.io/cloud-provider v0.23.17
 
-replace k8s.io/cluster-bootstrap => k8s.io/cluster-bootstrap v0.20.4
+replace k8s.io/cluster-bootstrap => k8s.io/cluster-bootstrap v0.23.17
 
-replace k8s.io/code-generator => k8s.io/code-generator v0.20.4
+replace k8s.io/code-generator => k8s.io/code-generator v0.23.17
 
-replace k8s.io/component-base => k8s.io/component-base v0.20.4
+replace k8s.io/component-base => k8s.io/component-base v0.23.17
 
-replace k8s.io/cri-api => k8s.io/cri-api v0.20.4
+replace k8s.io/cri-api => k8s.io/cri-api v0.23.17
 
-replace k8s.io/csi-translation-lib => k8s.io/csi-translation-lib v0.20.4
+replace k8s.io/csi-translation-lib => k8s.io/csi-translation-lib v0.23.17
 
-replace k8s.io/kube-aggregator => k8s.io/kube-aggregator v0.20.4
+replace k8s.io/kube-aggregator => k8s.io/kube-aggregator v0.23.17
 
-replace k8s.io/kube-controller-manager => k8s.io/kube-controller-manager v0.20.4
+replace k8s.io/kube-controller-manager => k8s.io/kube-controller-manager v0.23.17
 
-replace k8s.io/kube-proxy => k8s.io/kube-proxy v0.20.4
+replace k8s.io/kube-proxy => k8s.io/kube-proxy v0.23.17
 
-replace k8s.io/kube-scheduler => k8s.io/kube-scheduler v0.20.4
+replace k8s.io/kube-scheduler => k8s.io/kube-scheduler v0.23.17
 
-replace k8s.io/kubelet => k8s.io/kubelet v0.20.4
+replace k8s.io/kubelet => k8s.io/kubelet v0.23.17
 
-replace k8s.io/legacy-cloud-providers => k8s.io/legacy-cloud-providers v0.20.4
+replace k8s.io/legacy-cloud-providers => k8s.io/legacy-cloud-providers v0.23.17
 
-replace k8s.io/metrics => k8s.io/metrics v0.20.4
+replace k8s.io/metrics => k8s.io/metrics v0.23.17
 
-replace k8s.io/sample-apiserver => k8s.io/sample-apiserver v0.20.4
+replace k8s.io/sample-apiserver => k8s.io/sample-apiserver v0.23.17
 
-replace k8s.io/component-helpers => k8s.io/component-helpers v0.20.4
+replace k8s.io/component-helpers => k8s.io/component-helpers v0.23.17
 
-replace k8s.io/controller-manager => k8s.io/controller-manager v0.20.4
+replace k8s.io/controller-manager => k8s.io/controller-manager v0.23.17
 
-replace k8s.io/kubectl => k8s.io/kubectl v0.20.4
+replace k8s.io/kubectl => k8s.io/kubectl v0.23.17
 
-replace k8s.io/mount-utils => k8s.io/mount-utils v0.20.4
+replace k8s.io/mount-utils => k8s.io/mount-utils v0.23.17
@@ -23,6 +23,8 @@ package chat
 import (
 	"errors"
 	"sync"
+
+	"github.com/bhojpur/net/pkg/protocol"
 )
 
 var (
@@ -36,7 +38,7 @@ type ackProcessor struct {
 	counter     int
 	counterLock sync.Mutex
 
-	resultWaiters     map[int](chan string)
+	resultWaiters     map[int](chan *protocol.Message)
 	resultWaitersLock sync.RWMutex
 }
 
@@ -55,7 +57,7 @@ func (a *ackProcessor) getNextId() int {
 Just before the ack function called, the waiter should be added
 to wait and receive response to ack call
 */
-func (a *ackProcessor) addWaiter(id int, w chan string) {
+func (a *ackProcessor) addWaiter(id int, w chan *protocol.Message) {
 	a.resultWaitersLock.Lock()
 	a.resultWaiters[id] = w
 	a.resultWaitersLock.Unlock()
@@ -73,7 +75,7 @@ func (a *ackProcessor) removeWaiter(id int) {
 /**
 check if waiter with given ack id is exists, and returns it
 */
-func (a *ackProcessor) getWaiter(id int) (chan string, error) {
+func (a *ackProcessor) getWaiter(id int) (chan *protocol.Message, error) {
 	a.resultWaitersLock.RLock()
 	defer a.resultWaitersLock.RUnlock()
 
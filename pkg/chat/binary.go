@@ -0,0 +1,426 @@
+package chat
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bhojpur/net/pkg/protocol"
+)
+
+var (
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+/**
+Replace []byte values in args with placeholders, so they are sent as binary
+attachments instead of base64 strings. Args without []byte values are
+returned as they are.
+*/
+func extractAttachments(args interface{}) (interface{}, [][]byte) {
+	var attachments [][]byte
+	result, found := extractValue(reflect.ValueOf(args), &attachments)
+	if !found {
+		return args, nil
+	}
+	return result, attachments
+}
+
+/**
+Walk value the way encoding/json marshals it. Values containing []byte are
+rebuilt from maps and slices, found is false if there's none.
+*/
+func extractValue(v reflect.Value, attachments *[][]byte) (result interface{}, found bool) {
+	if !v.IsValid() || !v.CanInterface() || isMarshaler(v) {
+		return nil, false
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil, false
+		}
+		return extractValue(v.Elem(), attachments)
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.IsNil() {
+				return nil, false
+			}
+			*attachments = append(*attachments, v.Bytes())
+			return &protocol.Placeholder{Placeholder: true, Num: len(*attachments) - 1}, true
+		}
+
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = extractOrKeep(v.Index(i), attachments, &found)
+		}
+		return items, found
+
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+
+		items := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			items[iter.Key().String()] = extractOrKeep(iter.Value(), attachments, &found)
+		}
+		return items, found
+
+	case reflect.Struct:
+		items := make(map[string]interface{})
+		extractFields(v, items, attachments, &found)
+		return items, found
+	}
+
+	return nil, false
+}
+
+func extractOrKeep(v reflect.Value, attachments *[][]byte, found *bool) interface{} {
+	result, ok := extractValue(v, attachments)
+	if !ok {
+		return v.Interface()
+	}
+	*found = true
+	return result
+}
+
+/**
+Put struct fields to items by their json names, fields of embedded structs
+are promoted like encoding/json does
+*/
+func extractFields(v reflect.Value, items map[string]interface{}, attachments *[][]byte, found *bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+
+		fv := v.Field(i)
+		if field.Anonymous && name == "" {
+			embedded := fv
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				extractFields(embedded, items, attachments, found)
+				continue
+			}
+		}
+		if field.PkgPath != "" || !fv.CanInterface() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(opts, ",omitempty") && isEmptyValue(fv) {
+			continue
+		}
+		items[name] = extractOrKeep(fv, attachments, found)
+	}
+}
+
+/**
+Decode the arguments of msg into out like json.Unmarshal does. Binary
+attachments are put straight into the []byte values they replace.
+*/
+func decodeArgs(msg *protocol.Message, out interface{}) error {
+	if len(msg.Attachments) == 0 {
+		return json.Unmarshal([]byte(msg.Args), out)
+	}
+
+	values, err := protocol.DecodeArgs(msg.Args, msg.Attachments)
+	if err != nil {
+		return err
+	}
+	if len(values) != 1 {
+		return protocol.ErrorWrongPacket
+	}
+	return decodeValue(values[0], out)
+}
+
+/**
+Put a value decoded by protocol.DecodeArgs into out, which should be a pointer
+*/
+func decodeValue(value interface{}, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return &json.InvalidUnmarshalError{Type: reflect.TypeOf(out)}
+	}
+	return assignValue(value, v.Elem())
+}
+
+/**
+Assign value to v, which is addressable. Parts without attachments are left
+to encoding/json, so only the way to the []byte values is walked here.
+*/
+func assignValue(value interface{}, v reflect.Value) error {
+	if !hasAttachments(value) || reflect.PtrTo(v.Type()).Implements(jsonUnmarshalerType) {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assignValue(value, v.Elem())
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(plainValue(value)))
+		return nil
+	}
+
+	switch value := value.(type) {
+	case []byte:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(value)
+			return nil
+		}
+
+	case []interface{}:
+		switch v.Kind() {
+		case reflect.Slice:
+			items := reflect.MakeSlice(v.Type(), len(value), len(value))
+			for i := range value {
+				if err := assignValue(value[i], items.Index(i)); err != nil {
+					return err
+				}
+			}
+			v.Set(items)
+			return nil
+
+		case reflect.Array:
+			for i := 0; i < v.Len() && i < len(value); i++ {
+				if err := assignValue(value[i], v.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+	case map[string]interface{}:
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				break
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMapWithSize(v.Type(), len(value)))
+			}
+			for key, item := range value {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := assignValue(item, elem); err != nil {
+					return err
+				}
+				v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+			}
+			return nil
+
+		case reflect.Struct:
+			for key, item := range value {
+				field, ok := fieldByName(v, key)
+				if !ok {
+					continue
+				}
+				if err := assignValue(item, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("socket.io cannot decode binary attachment into %s", v.Type())
+}
+
+func hasAttachments(value interface{}) bool {
+	switch value := value.(type) {
+	case []byte:
+		return true
+	case []interface{}:
+		for _, item := range value {
+			if hasAttachments(item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range value {
+			if hasAttachments(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/**
+Numbers become float64 like encoding/json decodes them into interface{},
+attachments stay []byte
+*/
+func plainValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		f, _ := value.Float64()
+		return f
+	case []interface{}:
+		for i := range value {
+			value[i] = plainValue(value[i])
+		}
+	case map[string]interface{}:
+		for key := range value {
+			value[key] = plainValue(value[key])
+		}
+	}
+	return value
+}
+
+/**
+Find the struct field a json key is decoded into, nil embedded structs on the
+way are allocated
+*/
+func fieldByName(v reflect.Value, name string) (reflect.Value, bool) {
+	index := fieldIndex(v.Type(), name)
+	if index == nil {
+		return reflect.Value{}, false
+	}
+
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, v.CanSet()
+}
+
+/**
+Index of the field with the given json name, an exact match is preferred
+over a case-insensitive one like encoding/json does
+*/
+func fieldIndex(t reflect.Type, name string) []int {
+	var folded []int
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		fieldName, _ := parseTag(tag)
+
+		if field.Anonymous && fieldName == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if index := fieldIndex(embedded, name); index != nil {
+					return append([]int{i}, index...)
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if fieldName == "" {
+			fieldName = field.Name
+		}
+		if fieldName == name {
+			return []int{i}
+		}
+		if folded == nil && strings.EqualFold(fieldName, name) {
+			folded = []int{i}
+		}
+	}
+	return folded
+}
+
+/**
+Split a json tag into the name and the options, which keep the leading comma
+*/
+func parseTag(tag string) (name, opts string) {
+	if pos := strings.IndexByte(tag, ','); pos != -1 {
+		return tag[:pos], tag[pos:]
+	}
+	return tag, ""
+}
+
+/**
+Values which marshal themselves are left alone, even if they are []byte like json.RawMessage
+*/
+func isMarshaler(v reflect.Value) bool {
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return true
+	}
+	if v.CanAddr() {
+		pt := reflect.PtrTo(t)
+		return pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType)
+	}
+	return false
+}
+
+/**
+Same as encoding/json, for the omitempty option
+*/
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -86,7 +86,7 @@ func (c *caller) callFunc(h *Channel, args interface{}) []reflect.Value {
 		args = c.getArgs()
 	}
 
-	a := []reflect.Value{reflect.ValueOf(h), reflect.ValueOf(args)}
+	a := []reflect.Value{reflect.ValueOf(h), reflect.ValueOf(args).Elem()}
 	if !c.ArgsPresent {
 		a = a[0:1]
 	}
@@ -21,8 +21,12 @@ package chat
 // THE SOFTWARE.
 
 import (
+	"encoding/json"
+	"errors"
+	"net/url"
 	"strconv"
 
+	"github.com/bhojpur/net/pkg/protocol"
 	"github.com/bhojpur/net/pkg/transport"
 )
 
@@ -38,8 +42,14 @@ Socket.io client representation
 type Client struct {
 	methods
 	Channel
+
+	authPayload interface{}
 }
 
+var (
+	ErrorAuthNotSupported = errors.New("auth payload requires protocol version 4")
+)
+
 /**
 Get ws/wss url by host and port
 */
@@ -53,35 +63,168 @@ func GetUrl(host string, port int, secure bool) string {
 	return prefix + host + ":" + strconv.Itoa(port) + socketioUrl
 }
 
+/**
+Options for Dial
+*/
+type DialOption func(c *Client)
+
+/**
+Speak given Engine.IO protocol version, protocol.Version3 by default
+*/
+func WithProtocolVersion(version int) DialOption {
+	return func(c *Client) {
+		codec, err := protocol.CodecByVersion(version)
+		if err != nil {
+			codec = &protocol.Codec{Version: version}
+		}
+		c.codec = codec
+	}
+}
+
+/**
+Send auth payload with the CONNECT packet, Engine.IO v4 only
+*/
+func WithAuth(auth interface{}) DialOption {
+	return func(c *Client) {
+		c.authPayload = auth
+	}
+}
+
 /**
 connect to host and initialise socket.io protocol
 
 The correct ws protocol url example:
 ws://chat.bhojpur.net/socket.io/?EIO=3&transport=websocket
 
-You can use GetUrlByHost for generating correct url
+You can use GetUrlByHost for generating correct url. The EIO parameter
+is set according to the protocol version, see WithProtocolVersion.
 */
-func Dial(url string, tr transport.Transport) (*Client, error) {
+func Dial(rawUrl string, tr transport.Transport, opts ...DialOption) (*Client, error) {
 	c := &Client{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.codec == nil {
+		c.codec = protocol.CodecV3
+	}
+	if _, err := protocol.CodecByVersion(c.codec.Version); err != nil {
+		return nil, err
+	}
 	c.initChannel()
 	c.initMethods()
+	c.handlers = &c.methods
+	c.addSocket(&c.Channel)
+
+	if c.authPayload != nil {
+		if !c.codec.ClientConnects() {
+			return nil, ErrorAuthNotSupported
+		}
+		auth, err := json.Marshal(c.authPayload)
+		if err != nil {
+			return nil, err
+		}
+		c.auth = string(auth)
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("EIO", strconv.Itoa(c.codec.Version))
+	u.RawQuery = query.Encode()
 
-	var err error
-	c.conn, err = tr.Connect(url)
+	c.conn, err = tr.Connect(u.String())
 	if err != nil {
 		return nil, err
 	}
 
+	//connect right away, so that the server gets CONNECT before any event
+	if c.codec.ClientConnects() {
+		c.out <- packet{text: c.codec.MustEncode(&protocol.Message{
+			Type: protocol.MessageTypeEmpty,
+			Args: c.auth,
+		})}
+	}
+
 	go inLoop(&c.Channel, &c.methods)
 	go outLoop(&c.Channel, &c.methods)
-	go pinger(&c.Channel)
+	if !c.codec.ServerPings() {
+		go pinger(&c.Channel, &c.methods)
+	}
 
 	return c, nil
 }
 
 /**
-Close client connection
+Connect to given namespace over the connection of this client
+
+The returned client has its own handlers and shares the connection, closing it
+only disconnects from the namespace. The auth payload requires protocol version 4.
+*/
+func (c *Client) Of(namespace string, auth interface{}) (*Client, error) {
+	engine := &c.Channel
+	if c.engine != nil {
+		engine = c.engine
+	}
+
+	nc := &Client{}
+	nc.initMethods()
+	nc.initSocket(engine, normalizeNamespace(namespace), &nc.methods)
+
+	if auth != nil {
+		if !nc.codec.ClientConnects() {
+			return nil, ErrorAuthNotSupported
+		}
+		jsonAuth, err := json.Marshal(auth)
+		if err != nil {
+			return nil, err
+		}
+		nc.auth = string(jsonAuth)
+	}
+
+	if !engine.addSocket(&nc.Channel) {
+		return nil, ErrorNamespaceConnected
+	}
+	msg := &protocol.Message{
+		Type: protocol.MessageTypeEmpty,
+		Args: nc.auth,
+	}
+	if err := send(msg, &nc.Channel, nil); err != nil {
+		engine.removeSocket(&nc.Channel)
+		return nil, err
+	}
+
+	return nc, nil
+}
+
+/**
+Server acknowledged CONNECT packet of a socket
+*/
+func onSocketConnect(s *Channel, args string) {
+	if s.engine == nil {
+		//v3 clients are connected to the default namespace once they got the header
+		if s.codec.ClientConnects() {
+			s.handlers.callLoopEvent(s, OnConnection)
+		}
+		return
+	}
+
+	var hdr Header
+	if err := json.Unmarshal([]byte(args), &hdr); err != nil || hdr.Sid == "" {
+		hdr.Sid = s.namespace + "#" + s.engine.Id()
+	}
+	s.header.Sid = hdr.Sid
+	s.handlers.callLoopEvent(s, OnConnection)
+}
+
+/**
+Close client connection, or disconnect from the namespace
 */
 func (c *Client) Close() {
+	if c.engine != nil {
+		closeSocket(&c.Channel, true)
+		return
+	}
 	closeChannel(&c.Channel, &c.methods)
 }
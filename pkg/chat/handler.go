@@ -21,11 +21,11 @@ package chat
 // THE SOFTWARE.
 
 import (
-	"encoding/json"
 	"reflect"
 	"sync"
 
 	"github.com/bhojpur/net/pkg/protocol"
+	log "github.com/sirupsen/logrus"
 )
 
 const (
@@ -119,7 +119,16 @@ func (m *methods) processIncomingMessage(c *Channel, msg *protocol.Message) {
 			return
 		}
 
-		f.callFunc(c, msg.Args)
+		//emit handlers get the raw json of the arguments, where binary
+		//attachments can only be base64 strings
+		args := msg.Args
+		if len(msg.Attachments) > 0 {
+			var err error
+			if args, err = protocol.ReplacePlaceholders(msg.Args, msg.Attachments); err != nil {
+				return
+			}
+		}
+		f.callFunc(c, &args)
 
 	case protocol.MessageTypeAckRequest:
 		f, ok := m.findMethod(msg.Method)
@@ -131,8 +140,9 @@ func (m *methods) processIncomingMessage(c *Channel, msg *protocol.Message) {
 		if f.ArgsPresent {
 			//data type should be defined for unmarshall
 			data := f.getArgs()
-			err := json.Unmarshal([]byte(msg.Args), &data)
+			err := decodeArgs(msg, data)
 			if err != nil {
+				log.WithError(err).WithField("method", msg.Method).Warn("socket.io cannot decode ack arguments")
 				return
 			}
 
@@ -150,7 +160,7 @@ func (m *methods) processIncomingMessage(c *Channel, msg *protocol.Message) {
 	case protocol.MessageTypeAckResponse:
 		waiter, err := c.ack.getWaiter(msg.AckId)
 		if err == nil {
-			waiter <- msg.Args
+			waiter <- msg
 		}
 	}
 }
@@ -0,0 +1,92 @@
+package chat
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/bhojpur/net/pkg/protocol"
+)
+
+func TestHandlerArgs(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+
+	var (
+		raw string
+		p   point
+	)
+	var m methods
+	m.initMethods()
+	m.On("emit", func(c *Channel, args string) {
+		raw = args
+	})
+	m.On("ack", func(c *Channel, v point) point {
+		p = v
+		return v
+	})
+
+	var c Channel
+	c.initChannel()
+
+	m.processIncomingMessage(&c, &protocol.Message{Type: protocol.MessageTypeEmit, Method: "emit", Args: `"hello"`})
+	if raw != `"hello"` {
+		t.Errorf("emit handler got %q instead of the raw arguments", raw)
+	}
+
+	m.processIncomingMessage(&c, &protocol.Message{Type: protocol.MessageTypeAckRequest, AckId: 1, Method: "ack", Args: `{"X":1,"Y":2}`})
+	if p != (point{1, 2}) {
+		t.Errorf("ack handler got %+v", p)
+	}
+	if len(c.out) != 1 {
+		t.Errorf("expected the ack response to be queued, got %d messages", len(c.out))
+	}
+
+	m.processIncomingMessage(&c, &protocol.Message{Type: protocol.MessageTypeAckRequest, AckId: 2, Method: "ack", Args: `"not a point"`})
+	if len(c.out) != 1 {
+		t.Errorf("ack with arguments of the wrong type was answered")
+	}
+}
+
+func TestDecodeArgs(t *testing.T) {
+	type Meta struct {
+		Checksum []byte `json:"sum"`
+	}
+	type file struct {
+		*Meta
+		Name  string
+		Data  []byte
+		Parts map[string][]byte `json:"parts"`
+	}
+
+	msg := &protocol.Message{
+		Args:        `{"name":"a","data":{"_placeholder":true,"num":0},"sum":{"_placeholder":true,"num":1},"parts":{"x":{"_placeholder":true,"num":0}}}`,
+		Attachments: [][]byte{[]byte("data"), []byte("sum")},
+	}
+	var f file
+	if err := decodeArgs(msg, &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "a" || string(f.Data) != "data" || f.Meta == nil || string(f.Checksum) != "sum" || string(f.Parts["x"]) != "data" {
+		t.Errorf("unexpected file %+v", f)
+	}
+}
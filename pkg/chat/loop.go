@@ -36,7 +36,9 @@ const (
 )
 
 var (
-	ErrorWrongHeader = errors.New("Wrong header")
+	ErrorWrongHeader  = errors.New("Wrong header")
+	ErrorPingTimeout  = errors.New("Ping timeout")
+	ErrorConnectError = errors.New("Connection refused by server")
 )
 
 /**
@@ -47,6 +49,15 @@ type Header struct {
 	Upgrades     []string `json:"upgrades"`
 	PingInterval int      `json:"pingInterval"`
 	PingTimeout  int      `json:"pingTimeout"`
+	MaxPayload   int      `json:"maxPayload,omitempty"`
+}
+
+/**
+Packet to send, binary packets are followed by their attachments
+*/
+type packet struct {
+	text        string
+	attachments [][]byte
 }
 
 /**
@@ -59,19 +70,39 @@ Close message means channel is closed
 ping is automatic
 */
 type Channel struct {
-	conn transport.Connection
+	conn  transport.Connection
+	codec *protocol.Codec
 
-	out    chan string
+	out    chan packet
 	header Header
+	auth   string
+
+	lastPong     time.Time
+	lastPongLock sync.Mutex
 
 	alive     bool
 	aliveLock sync.Mutex
+	//closed once the channel is closed
+	done chan struct{}
 
 	ack ackProcessor
 
 	server        *Server
 	ip            string
 	requestHeader http.Header
+
+	/**
+	Every namespace a client connects to gets its own socket. The socket of
+	the default namespace is the connection itself, the sockets of other
+	namespaces share it, see engine.
+	*/
+	namespace string
+	handlers  *methods
+	nsp       *Namespace
+	engine    *Channel
+
+	sockets     map[string]*Channel
+	socketsLock sync.RWMutex
 }
 
 /**
@@ -79,9 +110,79 @@ create channel, map, and set active
 */
 func (c *Channel) initChannel() {
 	//TODO: queueBufferSize from constant to server or client variable
-	c.out = make(chan string, queueBufferSize)
-	c.ack.resultWaiters = make(map[int](chan string))
+	c.out = make(chan packet, queueBufferSize)
+	c.ack.resultWaiters = make(map[int](chan *protocol.Message))
 	c.alive = true
+	c.done = make(chan struct{})
+	if c.codec == nil {
+		c.codec = protocol.CodecV3
+	}
+	c.lastPong = time.Now()
+	c.namespace = "/"
+	c.sockets = make(map[string]*Channel)
+}
+
+/**
+create socket of given namespace, sharing the connection of engine
+*/
+func (c *Channel) initSocket(engine *Channel, namespace string, m *methods) {
+	c.conn = engine.conn
+	c.codec = engine.codec
+	c.out = engine.out
+	c.server = engine.server
+	c.ip = engine.ip
+	c.requestHeader = engine.requestHeader
+	c.ack.resultWaiters = make(map[int](chan *protocol.Message))
+	c.alive = true
+	c.done = make(chan struct{})
+
+	c.namespace = namespace
+	c.handlers = m
+	c.engine = engine
+}
+
+/**
+Get socket connected to given namespace, nil if there's none
+*/
+func (c *Channel) socket(namespace string) *Channel {
+	c.socketsLock.RLock()
+	defer c.socketsLock.RUnlock()
+
+	return c.sockets[normalizeNamespace(namespace)]
+}
+
+/**
+Store socket, returns false if there's one for its namespace already
+*/
+func (c *Channel) addSocket(s *Channel) bool {
+	c.socketsLock.Lock()
+	defer c.socketsLock.Unlock()
+
+	if _, ok := c.sockets[s.namespace]; ok {
+		return false
+	}
+	c.sockets[s.namespace] = s
+	return true
+}
+
+func (c *Channel) removeSocket(s *Channel) {
+	c.socketsLock.Lock()
+	defer c.socketsLock.Unlock()
+
+	if c.sockets[s.namespace] == s {
+		delete(c.sockets, s.namespace)
+	}
+}
+
+func (c *Channel) listSockets() []*Channel {
+	c.socketsLock.RLock()
+	defer c.socketsLock.RUnlock()
+
+	result := make([]*Channel, 0, len(c.sockets))
+	for _, s := range c.sockets {
+		result = append(result, s)
+	}
+	return result
 }
 
 /**
@@ -91,6 +192,28 @@ func (c *Channel) Id() string {
 	return c.header.Sid
 }
 
+/**
+Get namespace the socket is connected to
+*/
+func (c *Channel) Namespace() string {
+	return c.namespace
+}
+
+/**
+Get auth payload the client sent with its CONNECT packet, as raw json.
+Only Engine.IO v4 clients send one.
+*/
+func (c *Channel) Auth() string {
+	return c.auth
+}
+
+/**
+Get Engine.IO protocol version of the connection
+*/
+func (c *Channel) ProtocolVersion() int {
+	return c.codec.Version
+}
+
 /**
 Checks that Channel is still alive
 */
@@ -115,14 +238,23 @@ func closeChannel(c *Channel, m *methods, args ...interface{}) error {
 
 	c.conn.Close()
 	c.alive = false
+	close(c.done)
 
 	//clean outloop
 	for len(c.out) > 0 {
 		<-c.out
 	}
-	c.out <- protocol.CloseMessage
+	c.out <- packet{text: protocol.CloseMessage}
 
-	m.callLoopEvent(c, OnDisconnection)
+	for _, s := range c.listSockets() {
+		if s != c {
+			closeSocket(s, false)
+		}
+	}
+	//v4 clients may never have connected to the default namespace
+	if c.socket(c.namespace) == c {
+		m.callLoopEvent(c, OnDisconnection)
+	}
 
 	overfloodedLock.Lock()
 	delete(overflooded, c)
@@ -131,30 +263,112 @@ func closeChannel(c *Channel, m *methods, args ...interface{}) error {
 	return nil
 }
 
+/**
+Close socket of a namespace other than the default one, the connection stays
+open. Notify tells the other side about it.
+*/
+func closeSocket(s *Channel, notify bool) {
+	s.aliveLock.Lock()
+	alive := s.alive
+	s.alive = false
+	s.aliveLock.Unlock()
+
+	if !alive {
+		return
+	}
+
+	close(s.done)
+	s.engine.removeSocket(s)
+	if notify && s.engine.IsAlive() {
+		send(&protocol.Message{Type: protocol.MessageTypeDisconnect}, s, nil)
+	}
+	s.handlers.callLoopEvent(s, OnDisconnection)
+}
+
 //incoming messages loop, puts incoming messages to In channel
 func inLoop(c *Channel, m *methods) error {
 	for {
-		pkg, err := c.conn.GetMessage()
+		pkg, binary, err := c.conn.GetMessage()
 		if err != nil {
 			return closeChannel(c, m, err)
 		}
-		msg, err := protocol.Decode(pkg)
+		if binary {
+			//attachments are read along with their packet
+			closeChannel(c, m, protocol.ErrorWrongPacket)
+			return protocol.ErrorWrongPacket
+		}
+		msg, err := c.codec.Decode(pkg)
 		if err != nil {
 			closeChannel(c, m, protocol.ErrorWrongPacket)
 			return err
 		}
+		if err := readAttachments(c, msg); err != nil {
+			closeChannel(c, m, err)
+			return err
+		}
 
 		switch msg.Type {
 		case protocol.MessageTypeOpen:
 			if err := json.Unmarshal([]byte(msg.Source[1:]), &c.header); err != nil {
 				closeChannel(c, m, ErrorWrongHeader)
 			}
+			//since v4 the client is connected once the server acknowledged CONNECT
+			if c.codec.ClientConnects() {
+				continue
+			}
 			m.callLoopEvent(c, OnConnection)
+		case protocol.MessageTypeEmpty:
+			if c.server != nil {
+				c.server.connect(c, msg.Namespace, msg.Args)
+				continue
+			}
+			if s := c.socket(msg.Namespace); s != nil {
+				onSocketConnect(s, msg.Args)
+			}
+		case protocol.MessageTypeError, protocol.MessageTypeDisconnect:
+			if normalizeNamespace(msg.Namespace) != c.namespace {
+				if s := c.socket(msg.Namespace); s != nil {
+					closeSocket(s, false)
+				}
+				continue
+			}
+			if msg.Type == protocol.MessageTypeError {
+				return closeChannel(c, m, ErrorConnectError)
+			}
+			return closeChannel(c, m)
 		case protocol.MessageTypePing:
-			c.out <- protocol.PongMessage
+			c.out <- packet{text: protocol.PongMessage}
 		case protocol.MessageTypePong:
+			c.lastPongLock.Lock()
+			c.lastPong = time.Now()
+			c.lastPongLock.Unlock()
 		default:
-			go m.processIncomingMessage(c, msg)
+			s := c.socket(msg.Namespace)
+			if s == nil {
+				//not connected to the namespace
+				continue
+			}
+			go s.handlers.processIncomingMessage(s, msg)
+		}
+	}
+}
+
+/**
+Read the binary messages following a binary packet
+*/
+func readAttachments(c *Channel, msg *protocol.Message) error {
+	for i := range msg.Attachments {
+		data, binary, err := c.conn.GetMessage()
+		if err != nil {
+			return err
+		}
+		if !binary {
+			return protocol.ErrorWrongPacket
+		}
+
+		msg.Attachments[i], err = c.codec.DecodeAttachment(data)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -188,30 +402,46 @@ func outLoop(c *Channel, m *methods) error {
 			overfloodedLock.Unlock()
 		}
 
-		msg := <-c.out
-		if msg == protocol.CloseMessage {
+		p := <-c.out
+		if p.text == protocol.CloseMessage {
 			return nil
 		}
 
-		err := c.conn.WriteMessage(msg)
+		err := c.conn.WriteMessage(p.text)
 		if err != nil {
 			return closeChannel(c, m, err)
 		}
+		for _, attachment := range p.attachments {
+			err := c.conn.WriteBinary(c.codec.EncodeAttachment(attachment))
+			if err != nil {
+				return closeChannel(c, m, err)
+			}
+		}
 	}
-	return nil
 }
 
 /**
-Pinger sends ping messages for keeping connection alive
+Pinger sends ping messages for keeping connection alive. Since Engine.IO v4
+the server pings, and closes the connection if the pong is overdue.
 */
-func pinger(c *Channel) {
+func pinger(c *Channel, m *methods) {
 	for {
-		interval, _ := c.conn.PingParams()
+		interval, timeout := c.conn.PingParams()
 		time.Sleep(interval)
 		if !c.IsAlive() {
 			return
 		}
 
-		c.out <- protocol.PingMessage
+		if c.server != nil {
+			c.lastPongLock.Lock()
+			overdue := time.Since(c.lastPong) > interval+timeout
+			c.lastPongLock.Unlock()
+			if overdue {
+				closeChannel(c, m, ErrorPingTimeout)
+				return
+			}
+		}
+
+		c.out <- packet{text: protocol.PingMessage}
 	}
 }
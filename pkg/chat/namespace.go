@@ -0,0 +1,224 @@
+package chat
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/bhojpur/net/pkg/protocol"
+)
+
+var (
+	ErrorInvalidNamespace   = errors.New("Invalid namespace")
+	ErrorNamespaceConnected = errors.New("Already connected to namespace")
+)
+
+/**
+Middleware is called for every client connecting to a namespace, before the
+connection handler. Returning an error refuses the connection, the client
+receives the error message.
+*/
+type Middleware func(c *Channel) error
+
+/**
+socket.io namespace, the default one is "/"
+
+Every namespace has its own handlers, rooms and middleware. Clients connect to
+several namespaces over one connection, and get a channel for each of them.
+*/
+type Namespace struct {
+	methods
+
+	name string
+
+	channels     map[string]map[*Channel]struct{}
+	rooms        map[*Channel]map[string]struct{}
+	channelsLock sync.RWMutex
+
+	sids     map[string]*Channel
+	sidsLock sync.RWMutex
+
+	middleware     []Middleware
+	middlewareLock sync.RWMutex
+}
+
+/**
+Create namespace with given name
+*/
+func newNamespace(name string) *Namespace {
+	n := &Namespace{name: name}
+	n.initMethods()
+	n.channels = make(map[string]map[*Channel]struct{})
+	n.rooms = make(map[*Channel]map[string]struct{})
+	n.sids = make(map[string]*Channel)
+	n.onConnection = onConnectStore
+	n.onDisconnection = onDisconnectCleanup
+
+	return n
+}
+
+/**
+Get name of the namespace
+*/
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+/**
+Add middleware, which is called for every client connecting to the namespace
+*/
+func (n *Namespace) Use(f Middleware) {
+	n.middlewareLock.Lock()
+	defer n.middlewareLock.Unlock()
+
+	n.middleware = append(n.middleware, f)
+}
+
+/**
+Call middleware in the order it was added, stops on the first error
+*/
+func (n *Namespace) callMiddleware(c *Channel) error {
+	n.middlewareLock.RLock()
+	defer n.middlewareLock.RUnlock()
+
+	for _, f := range n.middleware {
+		if err := f(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+Get namespace with given name, creating it on first use
+*/
+func (s *Server) Of(name string) *Namespace {
+	name = normalizeNamespace(name)
+
+	s.namespacesLock.Lock()
+	defer s.namespacesLock.Unlock()
+
+	n, ok := s.namespaces[name]
+	if !ok {
+		n = newNamespace(name)
+		s.namespaces[name] = n
+	}
+	return n
+}
+
+/**
+Find namespace with given name, clients can't connect to namespaces
+which weren't created by Of
+*/
+func (s *Server) findNamespace(name string) (*Namespace, bool) {
+	s.namespacesLock.RLock()
+	defer s.namespacesLock.RUnlock()
+
+	n, ok := s.namespaces[name]
+	return n, ok
+}
+
+/**
+Connect client to given namespace, on CONNECT packet or right after the
+handshake for the default namespace of Engine.IO v3 clients
+*/
+func (s *Server) connect(c *Channel, name, auth string) {
+	name = normalizeNamespace(name)
+	if c.socket(name) != nil {
+		return
+	}
+
+	n, ok := s.findNamespace(name)
+	if !ok {
+		s.refuseConnect(c, name, ErrorInvalidNamespace)
+		return
+	}
+
+	socket := c
+	if name != c.namespace {
+		socket = &Channel{}
+		socket.initSocket(c, name, &n.methods)
+		socket.header = c.header
+		socket.header.Sid = name + "#" + c.Id()
+	}
+	socket.nsp = n
+	socket.auth = auth
+
+	if err := n.callMiddleware(socket); err != nil {
+		s.refuseConnect(c, name, err)
+		return
+	}
+	if !c.addSocket(socket) {
+		return
+	}
+
+	msg := &protocol.Message{
+		Type:      protocol.MessageTypeEmpty,
+		Namespace: name,
+	}
+	if c.codec.ClientConnects() {
+		jsonSid, err := json.Marshal(&struct {
+			Sid string `json:"sid"`
+		}{socket.Id()})
+		if err != nil {
+			panic(err)
+		}
+		msg.Args = string(jsonSid)
+	}
+	c.out <- packet{text: c.codec.MustEncode(msg)}
+
+	n.callLoopEvent(socket, OnConnection)
+}
+
+/**
+Send CONNECT_ERROR packet, since v4 the error is an object with a message
+*/
+func (s *Server) refuseConnect(c *Channel, name string, reason error) {
+	var data interface{} = reason.Error()
+	if c.codec.ClientConnects() {
+		data = &struct {
+			Message string `json:"message"`
+		}{reason.Error()}
+	}
+	jsonErr, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+
+	c.out <- packet{text: c.codec.MustEncode(&protocol.Message{
+		Type:      protocol.MessageTypeError,
+		Namespace: name,
+		Args:      string(jsonErr),
+	})}
+}
+
+/**
+Namespaces always start with a slash, the default one is "/"
+*/
+func normalizeNamespace(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		return "/" + name
+	}
+	return name
+}
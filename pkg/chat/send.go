@@ -21,31 +21,62 @@ package chat
 // THE SOFTWARE.
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
 	"time"
 
 	"github.com/bhojpur/net/pkg/protocol"
+	log "github.com/sirupsen/logrus"
 )
 
 var (
 	ErrorSendTimeout     = errors.New("Timeout")
 	ErrorSocketOverflood = errors.New("Socket overflood")
+	ErrorDisconnected    = errors.New("Disconnected")
 )
 
+/**
+Error the other side answered an ack with. Acks with several arguments follow
+the node.js callback convention, where a first argument other than null is an error.
+*/
+type RemoteError struct {
+	/**
+	The error as raw json
+	*/
+	Payload string
+}
+
+func (e *RemoteError) Error() string {
+	var message string
+	if err := json.Unmarshal([]byte(e.Payload), &message); err == nil {
+		return "remote error: " + message
+	}
+
+	var obj struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(e.Payload), &obj); err == nil && obj.Message != "" {
+		return "remote error: " + obj.Message
+	}
+	return "remote error: " + e.Payload
+}
+
 /**
 Send message packet to socket
 */
-func send(msg *protocol.Message, c *Channel, args interface{}) error {
+func send(msg *protocol.Message, c *Channel, args interface{}) (err error) {
 	//preventing json/encoding "index out of range" panic
 	defer func() {
 		if r := recover(); r != nil {
-			log.Println("socket.io send panic: ", r)
+			log.WithField("method", msg.Method).WithField("panic", r).Error("socket.io send panic")
+			err = fmt.Errorf("socket.io send panic: %v", r)
 		}
 	}()
 
 	if args != nil {
+		args, msg.Attachments = extractAttachments(args)
 		json, err := json.Marshal(&args)
 		if err != nil {
 			return err
@@ -54,7 +85,8 @@ func send(msg *protocol.Message, c *Channel, args interface{}) error {
 		msg.Args = string(json)
 	}
 
-	command, err := protocol.Encode(msg)
+	msg.Namespace = c.namespace
+	command, err := c.codec.Encode(msg)
 	if err != nil {
 		return err
 	}
@@ -63,7 +95,7 @@ func send(msg *protocol.Message, c *Channel, args interface{}) error {
 		return ErrorSocketOverflood
 	}
 
-	c.out <- command
+	c.out <- packet{text: command, attachments: msg.Attachments}
 
 	return nil
 }
@@ -84,25 +116,117 @@ func (c *Channel) Emit(method string, args interface{}) error {
 Create ack packet based on given data and send it and receive response
 */
 func (c *Channel) Ack(method string, args interface{}, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := c.waitAck(ctx, method, args)
+	if err != nil {
+		return "", err
+	}
+
+	//the result is json text, so attachments become base64 strings in it
+	if len(result.Attachments) > 0 {
+		return protocol.ReplacePlaceholders(result.Args, result.Attachments)
+	}
+	return result.Args, nil
+}
+
+/**
+Create ack packet based on given data, send it and decode the response into out,
+unless out is nil. Waiting stops when ctx is done, ErrorSendTimeout is returned
+if its deadline passed. ErrorDisconnected is returned if the channel was closed,
+and a *RemoteError if the other side answered with an error.
+*/
+func (c *Channel) AckContext(ctx context.Context, method string, args interface{}, out interface{}) error {
+	result, err := c.waitAck(ctx, method, args)
+	if err != nil {
+		return err
+	}
+	if len(result.Attachments) > 0 {
+		return decodeBinaryResult(result, out)
+	}
+
+	var values []json.RawMessage
+	if err := json.Unmarshal([]byte("["+result.Args+"]"), &values); err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	value := values[0]
+	if len(values) > 1 {
+		if string(value) != "null" {
+			return &RemoteError{Payload: string(value)}
+		}
+		value = values[1]
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(value, out)
+}
+
+/**
+Same as the end of AckContext, for results with binary attachments, which are
+put straight into the []byte values of out
+*/
+func decodeBinaryResult(result *protocol.Message, out interface{}) error {
+	values, err := protocol.DecodeArgs(result.Args, result.Attachments)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	value := values[0]
+	if len(values) > 1 {
+		if value != nil {
+			payload, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			return &RemoteError{Payload: string(payload)}
+		}
+		value = values[1]
+	}
+
+	if out == nil {
+		return nil
+	}
+	return decodeValue(value, out)
+}
+
+func (c *Channel) waitAck(ctx context.Context, method string, args interface{}) (*protocol.Message, error) {
+	if !c.IsAlive() {
+		return nil, ErrorDisconnected
+	}
+
 	msg := &protocol.Message{
 		Type:   protocol.MessageTypeAckRequest,
 		AckId:  c.ack.getNextId(),
 		Method: method,
 	}
 
-	waiter := make(chan string)
+	//buffered, so the response never blocks if we stopped waiting
+	waiter := make(chan *protocol.Message, 1)
 	c.ack.addWaiter(msg.AckId, waiter)
+	defer c.ack.removeWaiter(msg.AckId)
 
 	err := send(msg, c, args)
 	if err != nil {
-		c.ack.removeWaiter(msg.AckId)
+		return nil, err
 	}
 
 	select {
 	case result := <-waiter:
 		return result, nil
-	case <-time.After(timeout):
-		c.ack.removeWaiter(msg.AckId)
-		return "", ErrorSendTimeout
+	case <-c.done:
+		return nil, ErrorDisconnected
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrorSendTimeout
+		}
+		return nil, ctx.Err()
 	}
 }
@@ -38,6 +38,11 @@ import (
 
 const (
 	HeaderForward = "X-Forwarded-For"
+
+	/**
+	Largest packet Engine.IO v4 clients may send, as advertised in the handshake
+	*/
+	MaxPayload = 1000000
 )
 
 var (
@@ -49,15 +54,11 @@ var (
 socket.io server instance
 */
 type Server struct {
-	methods
+	*Namespace
 	http.Handler
 
-	channels     map[string]map[*Channel]struct{}
-	rooms        map[*Channel]map[string]struct{}
-	channelsLock sync.RWMutex
-
-	sids     map[string]*Channel
-	sidsLock sync.RWMutex
+	namespaces     map[string]*Namespace
+	namespacesLock sync.RWMutex
 
 	tr transport.Transport
 }
@@ -66,6 +67,10 @@ type Server struct {
 Close current channel
 */
 func (c *Channel) Close() {
+	if c.engine != nil {
+		closeSocket(c, true)
+		return
+	}
 	if c.server != nil {
 		closeChannel(c, &c.server.methods)
 	}
@@ -92,11 +97,11 @@ func (c *Channel) RequestHeader() http.Header {
 /**
 Get channel by it's sid
 */
-func (s *Server) GetChannel(sid string) (*Channel, error) {
-	s.sidsLock.RLock()
-	defer s.sidsLock.RUnlock()
+func (n *Namespace) GetChannel(sid string) (*Channel, error) {
+	n.sidsLock.RLock()
+	defer n.sidsLock.RUnlock()
 
-	c, ok := s.sids[sid]
+	c, ok := n.sids[sid]
 	if !ok {
 		return nil, ErrorConnectionNotFound
 	}
@@ -108,19 +113,19 @@ func (s *Server) GetChannel(sid string) (*Channel, error) {
 Join this channel to given room
 */
 func (c *Channel) Join(room string) error {
-	if c.server == nil {
+	if c.nsp == nil {
 		return ErrorServerNotSet
 	}
 
-	c.server.channelsLock.Lock()
-	defer c.server.channelsLock.Unlock()
+	c.nsp.channelsLock.Lock()
+	defer c.nsp.channelsLock.Unlock()
 
-	cn := c.server.channels
+	cn := c.nsp.channels
 	if _, ok := cn[room]; !ok {
 		cn[room] = make(map[*Channel]struct{})
 	}
 
-	byRoom := c.server.rooms
+	byRoom := c.nsp.rooms
 	if _, ok := byRoom[c]; !ok {
 		byRoom[c] = make(map[string]struct{})
 	}
@@ -135,14 +140,14 @@ func (c *Channel) Join(room string) error {
 Remove this channel from given room
 */
 func (c *Channel) Leave(room string) error {
-	if c.server == nil {
+	if c.nsp == nil {
 		return ErrorServerNotSet
 	}
 
-	c.server.channelsLock.Lock()
-	defer c.server.channelsLock.Unlock()
+	c.nsp.channelsLock.Lock()
+	defer c.nsp.channelsLock.Unlock()
 
-	cn := c.server.channels
+	cn := c.nsp.channels
 	if _, ok := cn[room]; ok {
 		delete(cn[room], c)
 		if len(cn[room]) == 0 {
@@ -150,7 +155,7 @@ func (c *Channel) Leave(room string) error {
 		}
 	}
 
-	byRoom := c.server.rooms
+	byRoom := c.nsp.rooms
 	if _, ok := byRoom[c]; ok {
 		delete(byRoom[c], room)
 	}
@@ -162,21 +167,21 @@ func (c *Channel) Leave(room string) error {
 Get amount of channels, joined to given room, using channel
 */
 func (c *Channel) Amount(room string) int {
-	if c.server == nil {
+	if c.nsp == nil {
 		return 0
 	}
 
-	return c.server.Amount(room)
+	return c.nsp.Amount(room)
 }
 
 /**
-Get amount of channels, joined to given room, using server
+Get amount of channels, joined to given room, using namespace
 */
-func (s *Server) Amount(room string) int {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+func (n *Namespace) Amount(room string) int {
+	n.channelsLock.RLock()
+	defer n.channelsLock.RUnlock()
 
-	roomChannels, _ := s.channels[room]
+	roomChannels, _ := n.channels[room]
 	return len(roomChannels)
 }
 
@@ -184,21 +189,21 @@ func (s *Server) Amount(room string) int {
 Get list of channels, joined to given room, using channel
 */
 func (c *Channel) List(room string) []*Channel {
-	if c.server == nil {
+	if c.nsp == nil {
 		return []*Channel{}
 	}
 
-	return c.server.List(room)
+	return c.nsp.List(room)
 }
 
 /**
-Get list of channels, joined to given room, using server
+Get list of channels, joined to given room, using namespace
 */
-func (s *Server) List(room string) []*Channel {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+func (n *Namespace) List(room string) []*Channel {
+	n.channelsLock.RLock()
+	defer n.channelsLock.RUnlock()
 
-	roomChannels, ok := s.channels[room]
+	roomChannels, ok := n.channels[room]
 	if !ok {
 		return []*Channel{}
 	}
@@ -215,20 +220,20 @@ func (s *Server) List(room string) []*Channel {
 }
 
 func (c *Channel) BroadcastTo(room, method string, args interface{}) {
-	if c.server == nil {
+	if c.nsp == nil {
 		return
 	}
-	c.server.BroadcastTo(room, method, args)
+	c.nsp.BroadcastTo(room, method, args)
 }
 
 /**
 Broadcast message to all room channels
 */
-func (s *Server) BroadcastTo(room, method string, args interface{}) {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+func (n *Namespace) BroadcastTo(room, method string, args interface{}) {
+	n.channelsLock.RLock()
+	defer n.channelsLock.RUnlock()
 
-	roomChannels, ok := s.channels[room]
+	roomChannels, ok := n.channels[room]
 	if !ok {
 		return
 	}
@@ -241,13 +246,13 @@ func (s *Server) BroadcastTo(room, method string, args interface{}) {
 }
 
 /**
-Broadcast to all clients
+Broadcast to all clients of the namespace
 */
-func (s *Server) BroadcastToAll(method string, args interface{}) {
-	s.sidsLock.RLock()
-	defer s.sidsLock.RUnlock()
+func (n *Namespace) BroadcastToAll(method string, args interface{}) {
+	n.sidsLock.RLock()
+	defer n.sidsLock.RUnlock()
 
-	for _, cn := range s.sids {
+	for _, cn := range n.sids {
 		if cn.IsAlive() {
 			go cn.Emit(method, args)
 		}
@@ -258,7 +263,7 @@ func (s *Server) BroadcastToAll(method string, args interface{}) {
 Generate new id for socket.io connection
 */
 func generateNewId(custom string) string {
-	hash := fmt.Sprintf("%s %s %n %n", custom, time.Now(), rand.Uint32(), rand.Uint32())
+	hash := fmt.Sprintf("%s %s %d %d", custom, time.Now(), rand.Uint32(), rand.Uint32())
 	buf := bytes.NewBuffer(nil)
 	sum := md5.Sum([]byte(hash))
 	encoder := base64.NewEncoder(base64.URLEncoding, buf)
@@ -271,21 +276,21 @@ func generateNewId(custom string) string {
 On connection system handler, store sid
 */
 func onConnectStore(c *Channel) {
-	c.server.sidsLock.Lock()
-	defer c.server.sidsLock.Unlock()
+	c.nsp.sidsLock.Lock()
+	defer c.nsp.sidsLock.Unlock()
 
-	c.server.sids[c.Id()] = c
+	c.nsp.sids[c.Id()] = c
 }
 
 /**
 On disconnection system handler, clean joins and sid
 */
 func onDisconnectCleanup(c *Channel) {
-	c.server.channelsLock.Lock()
-	defer c.server.channelsLock.Unlock()
+	c.nsp.channelsLock.Lock()
+	defer c.nsp.channelsLock.Unlock()
 
-	cn := c.server.channels
-	byRoom, ok := c.server.rooms[c]
+	cn := c.nsp.channels
+	byRoom, ok := c.nsp.rooms[c]
 	if ok {
 		for room := range byRoom {
 			if curRoom, ok := cn[room]; ok {
@@ -296,13 +301,13 @@ func onDisconnectCleanup(c *Channel) {
 			}
 		}
 
-		delete(c.server.rooms, c)
+		delete(c.nsp.rooms, c)
 	}
 
-	c.server.sidsLock.Lock()
-	defer c.server.sidsLock.Unlock()
+	c.nsp.sidsLock.Lock()
+	defer c.nsp.sidsLock.Unlock()
 
-	delete(c.server.sids, c.Id())
+	delete(c.nsp.sids, c.Id())
 }
 
 func (s *Server) SendOpenSequence(c *Channel) {
@@ -311,14 +316,12 @@ func (s *Server) SendOpenSequence(c *Channel) {
 		panic(err)
 	}
 
-	c.out <- protocol.MustEncode(
+	c.out <- packet{text: c.codec.MustEncode(
 		&protocol.Message{
 			Type: protocol.MessageTypeOpen,
 			Args: string(jsonHdr),
 		},
-	)
-
-	c.out <- protocol.MustEncode(&protocol.Message{Type: protocol.MessageTypeEmpty})
+	)}
 }
 
 /**
@@ -326,6 +329,11 @@ Setup event loop for given connection
 */
 func (s *Server) SetupEventLoop(conn transport.Connection, remoteAddr string,
 	requestHeader http.Header) {
+	s.setupEventLoop(conn, remoteAddr, requestHeader, protocol.CodecV3)
+}
+
+func (s *Server) setupEventLoop(conn transport.Connection, remoteAddr string,
+	requestHeader http.Header, codec *protocol.Codec) {
 
 	interval, timeout := conn.PingParams()
 	hdr := Header{
@@ -334,55 +342,98 @@ func (s *Server) SetupEventLoop(conn transport.Connection, remoteAddr string,
 		PingInterval: int(interval / time.Millisecond),
 		PingTimeout:  int(timeout / time.Millisecond),
 	}
+	if codec.Version >= protocol.Version4 {
+		hdr.MaxPayload = MaxPayload
+	}
+	if sc, ok := conn.(transport.SessionConnection); ok {
+		hdr.Sid = sc.Sid()
+		hdr.Upgrades = sc.Upgrades()
+	}
 
 	c := &Channel{}
 	c.conn = conn
+	c.codec = codec
 	c.ip = remoteAddr
 	c.requestHeader = requestHeader
 	c.initChannel()
 
 	c.server = s
 	c.header = hdr
+	c.handlers = &s.methods
+	c.nsp = s.Namespace
 
 	s.SendOpenSequence(c)
 
 	go inLoop(c, &s.methods)
 	go outLoop(c, &s.methods)
+	if codec.ServerPings() {
+		go pinger(c, &s.methods)
+	}
 
-	s.callLoopEvent(c, OnConnection)
+	//since v4 the client connects to the default namespace itself
+	if !codec.ClientConnects() {
+		s.connect(c, "/", "")
+	}
 }
 
 /**
 implements ServeHTTP function from http.Handler
 */
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	codec, err := protocol.CodecByQuery(r.URL.Query().Get("EIO"))
+	if err != nil {
+		writeHandshakeError(w, errorCodeBadRequest, err.Error())
+		return
+	}
+
 	conn, err := s.tr.HandleConnection(w, r)
 	if err != nil {
 		return
 	}
 
-	s.SetupEventLoop(conn, r.RemoteAddr, r.Header)
+	if conn != nil {
+		s.setupEventLoop(conn, r.RemoteAddr, r.Header, codec)
+	}
 	s.tr.Serve(w, r)
 }
 
+/**
+Engine.IO error codes sent to clients which fail the handshake
+*/
+const (
+	errorCodeBadRequest = 3
+)
+
+/**
+Write handshake error in the format Engine.IO clients expect
+*/
+func writeHandshakeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(&struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{code, message})
+}
+
 /**
 Get amount of current connected sids
 */
-func (s *Server) AmountOfSids() int64 {
-	s.sidsLock.RLock()
-	defer s.sidsLock.RUnlock()
+func (n *Namespace) AmountOfSids() int64 {
+	n.sidsLock.RLock()
+	defer n.sidsLock.RUnlock()
 
-	return int64(len(s.sids))
+	return int64(len(n.sids))
 }
 
 /**
 Get amount of rooms with at least one channel(or sid) joined
 */
-func (s *Server) AmountOfRooms() int64 {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+func (n *Namespace) AmountOfRooms() int64 {
+	n.channelsLock.RLock()
+	defer n.channelsLock.RUnlock()
 
-	return int64(len(s.channels))
+	return int64(len(n.channels))
 }
 
 /**
@@ -390,13 +441,9 @@ Create new socket.io server
 */
 func NewServer(tr transport.Transport) *Server {
 	s := Server{}
-	s.initMethods()
 	s.tr = tr
-	s.channels = make(map[string]map[*Channel]struct{})
-	s.rooms = make(map[*Channel]map[string]struct{})
-	s.sids = make(map[string]*Channel)
-	s.onConnection = onConnectStore
-	s.onDisconnection = onDisconnectCleanup
+	s.namespaces = make(map[string]*Namespace)
+	s.Namespace = s.Of("/")
 
 	return &s
 }
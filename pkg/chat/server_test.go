@@ -0,0 +1,583 @@
+package chat
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/net/pkg/protocol"
+	"github.com/bhojpur/net/pkg/transport"
+	"github.com/gorilla/websocket"
+)
+
+func startTestServer(t *testing.T) (*Server, string) {
+	tr := transport.GetDefaultWebsocketTransport()
+	tr.PingInterval = 50 * time.Millisecond
+	tr.PingTimeout = time.Second
+	return startServer(t, tr)
+}
+
+func startServer(t *testing.T, tr transport.Transport) (*Server, string) {
+	server := NewServer(tr)
+	server.On("echo", func(c *Channel, msg string) string {
+		return msg
+	})
+
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	return server, "ws" + strings.TrimPrefix(srv.URL, "http") + "/socket.io/?transport=websocket"
+}
+
+func TestServerEIO4(t *testing.T) {
+	server, url := startTestServer(t)
+	auths := make(chan string, 1)
+	server.On(OnConnection, func(c *Channel) {
+		auths <- c.Auth()
+	})
+
+	ws, _, err := websocket.DefaultDialer.Dial(url+"&EIO=4", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	read := func() string {
+		t.Helper()
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, p, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(p)
+	}
+	write := func(packet string) {
+		t.Helper()
+		err := ws.WriteMessage(websocket.TextMessage, []byte(packet))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	open := read()
+	var hdr Header
+	if !strings.HasPrefix(open, "0") || json.Unmarshal([]byte(open[1:]), &hdr) != nil {
+		t.Fatalf("expected open packet, got %q", open)
+	}
+	if hdr.MaxPayload != MaxPayload {
+		t.Errorf("expected maxPayload in handshake, got %+v", hdr)
+	}
+
+	write(`40{"token":"secret"}`)
+	if connect := read(); connect != `40{"sid":"`+hdr.Sid+`"}` {
+		t.Errorf("unexpected CONNECT response %q", connect)
+	}
+	select {
+	case auth := <-auths:
+		if auth != `{"token":"secret"}` {
+			t.Errorf("unexpected auth payload %q", auth)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection handler was not called")
+	}
+
+	// the server pings, the client answers
+	if ping := read(); ping != protocol.PingMessage {
+		t.Fatalf("expected ping, got %q", ping)
+	}
+	write(protocol.PongMessage)
+
+	write(`421["echo","hello"]`)
+	for {
+		packet := read()
+		if packet == protocol.PingMessage {
+			write(protocol.PongMessage)
+			continue
+		}
+		if packet != `431["hello"]` {
+			t.Errorf("unexpected ack %q", packet)
+		}
+		break
+	}
+}
+
+func TestServerUnsupportedVersion(t *testing.T) {
+	_, url := startTestServer(t)
+	_, resp, err := websocket.DefaultDialer.Dial(url+"&EIO=5", nil)
+	if err == nil {
+		t.Fatal("expected handshake to fail")
+	}
+	if resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %v", resp)
+	}
+}
+
+func TestDial(t *testing.T) {
+	_, url := startTestServer(t)
+
+	for _, version := range []int{protocol.Version3, protocol.Version4} {
+		var opts []DialOption
+		if version == protocol.Version4 {
+			opts = append(opts, WithProtocolVersion(version), WithAuth(map[string]string{"token": "secret"}))
+		}
+		client, err := Dial(url, transport.GetDefaultWebsocketTransport(), opts...)
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		connected := make(chan struct{})
+		client.On(OnConnection, func(c *Channel) {
+			close(connected)
+		})
+
+		select {
+		case <-connected:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("v%d: client did not connect", version)
+		}
+		res, err := client.Ack("echo", "hello", 5*time.Second)
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		if res != `"hello"` {
+			t.Errorf("v%d: unexpected ack result %s", version, res)
+		}
+		if client.ProtocolVersion() != version {
+			t.Errorf("v%d: client speaks v%d", version, client.ProtocolVersion())
+		}
+		client.Close()
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	server, url := startTestServer(t)
+	admin := server.Of("/admin")
+	admin.On(OnConnection, func(c *Channel) {
+		c.Join("dashboard")
+	})
+	admin.On("whoami", func(c *Channel) string {
+		return c.Namespace() + " " + c.Id()
+	})
+	admin.Use(func(c *Channel) error {
+		if c.ProtocolVersion() == protocol.Version4 && c.Auth() != `{"token":"secret"}` {
+			return errors.New("not authorized")
+		}
+		return nil
+	})
+
+	for _, version := range []int{protocol.Version3, protocol.Version4} {
+		client, err := Dial(url, transport.GetDefaultWebsocketTransport(), WithProtocolVersion(version))
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+
+		var auth interface{}
+		if version == protocol.Version4 {
+			auth = map[string]string{"token": "secret"}
+		}
+		adminClient, err := client.Of("admin", auth)
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		res, err := adminClient.Ack("whoami", nil, 5*time.Second)
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		if !strings.HasPrefix(res, `"/admin /admin#`) {
+			t.Errorf("v%d: unexpected ack result %s", version, res)
+		}
+		// handlers and rooms are per namespace
+		if _, err := client.Ack("whoami", nil, 100*time.Millisecond); err != ErrorSendTimeout {
+			t.Errorf("v%d: default namespace answered whoami: %v", version, err)
+		}
+		if res, err := adminClient.Ack("echo", "hello", 100*time.Millisecond); err != ErrorSendTimeout {
+			t.Errorf("v%d: admin namespace answered echo: %s %v", version, res, err)
+		}
+		if admin.Amount("dashboard") != 1 || server.Amount("dashboard") != 0 {
+			t.Errorf("v%d: unexpected rooms, admin %d, default %d", version, admin.Amount("dashboard"), server.Amount("dashboard"))
+		}
+
+		// leaving a namespace keeps the connection
+		adminClient.Close()
+		res, err = client.Ack("echo", "hello", 5*time.Second)
+		if err != nil || res != `"hello"` {
+			t.Errorf("v%d: default namespace broke: %s %v", version, res, err)
+		}
+		waitFor(t, func() bool { return admin.Amount("dashboard") == 0 })
+
+		if version == protocol.Version4 {
+			refused, err := client.Of("/admin", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, func() bool { return !refused.IsAlive() })
+
+			invalid, err := client.Of("/unknown", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, func() bool { return !invalid.IsAlive() })
+			if !client.IsAlive() {
+				t.Error("refused namespace closed the connection")
+			}
+		}
+		client.Close()
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("condition not met in time")
+}
+
+func TestBinary(t *testing.T) {
+	type file struct {
+		Name string `json:"name"`
+		Data []byte `json:"data"`
+	}
+	server, url := startTestServer(t)
+	server.On("upload", func(c *Channel, f file) file {
+		return file{Name: f.Name + ".bak", Data: append(f.Data, '!')}
+	})
+	server.On("echo", func(c *Channel, v interface{}) interface{} {
+		return v
+	})
+	server.On("data", func(c *Channel, m map[string]interface{}) interface{} {
+		return m["data"]
+	})
+
+	t.Run("wire", func(t *testing.T) {
+		ws, _, err := websocket.DefaultDialer.Dial(url+"&EIO=4", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		ws.ReadMessage()
+		ws.WriteMessage(websocket.TextMessage, []byte("40"))
+		ws.ReadMessage()
+		ws.WriteMessage(websocket.TextMessage, []byte(`451-1["upload",{"name":"a","data":{"_placeholder":true,"num":0}}]`))
+		ws.WriteMessage(websocket.BinaryMessage, []byte{0, 1})
+
+		var frames []string
+		for len(frames) < 2 {
+			msgType, p, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msgType == websocket.TextMessage && string(p) == protocol.PingMessage {
+				ws.WriteMessage(websocket.TextMessage, []byte(protocol.PongMessage))
+				continue
+			}
+			frames = append(frames, string(p))
+		}
+		if frames[0] != `461-1[{"data":{"_placeholder":true,"num":0},"name":"a.bak"}]` {
+			t.Errorf("unexpected binary ack %q", frames[0])
+		}
+		if frames[1] != "\x00\x01!" {
+			t.Errorf("unexpected attachment %q", frames[1])
+		}
+	})
+
+	for _, version := range []int{protocol.Version3, protocol.Version4} {
+		client, err := Dial(url, transport.GetDefaultWebsocketTransport(), WithProtocolVersion(version))
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		res, err := client.Ack("upload", file{Name: "b", Data: []byte("data")}, 5*time.Second)
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		var f file
+		if err := json.Unmarshal([]byte(res), &f); err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		if f.Name != "b.bak" || string(f.Data) != "data!" {
+			t.Errorf("v%d: unexpected result %+v", version, f)
+		}
+		client.Close()
+	}
+
+	t.Run("decoded", func(t *testing.T) {
+		client, err := Dial(url, transport.GetDefaultWebsocketTransport())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		//attachments must reach interface{} values as []byte, not as base64 strings
+		var v interface{}
+		if err := client.AckContext(ctx, "echo", []interface{}{"a", []byte("data"), 1}, &v); err != nil {
+			t.Fatal(err)
+		}
+		if expected := []interface{}{"a", []byte("data"), float64(1)}; !reflect.DeepEqual(v, expected) {
+			t.Errorf("unexpected echo: expected %#v, got %#v", expected, v)
+		}
+
+		var data []byte
+		if err := client.AckContext(ctx, "data", file{Name: "c", Data: []byte("data")}, &data); err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "data" {
+			t.Errorf("unexpected data %q", data)
+		}
+
+		var f *file
+		if err := client.AckContext(ctx, "upload", file{Name: "d", Data: []byte("data")}, &f); err != nil {
+			t.Fatal(err)
+		}
+		if f == nil || f.Name != "d.bak" || string(f.Data) != "data!" {
+			t.Errorf("unexpected result %+v", f)
+		}
+
+		var name string
+		if err := client.AckContext(ctx, "upload", file{Name: "e", Data: []byte("data")}, &name); err == nil {
+			t.Errorf("expected an error decoding a binary result into a string, got %q", name)
+		}
+	})
+}
+
+func TestPolling(t *testing.T) {
+	tr := transport.GetDefaultPollingTransport()
+	tr.PingInterval = 50 * time.Millisecond
+	tr.PingTimeout = time.Second
+	tr.Websocket.PingInterval = tr.PingInterval
+	tr.Websocket.PingTimeout = tr.PingTimeout
+	server, url := startServer(t, tr)
+	server.On("upload", func(c *Channel, data []byte) int {
+		return len(data)
+	})
+
+	for _, version := range []int{protocol.Version3, protocol.Version4} {
+		client, err := Dial(url, transport.GetDefaultPollingTransport(), WithProtocolVersion(version))
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		res, err := client.Ack("echo", "hellö", 5*time.Second)
+		if err != nil || res != `"hellö"` {
+			t.Fatalf("v%d: unexpected ack result %s %v", version, res, err)
+		}
+		res, err = client.Ack("upload", []byte{1, 2, 3}, 5*time.Second)
+		if err != nil || res != "3" {
+			t.Fatalf("v%d: unexpected ack result %s %v", version, res, err)
+		}
+		// the server pings, or is pinged, while polling
+		time.Sleep(200 * time.Millisecond)
+		if !client.IsAlive() {
+			t.Fatalf("v%d: polling connection died", version)
+		}
+		client.Close()
+	}
+
+	t.Run("upgrade", func(t *testing.T) {
+		base := strings.TrimSuffix(url, "transport=websocket") + "EIO=4"
+		httpBase := "http" + strings.TrimPrefix(base, "ws")
+		resp, err := http.Get(httpBase + "&transport=polling")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		var hdr Header
+		if !strings.HasPrefix(string(body), "0") || json.Unmarshal(body[1:], &hdr) != nil {
+			t.Fatalf("expected open packet, got %q", body)
+		}
+		if len(hdr.Upgrades) != 1 || hdr.Upgrades[0] != "websocket" {
+			t.Errorf("expected websocket upgrade, got %v", hdr.Upgrades)
+		}
+
+		query := "&sid=" + hdr.Sid
+		resp, err = http.Post(httpBase+query+"&transport=polling", "text/plain", strings.NewReader("40\x1e421[\"echo\",\"polled\"]"))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("cannot post: %v %v", resp, err)
+		}
+		resp.Body.Close()
+
+		ws, _, err := websocket.DefaultDialer.Dial(base+query+"&transport=websocket", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		ws.WriteMessage(websocket.TextMessage, []byte("2probe"))
+		if _, p, err := ws.ReadMessage(); err != nil || string(p) != "3probe" {
+			t.Fatalf("expected probe response, got %q %v", p, err)
+		}
+
+		// the pending poll ends with a noop
+		var polled []string
+		for {
+			resp, err := http.Get(httpBase + query + "&transport=polling")
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			polled = append(polled, strings.Split(string(body), "\x1e")...)
+			if polled[len(polled)-1] == "6" {
+				break
+			}
+		}
+		ws.WriteMessage(websocket.TextMessage, []byte("5"))
+
+		// the ack is polled or sent through websocket, depending on timing
+		acked := false
+		for _, packet := range polled {
+			acked = acked || packet == `431["polled"]`
+		}
+		ws.WriteMessage(websocket.TextMessage, []byte(`422["echo","upgraded"]`))
+		for {
+			_, p, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch string(p) {
+			case protocol.PingMessage:
+				ws.WriteMessage(websocket.TextMessage, []byte(protocol.PongMessage))
+			case `431["polled"]`:
+				acked = true
+			case `432["upgraded"]`:
+				if !acked {
+					t.Error("ack of the polled event got lost")
+				}
+				return
+			}
+		}
+	})
+}
+
+func TestAckContext(t *testing.T) {
+	server, url := startTestServer(t)
+	server.On("point", func(c *Channel, p map[string]int) map[string]int {
+		return map[string]int{"x": p["y"], "y": p["x"]}
+	})
+	server.On("hang", func(c *Channel, msg string) string {
+		time.Sleep(200 * time.Millisecond)
+		return msg
+	})
+
+	client, err := Dial(url, transport.GetDefaultWebsocketTransport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var p struct{ X, Y int }
+	err = client.AckContext(context.Background(), "point", map[string]int{"x": 1, "y": 2}, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.X != 2 || p.Y != 1 {
+		t.Errorf("unexpected result %+v", p)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.AckContext(ctx, "echo", "hello", nil); err != context.Canceled {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.AckContext(ctx, "unknown", "hello", nil); err != ErrorSendTimeout {
+		t.Errorf("expected timeout, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.Close()
+	}()
+	if err := client.AckContext(context.Background(), "hang", "hello", nil); err != ErrorDisconnected {
+		t.Errorf("expected disconnect, got %v", err)
+	}
+	if err := client.AckContext(context.Background(), "echo", "hello", nil); err != ErrorDisconnected {
+		t.Errorf("expected disconnect on closed client, got %v", err)
+	}
+}
+
+func TestAckContextRemoteError(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"test","upgrades":[],"pingInterval":25000,"pingTimeout":60000}`))
+		conn.WriteMessage(websocket.TextMessage, []byte("40"))
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msg := string(data)
+			if !strings.HasPrefix(msg, "42") {
+				continue
+			}
+			id := strings.TrimPrefix(msg[:strings.Index(msg, "[")], "42")
+			conn.WriteMessage(websocket.TextMessage, []byte("43"+id+`[{"message":"denied"},null]`))
+		}
+	}))
+	defer srv.Close()
+
+	client, err := Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/socket.io/?transport=websocket", transport.GetDefaultWebsocketTransport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = client.AckContext(ctx, "m", "hello", nil)
+	remote, ok := err.(*RemoteError)
+	if !ok {
+		t.Fatalf("expected remote error, got %v", err)
+	}
+	if remote.Payload != `{"message":"denied"}` || remote.Error() != "remote error: denied" {
+		t.Errorf("unexpected remote error %q: %v", remote.Payload, remote)
+	}
+}
+
+func TestSendPanic(t *testing.T) {
+	var c Channel
+	c.initChannel()
+	close(c.out)
+
+	if err := c.Emit("message", "hello"); err == nil {
+		t.Error("expected the panic of a send on a closed queue to be returned as error")
+	}
+}
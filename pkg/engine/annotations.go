@@ -0,0 +1,105 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// reservedAnnotationPrefix marks annotations set by the server itself, e.g. ReplayOfAnnotation
+const reservedAnnotationPrefix = "net/"
+
+// validateAnnotations checks the annotations a client gave an engine against the arguments of its spec,
+// which may be nil if the engine has no known spec. Annotations with the reserved prefix are always
+// rejected, so that clients cannot forge them. In strict mode annotations the spec does not declare
+// are rejected. All violations are reported as BadRequest details of an InvalidArgument error.
+func validateAnnotations(annotations []*v1.Annotation, args []*v1.DesiredAnnotation, strict bool) error {
+	var (
+		violations []*errdetails.BadRequest_FieldViolation
+		values     = make(map[string]string, len(annotations))
+		declared   = make(map[string]struct{}, len(args))
+	)
+	violate := func(key, desc string) {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "metadata.annotations." + key,
+			Description: desc,
+		})
+	}
+
+	for _, arg := range args {
+		declared[arg.Name] = struct{}{}
+	}
+	for _, a := range annotations {
+		if _, exists := values[a.Key]; exists {
+			violate(a.Key, "annotation is given more than once")
+			continue
+		}
+		values[a.Key] = a.Value
+
+		if strings.HasPrefix(a.Key, reservedAnnotationPrefix) {
+			violate(a.Key, "annotations prefixed with "+reservedAnnotationPrefix+" are reserved for the server")
+			continue
+		}
+		_, known := declared[a.Key]
+		if strict && !known {
+			violate(a.Key, "annotation is not an argument of the engine spec")
+		}
+	}
+	for _, arg := range args {
+		if !arg.Required || values[arg.Name] != "" {
+			continue
+		}
+		desc := "required annotation is missing"
+		if arg.Description != "" {
+			desc += ": " + arg.Description
+		}
+		violate(arg.Name, desc)
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return badRequest(fmt.Sprintf("engine has %d invalid annotation(s)", len(violations)), violations)
+}
+
+// unknownEngineSpec reports an engine spec name that none of the scanned repository checkouts declares
+func unknownEngineSpec(name string) error {
+	return badRequest(fmt.Sprintf("unknown engine spec %s", name), []*errdetails.BadRequest_FieldViolation{{
+		Field:       "metadata.engine_spec_name",
+		Description: "no engine spec of this name is known for the repository",
+	}})
+}
+
+// badRequest returns an InvalidArgument error carrying the violations as BadRequest details
+func badRequest(msg string, violations []*errdetails.BadRequest_FieldViolation) error {
+	st := status.New(codes.InvalidArgument, msg)
+	st, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot describe invalid request: %v", err)
+	}
+	return st.Err()
+}
@@ -0,0 +1,149 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateAnnotations(t *testing.T) {
+	args := []*v1.DesiredAnnotation{
+		{Name: "version", Required: true, Description: "version to deploy"},
+		{Name: "debug"},
+	}
+	tests := []struct {
+		Name        string
+		Annotations []*v1.Annotation
+		Strict      bool
+		Violations  []string
+	}{
+		{Name: "valid", Annotations: []*v1.Annotation{{Key: "version", Value: "1.0"}, {Key: "other", Value: "x"}}},
+		{Name: "missing", Annotations: []*v1.Annotation{{Key: "debug", Value: "true"}}, Violations: []string{"metadata.annotations.version"}},
+		{Name: "empty", Annotations: []*v1.Annotation{{Key: "version"}}, Violations: []string{"metadata.annotations.version"}},
+		{
+			Name:        "strict",
+			Annotations: []*v1.Annotation{{Key: "other", Value: "x"}, {Key: "debug", Value: "true"}},
+			Strict:      true,
+			Violations:  []string{"metadata.annotations.other", "metadata.annotations.version"},
+		},
+		{
+			Name:        "reserved",
+			Annotations: []*v1.Annotation{{Key: "version", Value: "1.0"}, {Key: ReplayOfAnnotation, Value: "net.1"}},
+			Violations:  []string{"metadata.annotations." + ReplayOfAnnotation},
+		},
+		{
+			Name:        "reserved strict",
+			Annotations: []*v1.Annotation{{Key: "version", Value: "1.0"}, {Key: "net/other", Value: "x"}},
+			Strict:      true,
+			Violations:  []string{"metadata.annotations.net/other"},
+		},
+		{
+			Name:        "duplicate",
+			Annotations: []*v1.Annotation{{Key: "version", Value: "1"}, {Key: "version", Value: "2"}},
+			Violations:  []string{"metadata.annotations.version"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := validateAnnotations(test.Annotations, args, test.Strict)
+			if len(test.Violations) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if act := fmt.Sprint(fieldViolations(t, err)); act != fmt.Sprint(test.Violations) {
+				t.Errorf("unexpected violations: expected %v, got %v", test.Violations, act)
+			}
+		})
+	}
+}
+
+func TestStartEngineValidatesAnnotations(t *testing.T) {
+	service, client := startTestService(t, nil)
+	service.EngineSpecs = &SpecScanner{specs: []*v1.ListEngineSpecsResponse{{
+		Repo:      &v1.Repository{Host: "github.com", Owner: "bhojpur", Repo: "net"},
+		Name:      "deploy",
+		Path:      "net/deploy.yaml",
+		Arguments: []*v1.DesiredAnnotation{{Name: "version", Required: true}},
+	}}}
+
+	req := &v1.StartEngineRequest{Metadata: &v1.EngineMetadata{
+		Repository:     &v1.Repository{Host: "github.com", Owner: "bhojpur", Repo: "net", Ref: "refs/heads/main"},
+		EngineSpecName: "deploy",
+	}}
+	_, err := client.StartEngine(context.Background(), req)
+	if act := fmt.Sprint(fieldViolations(t, err)); act != "[metadata.annotations.version]" {
+		t.Errorf("unexpected violations: %v", act)
+	}
+
+	req.Metadata.Annotations = []*v1.Annotation{{Key: "version", Value: "1.0"}}
+	_, err = client.StartEngine(context.Background(), req)
+	if err != nil {
+		t.Errorf("StartEngine: %v", err)
+	}
+
+	req.Metadata.Annotations = append(req.Metadata.Annotations, &v1.Annotation{Key: ReplayOfAnnotation, Value: "net.1"})
+	_, err = client.StartEngine(context.Background(), req)
+	if act := fmt.Sprint(fieldViolations(t, err)); act != "[metadata.annotations."+ReplayOfAnnotation+"]" {
+		t.Errorf("unexpected violations for reserved annotation: %v", act)
+	}
+
+	service.EngineSpecs = nil
+	req.Metadata.EngineSpecName = ""
+	req.EnginePath = "net/deploy.yaml"
+	_, err = client.StartEngine(context.Background(), req)
+	if act := fmt.Sprint(fieldViolations(t, err)); act != "[metadata.annotations."+ReplayOfAnnotation+"]" {
+		t.Errorf("unexpected violations for reserved annotation without spec: %v", act)
+	}
+
+	service.EngineSpecs = &SpecScanner{}
+	req.Metadata.Annotations = nil
+	req.Metadata.EngineSpecName = "deplyo"
+	_, err = client.StartEngine(context.Background(), req)
+	if act := fmt.Sprint(fieldViolations(t, err)); act != "[metadata.engine_spec_name]" {
+		t.Errorf("unexpected violations for unknown spec: %v", act)
+	}
+}
+
+func fieldViolations(t *testing.T, err error) []string {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	var res []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				res = append(res, v.Field)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,242 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+import (
+	"sync"
+	"sync/atomic"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSubscriberBuffer is the number of events buffered per subscriber unless configured otherwise
+const DefaultSubscriberBuffer = 256
+
+// OverflowPolicy decides what happens to subscribers that don't keep up with the events
+type OverflowPolicy int
+
+const (
+	// OverflowResync drops events a subscriber has no room for and has it catch up from the
+	// store once it has drained its buffer. Subscribers that miss too many engines are evicted.
+	OverflowResync OverflowPolicy = iota
+
+	// OverflowEvict disconnects subscribers as soon as their buffer is full
+	OverflowEvict
+)
+
+// event is either a status update or a log event of an engine
+type event struct {
+	Status *v1.EngineStatus
+	Log    *logEvent
+}
+
+// logEvent is a log slice event together with its position in the engine log
+type logEvent struct {
+	Name  string
+	Seq   int
+	Event *v1.LogSliceEvent
+}
+
+// engineName returns the name of the engine an event belongs to
+func (e event) engineName() string {
+	if e.Status != nil {
+		return e.Status.Name
+	}
+	if e.Log != nil {
+		return e.Log.Name
+	}
+	return ""
+}
+
+// SubscriberStats describes how well subscribers keep up with engine events
+type SubscriberStats struct {
+	// Subscribers is the number of currently connected subscribers
+	Subscribers int `json:"subscribers"`
+	// Published is the number of events published since the service started
+	Published uint64 `json:"published"`
+	// Dropped is the number of events dropped because a subscriber's buffer was full
+	Dropped uint64 `json:"dropped"`
+	// Evicted is the number of subscribers that were disconnected for being too slow
+	Evicted uint64 `json:"evicted"`
+	// MaxLag is the largest number of events a subscriber has yet to consume
+	MaxLag int `json:"maxLag"`
+}
+
+// hub distributes events to all subscribers within this process. Publishing never blocks:
+// every subscriber has a bounded buffer and the subscriber's OverflowPolicy decides what
+// happens once it's full.
+type hub struct {
+	subs map[*subscription]struct{}
+	mu   sync.RWMutex
+
+	published uint64
+	dropped   uint64
+	evicted   uint64
+}
+
+// subscription receives the events matching its filter
+type subscription struct {
+	// Events delivers the events matching the filter
+	Events chan event
+	// Resync is signalled when events were dropped. Consume what's buffered in Events,
+	// then catch up on the engines returned by Missed.
+	Resync chan struct{}
+	// Evicted is closed when the subscriber was disconnected for being too slow
+	Evicted chan struct{}
+
+	hub    *hub
+	match  func(event) bool
+	policy OverflowPolicy
+
+	// maxMissed limits how many engines a subscriber may miss before it's evicted
+	maxMissed int
+	missed    map[string]struct{}
+	mu        sync.Mutex
+	closeOnce sync.Once
+}
+
+// subscribe registers a new subscriber for all events matching the filter.
+// Call Close on the subscription to unsubscribe.
+func (h *hub) subscribe(bufferSize int, policy OverflowPolicy, match func(event) bool) *subscription {
+	if bufferSize <= 0 {
+		bufferSize = DefaultSubscriberBuffer
+	}
+	s := &subscription{
+		Events:    make(chan event, bufferSize),
+		Resync:    make(chan struct{}, 1),
+		Evicted:   make(chan struct{}),
+		hub:       h,
+		match:     match,
+		policy:    policy,
+		maxMissed: 4 * bufferSize,
+	}
+
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[*subscription]struct{})
+	}
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+
+	return s
+}
+
+// publish sends an event to all subscribers whose filter matches
+func (h *hub) publish(evt event) {
+	atomic.AddUint64(&h.published, 1)
+
+	var evict []*subscription
+	h.mu.RLock()
+	for s := range h.subs {
+		if s.match != nil && !s.match(evt) {
+			continue
+		}
+
+		select {
+		case s.Events <- evt:
+			continue
+		default:
+		}
+
+		atomic.AddUint64(&h.dropped, 1)
+		if s.policy == OverflowEvict || !s.miss(evt.engineName()) {
+			evict = append(evict, s)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, s := range evict {
+		log.WithField("buffer", cap(s.Events)).Warn("evicting slow subscriber")
+		atomic.AddUint64(&h.evicted, 1)
+		s.close(true)
+	}
+}
+
+// stats returns the current subscriber statistics
+func (h *hub) stats() SubscriberStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	res := SubscriberStats{
+		Subscribers: len(h.subs),
+		Published:   atomic.LoadUint64(&h.published),
+		Dropped:     atomic.LoadUint64(&h.dropped),
+		Evicted:     atomic.LoadUint64(&h.evicted),
+	}
+	for s := range h.subs {
+		if lag := len(s.Events); lag > res.MaxLag {
+			res.MaxLag = lag
+		}
+	}
+	return res
+}
+
+// miss records that the subscriber missed an event of an engine and signals a resync.
+// It returns false if the subscriber missed too many engines to catch up.
+func (s *subscription) miss(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.missed == nil {
+		s.missed = make(map[string]struct{})
+		log.WithField("buffer", cap(s.Events)).Warn("subscriber is too slow - dropping events")
+	}
+	s.missed[name] = struct{}{}
+	if len(s.missed) > s.maxMissed {
+		return false
+	}
+
+	select {
+	case s.Resync <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Missed returns the names of all engines the subscriber missed events of since the last call
+func (s *subscription) Missed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]string, 0, len(s.missed))
+	for name := range s.missed {
+		res = append(res, name)
+	}
+	s.missed = nil
+	return res
+}
+
+// Close unsubscribes from the hub
+func (s *subscription) Close() {
+	s.close(false)
+}
+
+func (s *subscription) close(evicted bool) {
+	s.closeOnce.Do(func() {
+		s.hub.mu.Lock()
+		delete(s.hub.subs, s)
+		s.hub.mu.Unlock()
+
+		if evicted {
+			close(s.Evicted)
+		}
+	})
+}
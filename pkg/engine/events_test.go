@@ -0,0 +1,123 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/store"
+)
+
+func statusEvent(name string) event {
+	return event{Status: &v1.EngineStatus{Name: name}}
+}
+
+func TestHubResync(t *testing.T) {
+	var h hub
+	sub := h.subscribe(2, OverflowResync, func(evt event) bool { return evt.engineName() != "ignored" })
+	defer sub.Close()
+
+	for _, name := range []string{"a", "b", "ignored", "c", "d", "c"} {
+		h.publish(statusEvent(name))
+	}
+
+	stats := h.stats()
+	if stats.Subscribers != 1 || stats.Published != 6 || stats.Dropped != 3 || stats.MaxLag != 2 || stats.Evicted != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	select {
+	case <-sub.Resync:
+	default:
+		t.Fatal("subscriber was not told to resync")
+	}
+	if a, b := (<-sub.Events).engineName(), (<-sub.Events).engineName(); a != "a" || b != "b" {
+		t.Errorf("expected buffered events for a and b, got %s and %s", a, b)
+	}
+	missed := sub.Missed()
+	sort.Strings(missed)
+	if fmt.Sprint(missed) != "[c d]" {
+		t.Errorf("expected c and d to be missed, got %v", missed)
+	}
+	if len(sub.Missed()) != 0 {
+		t.Error("Missed should reset the missed engines")
+	}
+}
+
+func TestHubEvictsSlowSubscribers(t *testing.T) {
+	var h hub
+	evict := h.subscribe(1, OverflowEvict, nil)
+	defer evict.Close()
+	resync := h.subscribe(1, OverflowResync, nil)
+	defer resync.Close()
+
+	// the resync subscriber may miss up to four times its buffer size
+	for i := 0; i < 5; i++ {
+		h.publish(statusEvent(fmt.Sprintf("net.%d", i)))
+	}
+
+	select {
+	case <-evict.Evicted:
+	default:
+		t.Error("subscriber with OverflowEvict policy was not evicted")
+	}
+	select {
+	case <-resync.Evicted:
+		t.Error("subscriber with OverflowResync policy was evicted too early")
+	default:
+	}
+
+	h.publish(statusEvent("net.5"))
+	select {
+	case <-resync.Evicted:
+	default:
+		t.Error("subscriber that missed too many engines was not evicted")
+	}
+	if stats := h.stats(); stats.Evicted != 2 || stats.Subscribers != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestSubscriberStatsHandler(t *testing.T) {
+	service := NewService(store.NewInMemoryEngineStore(), store.NewInMemoryLogStore(), nil)
+	sub := service.events.subscribe(1, OverflowResync, func(event) bool { return true })
+	defer sub.Close()
+	service.events.publish(statusEvent("a"))
+	service.events.publish(statusEvent("b"))
+
+	rec := httptest.NewRecorder()
+	service.SubscriberStatsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/subscribers", nil))
+
+	var stats SubscriberStats
+	err := json.Unmarshal(rec.Body.Bytes(), &stats)
+	if err != nil {
+		t.Fatalf("cannot decode %s: %v", rec.Body.String(), err)
+	}
+	if stats.Subscribers != 1 || stats.Published != 2 || stats.Dropped != 1 || stats.MaxLag != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
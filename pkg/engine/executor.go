@@ -0,0 +1,99 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StartSpec describes what an engine is supposed to run
+type StartSpec struct {
+	// EnginePath is the path of the engine YAML within the repository
+	EnginePath string
+	// EngineYAML is the content of the engine YAML, if it was provided directly
+	EngineYAML []byte
+	// Sideload is additional content made available to the engine
+	Sideload []byte
+	// ConfigYAML is the content of the net/config.yaml, if it was provided directly
+	ConfigYAML []byte
+	// Application is a directory holding the application uploaded using StartLocalEngine.
+	// The executor takes ownership of the directory and removes it once the engine is done.
+	Application string
+}
+
+// ErrNotRunning is returned by Executor.Stop for engines the executor does not run, e.g. because
+// they were started before the server restarted. The Service marks such engines as failed.
+var ErrNotRunning = errors.New("engine is not running")
+
+// Executor runs engines on behalf of the Service
+type Executor interface {
+	// Start begins running an engine. Start must not block until the engine is done,
+	// but report its progress and output through the Reporter instead.
+	Start(ctx context.Context, status *v1.EngineStatus, spec StartSpec, rep Reporter) error
+
+	// Stop stops a running engine. The engine is expected to report PHASE_DONE once it has stopped.
+	// Engines the executor does not run are answered with ErrNotRunning.
+	Stop(name, reason string) error
+}
+
+// Reporter receives the status updates and log output of running engines
+type Reporter interface {
+	// UpdateStatus replaces the status of an engine and notifies all listeners.
+	// Updates that violate the engine lifecycle are rejected with ErrIllegalTransition
+	// or ErrInvalidConditions.
+	UpdateStatus(ctx context.Context, status *v1.EngineStatus) error
+
+	// Output returns a writer that receives the raw log output of an engine.
+	// Closing the writer flushes any incomplete line and abandons all unfinished log slices.
+	Output(name string) io.WriteCloser
+}
+
+// startMethods are the RPCs that start engines
+var startMethods = map[string]struct{}{
+	"/v1.NetService/StartEngine":             {},
+	"/v1.NetService/StartLocalEngine":        {},
+	"/v1.NetService/StartFromPreviousEngine": {},
+}
+
+func checkExecutor(method string) error {
+	if _, starting := startMethods[method]; starting {
+		return status.Errorf(codes.Unimplemented, "server has no executor: %s is not available", method)
+	}
+	return nil
+}
+
+// NoExecutorUnaryInterceptor rejects all unary RPCs that start engines with Unimplemented. Without an Executor,
+// engines would never leave PHASE_PREPARING. Stopping engines remains possible and marks them as failed.
+func NoExecutorUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return rejectingUnaryInterceptor(checkExecutor)
+}
+
+// NoExecutorStreamInterceptor rejects all streaming RPCs that start engines with Unimplemented
+func NoExecutorStreamInterceptor() grpc.StreamServerInterceptor {
+	return rejectingStreamInterceptor(checkExecutor)
+}
@@ -0,0 +1,173 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/store"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	// ErrIllegalTransition is returned when an engine is asked to move to a phase it cannot reach from its current one
+	ErrIllegalTransition = errors.New("illegal phase transition")
+
+	// ErrInvalidConditions is returned when an update leaves an engine's conditions in an inconsistent state
+	ErrInvalidConditions = errors.New("invalid engine conditions")
+)
+
+// transitions lists the phases an engine may move to from each phase.
+// Staying in the same phase is always allowed, except for PHASE_UNKNOWN.
+var transitions = map[v1.EnginePhase][]v1.EnginePhase{
+	v1.EnginePhase_PHASE_UNKNOWN:   {v1.EnginePhase_PHASE_PREPARING, v1.EnginePhase_PHASE_WAITING},
+	v1.EnginePhase_PHASE_WAITING:   {v1.EnginePhase_PHASE_PREPARING, v1.EnginePhase_PHASE_DONE},
+	v1.EnginePhase_PHASE_PREPARING: {v1.EnginePhase_PHASE_STARTING, v1.EnginePhase_PHASE_CLEANUP, v1.EnginePhase_PHASE_DONE},
+	v1.EnginePhase_PHASE_STARTING:  {v1.EnginePhase_PHASE_RUNNING, v1.EnginePhase_PHASE_CLEANUP, v1.EnginePhase_PHASE_DONE},
+	v1.EnginePhase_PHASE_RUNNING:   {v1.EnginePhase_PHASE_CLEANUP, v1.EnginePhase_PHASE_DONE},
+	v1.EnginePhase_PHASE_CLEANUP:   {v1.EnginePhase_PHASE_DONE},
+	v1.EnginePhase_PHASE_DONE:      {},
+}
+
+// CanTransition returns true if an engine may move from one phase to another
+func CanTransition(from, to v1.EnginePhase) bool {
+	if from == to {
+		return from != v1.EnginePhase_PHASE_UNKNOWN
+	}
+	for _, p := range transitions[from] {
+		if p == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Lifecycle moves engines through their phases. It rejects illegal transitions, keeps the
+// engine conditions consistent and publishes every change it stores.
+type Lifecycle struct {
+	Engines store.Engines
+
+	// Publish is called with every status the lifecycle stored
+	Publish func(status *v1.EngineStatus)
+
+	mu sync.Mutex
+}
+
+// Create stores a new engine. The engine must start out in PHASE_PREPARING or PHASE_WAITING.
+func (l *Lifecycle) Create(ctx context.Context, status *v1.EngineStatus) (*v1.EngineStatus, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := l.Engines.Get(ctx, status.Name)
+	if err == nil {
+		return nil, fmt.Errorf("engine %s: %w", status.Name, store.ErrAlreadyExists)
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	return l.store(ctx, &v1.EngineStatus{Name: status.Name}, proto.Clone(status).(*v1.EngineStatus))
+}
+
+// Update modifies an existing engine. The modification function receives a copy of the current
+// status and may change it in place. Returning an error from mod aborts the update.
+func (l *Lifecycle) Update(ctx context.Context, name string, mod func(status *v1.EngineStatus) error) (*v1.EngineStatus, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current, err := l.Engines.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	next := proto.Clone(current).(*v1.EngineStatus)
+	err = mod(next)
+	if err != nil {
+		return nil, err
+	}
+	next.Name = current.Name
+
+	return l.store(ctx, current, next)
+}
+
+// store validates the change from current to next, completes the conditions of next and stores it
+func (l *Lifecycle) store(ctx context.Context, current, next *v1.EngineStatus) (*v1.EngineStatus, error) {
+	if !CanTransition(current.Phase, next.Phase) {
+		return nil, fmt.Errorf("%w: engine %s cannot move from %s to %s", ErrIllegalTransition, next.Name, current.Phase, next.Phase)
+	}
+
+	if next.Metadata == nil {
+		next.Metadata = &v1.EngineMetadata{}
+	}
+	if next.Conditions == nil {
+		next.Conditions = &v1.EngineConditions{}
+	}
+	var (
+		md    = next.Metadata
+		conds = next.Conditions
+		prev  = current.GetConditions()
+	)
+
+	if c := current.GetMetadata().GetCreated(); c != nil {
+		// creation time is immutable
+		md.Created = c
+	}
+	if md.Created == nil {
+		md.Created = timestamppb.Now()
+	}
+
+	if next.Phase == v1.EnginePhase_PHASE_DONE {
+		if current.Phase != v1.EnginePhase_PHASE_DONE || md.Finished == nil {
+			md.Finished = timestamppb.Now()
+		}
+	} else {
+		md.Finished = nil
+	}
+
+	if conds.FailureCount < prev.GetFailureCount() {
+		return nil, fmt.Errorf("%w: failure count of %s cannot decrease", ErrInvalidConditions, next.Name)
+	}
+	if next.Phase == v1.EnginePhase_PHASE_WAITING && conds.WaitUntil == nil {
+		return nil, fmt.Errorf("%w: waiting engine %s has no wait_until condition", ErrInvalidConditions, next.Name)
+	}
+	if next.Phase == v1.EnginePhase_PHASE_RUNNING || prev.GetDidExecute() {
+		// once an engine has run, it stays executed
+		conds.DidExecute = true
+	}
+	if next.Phase != v1.EnginePhase_PHASE_DONE || conds.FailureCount > 0 {
+		// only finished engines without failures can be successful
+		conds.Success = false
+	}
+
+	err := l.Engines.Store(ctx, next)
+	if err != nil {
+		return nil, err
+	}
+	if l.Publish != nil {
+		l.Publish(proto.Clone(next).(*v1.EngineStatus))
+	}
+	return next, nil
+}
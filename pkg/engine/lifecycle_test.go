@@ -0,0 +1,162 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/store"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		From, To v1.EnginePhase
+		Legal    bool
+	}{
+		{v1.EnginePhase_PHASE_UNKNOWN, v1.EnginePhase_PHASE_PREPARING, true},
+		{v1.EnginePhase_PHASE_UNKNOWN, v1.EnginePhase_PHASE_RUNNING, false},
+		{v1.EnginePhase_PHASE_UNKNOWN, v1.EnginePhase_PHASE_UNKNOWN, false},
+		{v1.EnginePhase_PHASE_WAITING, v1.EnginePhase_PHASE_PREPARING, true},
+		{v1.EnginePhase_PHASE_WAITING, v1.EnginePhase_PHASE_RUNNING, false},
+		{v1.EnginePhase_PHASE_PREPARING, v1.EnginePhase_PHASE_STARTING, true},
+		{v1.EnginePhase_PHASE_STARTING, v1.EnginePhase_PHASE_RUNNING, true},
+		{v1.EnginePhase_PHASE_RUNNING, v1.EnginePhase_PHASE_RUNNING, true},
+		{v1.EnginePhase_PHASE_RUNNING, v1.EnginePhase_PHASE_PREPARING, false},
+		{v1.EnginePhase_PHASE_RUNNING, v1.EnginePhase_PHASE_CLEANUP, true},
+		{v1.EnginePhase_PHASE_CLEANUP, v1.EnginePhase_PHASE_RUNNING, false},
+		{v1.EnginePhase_PHASE_CLEANUP, v1.EnginePhase_PHASE_DONE, true},
+		{v1.EnginePhase_PHASE_DONE, v1.EnginePhase_PHASE_RUNNING, false},
+		{v1.EnginePhase_PHASE_DONE, v1.EnginePhase_PHASE_DONE, true},
+	}
+	for _, test := range tests {
+		if act := CanTransition(test.From, test.To); act != test.Legal {
+			t.Errorf("CanTransition(%v, %v) = %v, expected %v", test.From, test.To, act, test.Legal)
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	ctx := context.Background()
+	var published []*v1.EngineStatus
+	lc := &Lifecycle{
+		Engines: store.NewInMemoryEngineStore(),
+		Publish: func(st *v1.EngineStatus) { published = append(published, st) },
+	}
+
+	st, err := lc.Create(ctx, &v1.EngineStatus{Name: "net.1", Phase: v1.EnginePhase_PHASE_PREPARING})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if st.Metadata.GetCreated() == nil {
+		t.Error("Create did not stamp the creation time")
+	}
+	_, err = lc.Create(ctx, &v1.EngineStatus{Name: "net.1", Phase: v1.EnginePhase_PHASE_PREPARING})
+	if !errors.Is(err, store.ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists, got %v", err)
+	}
+
+	setPhase := func(p v1.EnginePhase) func(*v1.EngineStatus) error {
+		return func(st *v1.EngineStatus) error {
+			st.Phase = p
+			st.Conditions.Success = true
+			return nil
+		}
+	}
+
+	_, err = lc.Update(ctx, "net.1", setPhase(v1.EnginePhase_PHASE_RUNNING))
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("expected ErrIllegalTransition when skipping STARTING, got %v", err)
+	}
+
+	for _, p := range []v1.EnginePhase{v1.EnginePhase_PHASE_STARTING, v1.EnginePhase_PHASE_RUNNING, v1.EnginePhase_PHASE_CLEANUP} {
+		st, err = lc.Update(ctx, "net.1", setPhase(p))
+		if err != nil {
+			t.Fatalf("Update to %v: %v", p, err)
+		}
+		if st.Conditions.Success {
+			t.Errorf("engine in phase %v must not be successful", p)
+		}
+		if st.Metadata.Finished != nil {
+			t.Errorf("engine in phase %v must not be finished", p)
+		}
+	}
+	if !st.Conditions.DidExecute {
+		t.Error("engine that was running should have did_execute set")
+	}
+
+	st, err = lc.Update(ctx, "net.1", setPhase(v1.EnginePhase_PHASE_DONE))
+	if err != nil {
+		t.Fatalf("Update to DONE: %v", err)
+	}
+	if !st.Conditions.Success || st.Metadata.Finished == nil {
+		t.Errorf("done engine should be successful and finished: %v", st)
+	}
+
+	_, err = lc.Update(ctx, "net.1", func(st *v1.EngineStatus) error {
+		st.Conditions.FailureCount = -1
+		return nil
+	})
+	if !errors.Is(err, ErrInvalidConditions) {
+		t.Errorf("expected ErrInvalidConditions for decreasing failure count, got %v", err)
+	}
+
+	if len(published) != 5 {
+		t.Errorf("expected 5 published updates, got %d", len(published))
+	}
+}
+
+func TestLifecycleWaiting(t *testing.T) {
+	ctx := context.Background()
+	lc := &Lifecycle{Engines: store.NewInMemoryEngineStore()}
+
+	_, err := lc.Create(ctx, &v1.EngineStatus{Name: "net.1", Phase: v1.EnginePhase_PHASE_WAITING})
+	if !errors.Is(err, ErrInvalidConditions) {
+		t.Errorf("expected ErrInvalidConditions for waiting engine without wait_until, got %v", err)
+	}
+
+	_, err = lc.Create(ctx, &v1.EngineStatus{
+		Name:       "net.1",
+		Phase:      v1.EnginePhase_PHASE_WAITING,
+		Conditions: &v1.EngineConditions{WaitUntil: timestamppb.Now(), FailureCount: 1, Success: true},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	st, err := lc.Update(ctx, "net.1", func(st *v1.EngineStatus) error {
+		st.Phase = v1.EnginePhase_PHASE_DONE
+		st.Conditions.Success = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if st.Conditions.Success {
+		t.Error("engine with failures must not be successful")
+	}
+	if st.Conditions.DidExecute {
+		t.Error("engine that never ran must not have did_execute set")
+	}
+}
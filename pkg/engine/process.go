@@ -0,0 +1,259 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/spec"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// errExecutorClosed is returned when engines are started after the executor was closed
+var errExecutorClosed = errors.New("executor is closed")
+
+// ProcessExecutor runs engines as processes on the server itself. It runs the run script of
+// an engine's YAML using sh, within the engine's application directory if it has one and
+// within an empty temporary directory otherwise. The sideload is passed on stdin and the
+// annotations as NET_ANNOTATION_<KEY> environment variables.
+type ProcessExecutor struct {
+	// Shell runs the scripts of engines. If empty, sh is used.
+	Shell string
+
+	procs  map[string]*process
+	closed bool
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+}
+
+var _ Executor = &ProcessExecutor{}
+
+// process is an engine run by the ProcessExecutor
+type process struct {
+	cmd *exec.Cmd
+	// reason is why the engine was stopped, empty unless it was
+	reason string
+}
+
+// Start runs the engine's script in the background
+func (e *ProcessExecutor) Start(ctx context.Context, status *v1.EngineStatus, sp StartSpec, rep Reporter) error {
+	script, err := engineScript(sp)
+	if err != nil {
+		return err
+	}
+
+	dir := sp.Application
+	if dir == "" {
+		dir, err = os.MkdirTemp("", "net-engine-")
+		if err != nil {
+			return err
+		}
+	}
+	cleanup := func() {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			log.WithError(err).WithField("dir", dir).Warn("cannot remove engine directory")
+		}
+	}
+
+	shell := e.Shell
+	if shell == "" {
+		shell = "sh"
+	}
+	out := rep.Output(status.Name)
+	cmd := exec.Command(shell, "-c", script)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), engineEnv(status)...)
+	cmd.Stdin = bytes.NewReader(sp.Sideload)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	setProcessGroup(cmd)
+
+	status.Phase = v1.EnginePhase_PHASE_STARTING
+	err = rep.UpdateStatus(ctx, status)
+	if err != nil {
+		out.Close()
+		if sp.Application == "" {
+			cleanup()
+		}
+		return err
+	}
+
+	p := &process{cmd: cmd}
+	err = e.run(status.Name, p)
+	if err != nil {
+		out.Close()
+		if sp.Application == "" {
+			cleanup()
+		}
+		return err
+	}
+
+	go func() {
+		defer e.wg.Done()
+		defer cleanup()
+
+		status.Phase = v1.EnginePhase_PHASE_RUNNING
+		e.report(rep, status)
+
+		err := cmd.Wait()
+		out.Close()
+
+		e.mu.Lock()
+		delete(e.procs, status.Name)
+		reason := p.reason
+		e.mu.Unlock()
+
+		status.Phase = v1.EnginePhase_PHASE_DONE
+		if status.Conditions == nil {
+			status.Conditions = &v1.EngineConditions{}
+		}
+		switch {
+		case reason != "":
+			status.Details = reason
+			status.Conditions.FailureCount++
+		case err != nil:
+			status.Details = fmt.Sprintf("engine failed: %v", err)
+			status.Conditions.FailureCount++
+		default:
+			status.Conditions.Success = true
+		}
+		e.report(rep, status)
+	}()
+	return nil
+}
+
+// run starts the process of an engine and registers it, so that it can be stopped
+func (e *ProcessExecutor) run(name string, p *process) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return errExecutorClosed
+	}
+	if _, exists := e.procs[name]; exists {
+		return fmt.Errorf("engine %s is running already", name)
+	}
+	err := p.cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	if e.procs == nil {
+		e.procs = make(map[string]*process)
+	}
+	e.procs[name] = p
+	e.wg.Add(1)
+	return nil
+}
+
+// report updates the status of an engine and logs if that's not possible
+func (e *ProcessExecutor) report(rep Reporter, status *v1.EngineStatus) {
+	err := rep.UpdateStatus(context.Background(), proto.Clone(status).(*v1.EngineStatus))
+	if err != nil {
+		log.WithError(err).WithField("name", status.Name).Warn("cannot update engine status")
+	}
+}
+
+// Stop kills the processes of an engine
+func (e *ProcessExecutor) Stop(name, reason string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	p, ok := e.procs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRunning, name)
+	}
+	if p.reason == "" {
+		p.reason = reason
+	}
+	return killProcessGroup(p.cmd)
+}
+
+// Close stops all engines and waits until they have reported PHASE_DONE.
+// Engines can no longer be started once the executor is closed.
+func (e *ProcessExecutor) Close() error {
+	e.mu.Lock()
+	e.closed = true
+	for name, p := range e.procs {
+		if p.reason == "" {
+			p.reason = "server shut down"
+		}
+		err := killProcessGroup(p.cmd)
+		if err != nil {
+			log.WithError(err).WithField("name", name).Warn("cannot stop engine")
+		}
+	}
+	e.mu.Unlock()
+
+	e.wg.Wait()
+	return nil
+}
+
+// engineScript returns the run script of an engine. The engine YAML is read from the
+// application directory unless it was provided directly.
+func engineScript(sp StartSpec) (string, error) {
+	content := sp.EngineYAML
+	if len(content) == 0 {
+		if sp.Application == "" || sp.EnginePath == "" {
+			return "", fmt.Errorf("engine YAML is not available: engines need to be started with their YAML or application")
+		}
+		var err error
+		content, err = os.ReadFile(filepath.Join(sp.Application, filepath.FromSlash(sp.EnginePath)))
+		if err != nil {
+			return "", fmt.Errorf("cannot read engine YAML: %w", err)
+		}
+	}
+
+	eng, err := spec.ParseEngine(content)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(eng.Run) == "" {
+		return "", fmt.Errorf("engine YAML has no run script")
+	}
+	return eng.Run, nil
+}
+
+// engineEnv returns the environment variables that describe an engine to its script
+func engineEnv(status *v1.EngineStatus) []string {
+	env := []string{"NET_ENGINE_NAME=" + status.Name}
+	for _, a := range status.GetMetadata().GetAnnotations() {
+		key := strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '_'
+		}, a.Key)
+		env = append(env, "NET_ANNOTATION_"+strings.ToUpper(key)+"="+a.Value)
+	}
+	return env
+}
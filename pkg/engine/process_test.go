@@ -0,0 +1,135 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+func TestProcessExecutor(t *testing.T) {
+	executor := &ProcessExecutor{}
+	t.Cleanup(func() { executor.Close() })
+	service, client := startTestService(t, executor)
+
+	start := func(yaml string, annotations ...*v1.Annotation) string {
+		t.Helper()
+		resp, err := client.StartEngine(context.Background(), &v1.StartEngineRequest{
+			Metadata:   &v1.EngineMetadata{Owner: "tester", Annotations: annotations},
+			EngineYaml: []byte(yaml),
+			Sideload:   []byte("sideloaded"),
+		})
+		if err != nil {
+			t.Fatalf("StartEngine: %v", err)
+		}
+		return resp.Status.Name
+	}
+
+	t.Run("success", func(t *testing.T) {
+		name := start("run: |\n  echo \"[build|START]\"\n  echo \"[build] $NET_ANNOTATION_VERSION $(cat)\"\n  echo \"[build|DONE]\"\n",
+			&v1.Annotation{Key: "version", Value: "1.0"})
+		st := waitForPhase(t, client, name, v1.EnginePhase_PHASE_DONE)
+		if !st.Conditions.Success || !st.Conditions.DidExecute || st.Conditions.FailureCount != 0 {
+			t.Errorf("unexpected conditions: %v", st.Conditions)
+		}
+
+		evts, err := service.Logs.Read(context.Background(), name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for _, evt := range evts {
+			lines = append(lines, evt.Type.String()+" "+evt.Payload)
+		}
+		if act := strings.Join(lines, "\n"); act != "SLICE_START \nSLICE_CONTENT 1.0 sideloaded\nSLICE_DONE " {
+			t.Errorf("unexpected log:\n%s", act)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		name := start("run: exit 3")
+		st := waitForPhase(t, client, name, v1.EnginePhase_PHASE_DONE)
+		if st.Conditions.Success || st.Conditions.FailureCount != 1 || !strings.Contains(st.Details, "exit status 3") {
+			t.Errorf("unexpected status: %v", st)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		name := start("run: sleep 30 & wait")
+		waitForPhase(t, client, name, v1.EnginePhase_PHASE_RUNNING)
+		_, err := client.StopEngine(context.Background(), &v1.StopEngineRequest{Name: name})
+		if err != nil {
+			t.Fatalf("StopEngine: %v", err)
+		}
+		st := waitForPhase(t, client, name, v1.EnginePhase_PHASE_DONE)
+		if st.Conditions.FailureCount != 1 || st.Details != "stopped by user" {
+			t.Errorf("unexpected status: %v", st)
+		}
+	})
+
+	t.Run("not running", func(t *testing.T) {
+		// e.g. left behind by a previous server
+		_, err := service.lifecycle.Create(context.Background(), &v1.EngineStatus{Name: "orphan", Phase: v1.EnginePhase_PHASE_PREPARING})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.StopEngine(context.Background(), &v1.StopEngineRequest{Name: "orphan"})
+		if err != nil {
+			t.Fatalf("StopEngine: %v", err)
+		}
+		st := waitForPhase(t, client, "orphan", v1.EnginePhase_PHASE_DONE)
+		if st.Conditions.FailureCount != 1 {
+			t.Errorf("unexpected status: %v", st)
+		}
+	})
+
+	t.Run("no script", func(t *testing.T) {
+		_, err := client.StartEngine(context.Background(), &v1.StartEngineRequest{
+			Metadata:   &v1.EngineMetadata{Owner: "tester"},
+			EnginePath: "net/build.yaml",
+		})
+		if err == nil {
+			t.Fatal("expected engines without YAML to fail")
+		}
+	})
+}
+
+func waitForPhase(t *testing.T, client v1.NetServiceClient, name string, phase v1.EnginePhase) *v1.EngineStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := client.GetEngine(context.Background(), &v1.GetEngineRequest{Name: name})
+		if err != nil {
+			t.Fatalf("GetEngine: %v", err)
+		}
+		if resp.Result.Phase == phase {
+			return resp.Result
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("engine %s did not reach %v, it is in %v", name, phase, resp.Result.Phase)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,76 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mutatingMethods are the RPCs that start or stop engines
+var mutatingMethods = map[string]struct{}{
+	"/v1.NetService/StartEngine":             {},
+	"/v1.NetService/StartLocalEngine":        {},
+	"/v1.NetService/StartFromPreviousEngine": {},
+	"/v1.NetService/StopEngine":              {},
+}
+
+func checkReadOnly(method string) error {
+	if _, mutating := mutatingMethods[method]; mutating {
+		return status.Errorf(codes.PermissionDenied, "server is read-only: %s is not allowed", method)
+	}
+	return nil
+}
+
+// ReadOnlyUnaryInterceptor rejects all unary RPCs that start or stop engines with PermissionDenied
+func ReadOnlyUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return rejectingUnaryInterceptor(checkReadOnly)
+}
+
+// ReadOnlyStreamInterceptor rejects all streaming RPCs that start or stop engines with PermissionDenied
+func ReadOnlyStreamInterceptor() grpc.StreamServerInterceptor {
+	return rejectingStreamInterceptor(checkReadOnly)
+}
+
+// rejectingUnaryInterceptor rejects all unary RPCs for which check returns an error
+func rejectingUnaryInterceptor(check func(method string) error) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		err := check(info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// rejectingStreamInterceptor rejects all streaming RPCs for which check returns an error
+func rejectingStreamInterceptor(check func(method string) error) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := check(info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
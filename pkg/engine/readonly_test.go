@@ -0,0 +1,115 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadOnlyInterceptors(t *testing.T) {
+	service, client := startTestService(t, nil,
+		grpc.UnaryInterceptor(ReadOnlyUnaryInterceptor()),
+		grpc.StreamInterceptor(ReadOnlyStreamInterceptor()),
+	)
+	ctx := context.Background()
+
+	_, err := service.lifecycle.Create(ctx, &v1.EngineStatus{
+		Name:       "net.1",
+		Phase:      v1.EnginePhase_PHASE_PREPARING,
+		Conditions: &v1.EngineConditions{CanReplay: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.StartEngine(ctx, &v1.StartEngineRequest{Metadata: &v1.EngineMetadata{}, EnginePath: "net/build.yaml"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("StartEngine: expected PermissionDenied, got %v", err)
+	}
+	_, err = client.StartFromPreviousEngine(ctx, &v1.StartFromPreviousEngineRequest{PreviousEngine: "net.1"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("StartFromPreviousEngine: expected PermissionDenied, got %v", err)
+	}
+	_, err = client.StopEngine(ctx, &v1.StopEngineRequest{Name: "net.1"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("StopEngine: expected PermissionDenied, got %v", err)
+	}
+	upload, err := client.StartLocalEngine(ctx)
+	if err == nil {
+		_, err = upload.CloseAndRecv()
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("StartLocalEngine: expected PermissionDenied, got %v", err)
+	}
+
+	_, err = client.GetEngine(ctx, &v1.GetEngineRequest{Name: "net.1"})
+	if err != nil {
+		t.Errorf("GetEngine should be allowed: %v", err)
+	}
+	list, err := client.ListEngines(ctx, &v1.ListEnginesRequest{})
+	if err != nil || len(list.Result) != 1 {
+		t.Errorf("ListEngines should be allowed: %v", err)
+	}
+}
+
+func TestNoExecutorInterceptors(t *testing.T) {
+	service, client := startTestService(t, nil,
+		grpc.UnaryInterceptor(NoExecutorUnaryInterceptor()),
+		grpc.StreamInterceptor(NoExecutorStreamInterceptor()),
+	)
+	ctx := context.Background()
+
+	_, err := service.lifecycle.Create(ctx, &v1.EngineStatus{
+		Name:       "net.1",
+		Phase:      v1.EnginePhase_PHASE_PREPARING,
+		Conditions: &v1.EngineConditions{CanReplay: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.StartEngine(ctx, &v1.StartEngineRequest{Metadata: &v1.EngineMetadata{}, EnginePath: "net/build.yaml"})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("StartEngine: expected Unimplemented, got %v", err)
+	}
+	_, err = client.StartFromPreviousEngine(ctx, &v1.StartFromPreviousEngineRequest{PreviousEngine: "net.1"})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("StartFromPreviousEngine: expected Unimplemented, got %v", err)
+	}
+	upload, err := client.StartLocalEngine(ctx)
+	if err == nil {
+		_, err = upload.CloseAndRecv()
+	}
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("StartLocalEngine: expected Unimplemented, got %v", err)
+	}
+
+	_, err = client.StopEngine(ctx, &v1.StopEngineRequest{Name: "net.1"})
+	if err != nil {
+		t.Errorf("StopEngine should be allowed: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	log "github.com/sirupsen/logrus"
+)
+
+// errNotWaiting is returned by lifecycle modifications that expect an engine in PHASE_WAITING
+var errNotWaiting = errors.New("engine is not waiting")
+
+// scheduler starts waiting engines once their time has come
+type scheduler struct {
+	timers map[string]*time.Timer
+	closed bool
+	mu     sync.Mutex
+}
+
+// schedule calls start at the given time. Times in the past call start right away.
+// Scheduling an engine again replaces the previous schedule.
+func (s *scheduler) schedule(name string, at time.Time, start func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	if s.timers == nil {
+		s.timers = make(map[string]*time.Timer)
+	}
+	if t, ok := s.timers[name]; ok {
+		t.Stop()
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(time.Until(at), func() {
+		s.mu.Lock()
+		if s.timers[name] != t {
+			// we've been cancelled or replaced in the meantime
+			s.mu.Unlock()
+			return
+		}
+		delete(s.timers, name)
+		s.mu.Unlock()
+
+		start()
+	})
+	s.timers[name] = t
+}
+
+// cancel removes the schedule of an engine
+func (s *scheduler) cancel(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.timers[name]; ok {
+		t.Stop()
+		delete(s.timers, name)
+	}
+}
+
+// close cancels all schedules. Engines remain waiting and can be resumed later.
+func (s *scheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, t := range s.timers {
+		t.Stop()
+		delete(s.timers, name)
+	}
+	s.closed = true
+}
+
+// scheduleStart parks a waiting engine until its wait_until time. Its start spec must have
+// been stored already, so that the engine can still be started if the server restarts in between.
+func (s *Service) scheduleStart(st *v1.EngineStatus) {
+	name := st.Name
+	s.scheduler.schedule(name, st.Conditions.WaitUntil.AsTime(), func() { s.startWaiting(name) })
+}
+
+// startWaiting moves a waiting engine to PHASE_PREPARING and starts it
+func (s *Service) startWaiting(name string) {
+	ctx := context.Background()
+	st, err := s.lifecycle.Update(ctx, name, func(st *v1.EngineStatus) error {
+		if st.Phase != v1.EnginePhase_PHASE_WAITING {
+			return errNotWaiting
+		}
+		st.Phase = v1.EnginePhase_PHASE_PREPARING
+		return nil
+	})
+	if errors.Is(err, errNotWaiting) {
+		return
+	}
+	if err != nil {
+		log.WithError(err).WithField("name", name).Error("cannot start waiting engine")
+		return
+	}
+
+	spec, err := s.loadSpec(ctx, name)
+	if err != nil {
+		log.WithError(err).WithField("name", name).Error("cannot load start spec of waiting engine")
+		s.failEngine(ctx, name, fmt.Sprintf("cannot load start spec: %v", err))
+		return
+	}
+
+	_ = s.start(ctx, st, spec)
+}
+
+// cancelWaiting cancels the start of a waiting engine. If the engine is no longer waiting,
+// errNotWaiting is returned.
+func (s *Service) cancelWaiting(ctx context.Context, name string, reason string) error {
+	s.scheduler.cancel(name)
+	_, err := s.lifecycle.Update(ctx, name, func(st *v1.EngineStatus) error {
+		if st.Phase != v1.EnginePhase_PHASE_WAITING {
+			return errNotWaiting
+		}
+		st.Phase = v1.EnginePhase_PHASE_DONE
+		st.Details = reason
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	spec, err := s.loadSpec(ctx, name)
+	if err != nil {
+		log.WithError(err).WithField("name", name).Warn("cannot load start spec of cancelled engine")
+		return nil
+	}
+	removeApplication(spec)
+	return nil
+}
+
+// ResumeWaiting schedules all engines that are waiting for their start, e.g. after a restart.
+// Engines whose wait_until time has passed are started right away.
+func (s *Service) ResumeWaiting(ctx context.Context) error {
+	waiting, _, err := s.Engines.Find(ctx, []*v1.FilterExpression{
+		{Terms: []*v1.FilterTerm{{Field: "phase", Value: v1.EnginePhase_PHASE_WAITING.String()}}},
+	}, nil, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, st := range waiting {
+		s.scheduleStart(st)
+	}
+	if len(waiting) > 0 {
+		log.WithField("count", len(waiting)).Info("resumed waiting engines")
+	}
+	return nil
+}
+
+// Close cancels all scheduled engine starts. Waiting engines stay in PHASE_WAITING
+// and are picked up again by ResumeWaiting.
+func (s *Service) Close() {
+	s.scheduler.close()
+}
@@ -0,0 +1,159 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/store"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// recordingExecutor remembers the engines it was asked to start
+type recordingExecutor struct {
+	started chan StartSpec
+}
+
+func (e *recordingExecutor) Start(ctx context.Context, status *v1.EngineStatus, spec StartSpec, rep Reporter) error {
+	e.started <- spec
+	return nil
+}
+
+func (e *recordingExecutor) Stop(name, reason string) error { return nil }
+
+func waitingRequest(at time.Time) *v1.StartEngineRequest {
+	return &v1.StartEngineRequest{
+		Metadata:   &v1.EngineMetadata{Owner: "tester", Trigger: v1.EngineTrigger_TRIGGER_MANUAL},
+		EnginePath: "net/nightly.yaml",
+		Sideload:   []byte("sideload"),
+		WaitUntil:  timestamppb.New(at),
+	}
+}
+
+func TestScheduledStart(t *testing.T) {
+	executor := &recordingExecutor{started: make(chan StartSpec, 1)}
+	service, client := startTestService(t, executor)
+	t.Cleanup(service.Close)
+
+	resp, err := client.StartEngine(context.Background(), waitingRequest(time.Now().Add(100*time.Millisecond)))
+	if err != nil {
+		t.Fatalf("StartEngine: %v", err)
+	}
+	if resp.Status.Phase != v1.EnginePhase_PHASE_WAITING {
+		t.Fatalf("engine is in phase %v, expected WAITING", resp.Status.Phase)
+	}
+
+	select {
+	case spec := <-executor.started:
+		if spec.EnginePath != "net/nightly.yaml" || string(spec.Sideload) != "sideload" {
+			t.Errorf("unexpected start spec: %+v", spec)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting engine was not started")
+	}
+
+	st, err := service.Engines.Get(context.Background(), resp.Status.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Phase != v1.EnginePhase_PHASE_PREPARING {
+		t.Errorf("started engine is in phase %v, expected PREPARING", st.Phase)
+	}
+}
+
+func TestStopWaitingEngine(t *testing.T) {
+	executor := &recordingExecutor{started: make(chan StartSpec, 1)}
+	service, client := startTestService(t, executor)
+	t.Cleanup(service.Close)
+
+	resp, err := client.StartEngine(context.Background(), waitingRequest(time.Now().Add(200*time.Millisecond)))
+	if err != nil {
+		t.Fatalf("StartEngine: %v", err)
+	}
+	_, err = client.StopEngine(context.Background(), &v1.StopEngineRequest{Name: resp.Status.Name})
+	if err != nil {
+		t.Fatalf("StopEngine: %v", err)
+	}
+
+	select {
+	case <-executor.started:
+		t.Fatal("cancelled engine was started")
+	case <-time.After(400 * time.Millisecond):
+	}
+
+	st, err := service.Engines.Get(context.Background(), resp.Status.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Phase != v1.EnginePhase_PHASE_DONE || st.Conditions.DidExecute {
+		t.Errorf("cancelled engine should be done without having executed: %v", st)
+	}
+}
+
+func TestResumeWaiting(t *testing.T) {
+	var (
+		engines = store.NewInMemoryEngineStore()
+		logs    = store.NewInMemoryLogStore()
+		specs   = store.NewInMemorySpecStore()
+		ctx     = context.Background()
+	)
+
+	first := NewService(engines, logs, nil)
+	first.Specs = specs
+	resp, err := first.StartEngine(ctx, waitingRequest(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("StartEngine: %v", err)
+	}
+	// simulate a restart after the engine's time has come
+	first.Close()
+	_, err = first.lifecycle.Update(ctx, resp.Status.Name, func(st *v1.EngineStatus) error {
+		st.Conditions.WaitUntil = timestamppb.New(time.Now().Add(-time.Minute))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executor := &recordingExecutor{started: make(chan StartSpec, 1)}
+	second := NewService(engines, logs, executor)
+	second.Specs = specs
+	t.Cleanup(second.Close)
+	err = second.ResumeWaiting(ctx)
+	if err != nil {
+		t.Fatalf("ResumeWaiting: %v", err)
+	}
+
+	select {
+	case spec := <-executor.started:
+		if spec.EnginePath != "net/nightly.yaml" {
+			t.Errorf("unexpected start spec: %+v", spec)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("resumed engine was not started")
+	}
+	_, err = specs.Get(ctx, resp.Status.Name)
+	if err != nil {
+		t.Errorf("start spec should be kept for replay: %v", err)
+	}
+}
@@ -0,0 +1,787 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/filterexpr"
+	"github.com/bhojpur/net/pkg/logs"
+	"github.com/bhojpur/net/pkg/store"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+)
+
+// NewService creates a new NetService implementation. The executor may be nil,
+// in which case engines remain in PHASE_PREPARING until someone reports on them.
+// Start specs are kept in memory unless Specs is replaced before the service is used.
+func NewService(engines store.Engines, logs store.Logs, executor Executor) *Service {
+	s := &Service{
+		Engines:  engines,
+		Logs:     logs,
+		Specs:    store.NewInMemorySpecStore(),
+		Executor: executor,
+
+		UploadLimits:     DefaultUploadLimits,
+		SubscriberBuffer: DefaultSubscriberBuffer,
+	}
+	s.lifecycle = &Lifecycle{
+		Engines: engines,
+		Publish: func(st *v1.EngineStatus) { s.events.publish(event{Status: st}) },
+	}
+	return s
+}
+
+// Service implements the NetService gRPC API
+type Service struct {
+	Engines  store.Engines
+	Logs     store.Logs
+	Specs    store.Specs
+	Executor Executor
+
+	// Sources re-fetches the sources of replayed engines. If nil, replays reuse the
+	// start spec of the previous engine as is.
+	Sources SourceFetcher
+
+	// EngineSpecs is used to validate the annotations of engines started from a spec. If set,
+	// engines naming a spec it doesn't know are rejected. If nil, annotations are not validated.
+	// In StrictAnnotations mode, annotations that aren't arguments of the spec are rejected.
+	EngineSpecs       *SpecScanner
+	StrictAnnotations bool
+
+	// UploadDir is where applications uploaded using StartLocalEngine are extracted to.
+	// If empty, the default directory for temporary files is used.
+	UploadDir    string
+	UploadLimits UploadLimits
+
+	// SubscriberBuffer is the number of events buffered for each Subscribe and Listen call.
+	// SlowSubscribers decides what happens to callers that don't consume events fast enough.
+	SubscriberBuffer int
+	SlowSubscribers  OverflowPolicy
+
+	lifecycle *Lifecycle
+	events    hub
+	scheduler scheduler
+
+	v1.UnimplementedNetServiceServer
+}
+
+var _ v1.NetServiceServer = &Service{}
+var _ Reporter = &Service{}
+
+// StartEngine starts a new engine based on its specification
+func (s *Service) StartEngine(ctx context.Context, req *v1.StartEngineRequest) (*v1.StartEngineResponse, error) {
+	md := req.GetMetadata()
+	if md == nil {
+		return nil, status.Error(codes.InvalidArgument, "metadata is required")
+	}
+	if req.EnginePath == "" && len(req.EngineYaml) == 0 && md.EngineSpecName == "" {
+		return nil, status.Error(codes.InvalidArgument, "either engine path, engine YAML or engine spec name is required")
+	}
+	var (
+		args   []*v1.DesiredAnnotation
+		strict bool
+	)
+	if s.EngineSpecs != nil && md.EngineSpecName != "" {
+		sp, ok := s.EngineSpecs.Lookup(md.Repository, md.EngineSpecName)
+		if !ok {
+			return nil, unknownEngineSpec(md.EngineSpecName)
+		}
+		args, strict = sp.Arguments, s.StrictAnnotations
+	}
+	err := validateAnnotations(md.Annotations, args, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := s.newEngineName(ctx, md, req.NameSuffix)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot name engine: %v", err)
+	}
+
+	spec := StartSpec{
+		EnginePath: req.EnginePath,
+		EngineYAML: req.EngineYaml,
+		Sideload:   req.Sideload,
+	}
+
+	st, err := s.createEngine(ctx, name, md, req.WaitUntil, spec, true)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.StartEngineResponse{Status: st}, nil
+}
+
+// ReplayOfAnnotation is set on replayed engines and names the engine they were replayed from
+const ReplayOfAnnotation = "net/replay-of"
+
+// StartFromPreviousEngine starts a new engine based on a previous one that can be replayed
+func (s *Service) StartFromPreviousEngine(ctx context.Context, req *v1.StartFromPreviousEngineRequest) (*v1.StartEngineResponse, error) {
+	if req.PreviousEngine == "" {
+		return nil, status.Error(codes.InvalidArgument, "previous engine is required")
+	}
+	prev, err := s.getEngine(ctx, req.PreviousEngine)
+	if err != nil {
+		return nil, err
+	}
+	if !prev.GetConditions().GetCanReplay() {
+		return nil, status.Errorf(codes.FailedPrecondition, "engine %s cannot be replayed", prev.Name)
+	}
+
+	spec, err := s.loadSpec(ctx, prev.Name)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.FailedPrecondition, "engine %s has no start spec to replay", prev.Name)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot load start spec of %s: %v", prev.Name, err)
+	}
+	// the application of the previous engine belongs to that engine's executor
+	spec.Application = ""
+
+	md := proto.Clone(prev.Metadata).(*v1.EngineMetadata)
+	annotations := make([]*v1.Annotation, 0, len(md.Annotations)+1)
+	for _, a := range md.Annotations {
+		if a.Key == ReplayOfAnnotation {
+			continue
+		}
+		annotations = append(annotations, a)
+	}
+	md.Annotations = append(annotations, &v1.Annotation{Key: ReplayOfAnnotation, Value: prev.Name})
+
+	if repo := md.GetRepository(); s.Sources != nil && repo.GetRepo() != "" {
+		if repo.Revision == "" && repo.Ref == "" {
+			return nil, status.Errorf(codes.FailedPrecondition, "engine %s has no revision to replay", prev.Name)
+		}
+		dir, err := s.Sources.Fetch(ctx, md.Repository, req.GitopsToken)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "cannot fetch sources of %s: %v", prev.Name, err)
+		}
+		spec.Application = dir
+	}
+
+	name, err := s.newEngineName(ctx, md, "")
+	if err != nil {
+		removeApplication(spec)
+		return nil, status.Errorf(codes.Internal, "cannot name engine: %v", err)
+	}
+
+	st, err := s.createEngine(ctx, name, md, req.WaitUntil, spec, true)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.StartEngineResponse{Status: st}, nil
+}
+
+// StartLocalEngine starts an engine whose specification and application are uploaded by the client
+func (s *Service) StartLocalEngine(srv v1.NetService_StartLocalEngineServer) error {
+	dir, err := os.MkdirTemp(s.UploadDir, "net-upload-")
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot create upload directory: %v", err)
+	}
+
+	upload, err := receiveUpload(srv, dir, s.UploadLimits)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	err = validateAnnotations(upload.Metadata.GetAnnotations(), nil, false)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	ctx := srv.Context()
+	name, err := s.newEngineName(ctx, upload.Metadata, "")
+	if err != nil {
+		os.RemoveAll(dir)
+		return status.Errorf(codes.Internal, "cannot name engine: %v", err)
+	}
+	// we don't keep the application around, hence local engines cannot be replayed
+	st, err := s.createEngine(ctx, name, upload.Metadata, nil, StartSpec{
+		EngineYAML:  upload.EngineYAML,
+		ConfigYAML:  upload.ConfigYAML,
+		Application: dir,
+	}, false)
+	if err != nil {
+		return err
+	}
+
+	return srv.SendAndClose(&v1.StartEngineResponse{Status: st})
+}
+
+// createEngine stores a new engine and either starts it right away or, if waitUntil lies
+// in the future, parks it in PHASE_WAITING until its time has come. The start spec is kept
+// so that the engine can be started later or replayed. createEngine takes ownership of the
+// spec's application directory.
+func (s *Service) createEngine(ctx context.Context, name string, md *v1.EngineMetadata, waitUntil *timestamppb.Timestamp, spec StartSpec, canReplay bool) (*v1.EngineStatus, error) {
+	md = proto.Clone(md).(*v1.EngineMetadata)
+	md.Created = nil
+	md.Finished = nil
+	st := &v1.EngineStatus{
+		Name:       name,
+		Metadata:   md,
+		Phase:      v1.EnginePhase_PHASE_PREPARING,
+		Conditions: &v1.EngineConditions{CanReplay: canReplay},
+	}
+	waiting := waitUntil != nil && waitUntil.AsTime().After(time.Now())
+	if waiting {
+		st.Phase = v1.EnginePhase_PHASE_WAITING
+		st.Conditions.WaitUntil = waitUntil
+	}
+
+	err := s.storeSpec(ctx, name, spec)
+	if err != nil {
+		removeApplication(spec)
+		return nil, status.Errorf(codes.Internal, "cannot store start spec of %s: %v", name, err)
+	}
+	st, err = s.lifecycle.Create(ctx, st)
+	if err != nil {
+		removeApplication(spec)
+		return nil, status.Errorf(codes.Internal, "cannot store engine %s: %v", name, err)
+	}
+
+	if waiting {
+		s.scheduleStart(st)
+		return st, nil
+	}
+
+	err = s.start(ctx, st, spec)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot start engine %s: %v", name, err)
+	}
+	return st, nil
+}
+
+// storeSpec stores the start spec of an engine
+func (s *Service) storeSpec(ctx context.Context, name string, spec StartSpec) error {
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	return s.Specs.Put(ctx, name, raw)
+}
+
+// loadSpec loads the start spec of an engine. If there is none, the error wraps store.ErrNotFound.
+func (s *Service) loadSpec(ctx context.Context, name string) (StartSpec, error) {
+	var spec StartSpec
+	raw, err := s.Specs.Get(ctx, name)
+	if err != nil {
+		return spec, err
+	}
+	err = json.Unmarshal(raw, &spec)
+	return spec, err
+}
+
+// removeApplication removes the application directory of a spec that won't be started
+func removeApplication(spec StartSpec) {
+	if spec.Application == "" {
+		return
+	}
+	err := os.RemoveAll(spec.Application)
+	if err != nil {
+		log.WithError(err).WithField("dir", spec.Application).Warn("cannot remove application")
+	}
+}
+
+// start hands an engine in PHASE_PREPARING to the executor. If that fails, the engine is marked as failed.
+// Unless the executor takes it, the spec's application directory is removed.
+func (s *Service) start(ctx context.Context, st *v1.EngineStatus, spec StartSpec) error {
+	if s.Executor == nil {
+		removeApplication(spec)
+		return nil
+	}
+
+	err := s.Executor.Start(context.Background(), proto.Clone(st).(*v1.EngineStatus), spec, s)
+	if err != nil {
+		removeApplication(spec)
+		log.WithError(err).WithField("name", st.Name).Error("cannot start engine")
+		s.failEngine(ctx, st.Name, fmt.Sprintf("cannot start engine: %v", err))
+		return err
+	}
+	return nil
+}
+
+// newEngineName produces a unique, human-readable name for a new engine
+func (s *Service) newEngineName(ctx context.Context, md *v1.EngineMetadata, suffix string) (string, error) {
+	var parts []string
+	if repo := md.GetRepository(); repo.GetRepo() != "" {
+		parts = append(parts, repo.Repo)
+		if md.EngineSpecName != "" {
+			parts = append(parts, md.EngineSpecName)
+		} else if ref := strings.TrimPrefix(repo.Ref, "refs/heads/"); ref != "" {
+			parts = append(parts, ref)
+		}
+	} else if md.EngineSpecName != "" {
+		parts = append(parts, md.EngineSpecName)
+	}
+	if suffix != "" {
+		parts = append(parts, suffix)
+	}
+	if len(parts) == 0 {
+		parts = []string{"engine"}
+	}
+
+	group := sanitizeName(strings.Join(parts, "-"))
+	n, err := s.Engines.NextNumber(ctx, group)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%d", group, n), nil
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9\-]+`)
+
+// sanitizeName turns a string into something we can use in an engine name
+func sanitizeName(name string) string {
+	name = strings.ToLower(name)
+	name = invalidNameChars.ReplaceAllString(name, "-")
+	return strings.Trim(name, "-")
+}
+
+// markFailed moves an engine to PHASE_DONE and marks it as failed
+func (s *Service) markFailed(ctx context.Context, name string, details string) (*v1.EngineStatus, error) {
+	return s.lifecycle.Update(ctx, name, func(st *v1.EngineStatus) error {
+		st.Phase = v1.EnginePhase_PHASE_DONE
+		st.Details = details
+		if st.Conditions == nil {
+			st.Conditions = &v1.EngineConditions{}
+		}
+		st.Conditions.FailureCount++
+		return nil
+	})
+}
+
+// failEngine marks an engine as failed and logs if that's not possible
+func (s *Service) failEngine(ctx context.Context, name string, details string) {
+	_, err := s.markFailed(ctx, name, details)
+	if err != nil {
+		log.WithError(err).WithField("name", name).Warn("cannot mark engine as failed")
+	}
+}
+
+// lifecycleError translates errors returned by the lifecycle to gRPC status errors
+func lifecycleError(name string, err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return status.Errorf(codes.NotFound, "engine %s not found", name)
+	case errors.Is(err, ErrIllegalTransition), errors.Is(err, ErrInvalidConditions):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Errorf(codes.Internal, "cannot update engine %s: %v", name, err)
+	}
+}
+
+// GetEngine retrieves details of a single engine
+func (s *Service) GetEngine(ctx context.Context, req *v1.GetEngineRequest) (*v1.GetEngineResponse, error) {
+	st, err := s.getEngine(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.GetEngineResponse{Result: st}, nil
+}
+
+// getEngine retrieves an engine from the store and translates store errors to gRPC status errors
+func (s *Service) getEngine(ctx context.Context, name string) (*v1.EngineStatus, error) {
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	st, err := s.Engines.Get(ctx, name)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "engine %s not found", name)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get engine %s: %v", name, err)
+	}
+	return st, nil
+}
+
+// ListEngines searches for engines known to this service
+func (s *Service) ListEngines(ctx context.Context, req *v1.ListEnginesRequest) (*v1.ListEnginesResponse, error) {
+	if req.Start < 0 {
+		return nil, status.Error(codes.InvalidArgument, "start must not be negative")
+	}
+	err := filterexpr.Validate(req.Filter, req.Order)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	res, total, err := s.Engines.Find(ctx, req.Filter, req.Order, int(req.Start), limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list engines: %v", err)
+	}
+
+	return &v1.ListEnginesResponse{
+		Total:  int32(total),
+		Result: res,
+	}, nil
+}
+
+// Subscribe streams status updates of all engines matching the filter
+func (s *Service) Subscribe(req *v1.SubscribeRequest, srv v1.NetService_SubscribeServer) error {
+	err := filterexpr.Validate(req.Filter, nil)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sub := s.events.subscribe(s.SubscriberBuffer, s.SlowSubscribers, func(evt event) bool {
+		return evt.Status != nil && filterexpr.MatchesFilter(evt.Status, req.Filter)
+	})
+	defer sub.Close()
+
+	ctx := srv.Context()
+	send := func(st *v1.EngineStatus) error {
+		return srv.Send(&v1.SubscribeResponse{Result: st})
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.Evicted:
+			return status.Error(codes.ResourceExhausted, "subscriber is too slow")
+		case evt := <-sub.Events:
+			err := send(evt.Status)
+			if err != nil {
+				return err
+			}
+		case <-sub.Resync:
+			// Send what's buffered first, so that we never send an outdated status after a current one.
+			for n := len(sub.Events); n > 0; n-- {
+				err := send((<-sub.Events).Status)
+				if err != nil {
+					return err
+				}
+			}
+			for _, name := range sub.Missed() {
+				st, err := s.Engines.Get(ctx, name)
+				if errors.Is(err, store.ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return status.Errorf(codes.Internal, "cannot get engine %s: %v", name, err)
+				}
+				if !filterexpr.MatchesFilter(st, req.Filter) {
+					continue
+				}
+				err = send(st)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// Listen streams the status updates and log output of a single engine
+func (s *Service) Listen(req *v1.ListenRequest, srv v1.NetService_ListenServer) error {
+	withLogs := req.Logs != v1.ListenRequestLogs_LOGS_DISABLED
+	// each slice has its own renderer so that styles don't bleed into other slices
+	renderers := make(map[string]*logs.HTMLRenderer)
+	send := func(evt *v1.LogSliceEvent) error {
+		switch req.Logs {
+		case v1.ListenRequestLogs_LOGS_UNSLICED:
+			evt = logs.Flatten(evt)
+			if evt == nil {
+				return nil
+			}
+		case v1.ListenRequestLogs_LOGS_HTML:
+			r, ok := renderers[evt.Name]
+			if !ok {
+				r = &logs.HTMLRenderer{}
+				renderers[evt.Name] = r
+			}
+			evt = &v1.LogSliceEvent{Name: evt.Name, Type: evt.Type, Payload: r.Render(evt.Payload)}
+		}
+		return srv.Send(&v1.ListenResponse{Content: &v1.ListenResponse_Slice{Slice: evt}})
+	}
+
+	// We subscribe before reading the current state so that we don't miss anything
+	// that happens in between. Duplicates are weeded out using the log sequence number.
+	sub := s.events.subscribe(s.SubscriberBuffer, s.SlowSubscribers, func(evt event) bool {
+		return evt.engineName() == req.Name
+	})
+	defer sub.Close()
+
+	ctx := srv.Context()
+	st, err := s.getEngine(ctx, req.Name)
+	if err != nil {
+		return err
+	}
+	sendUpdate := func(st *v1.EngineStatus) error {
+		if !req.Updates {
+			return nil
+		}
+		return srv.Send(&v1.ListenResponse{Content: &v1.ListenResponse_Update{Update: st}})
+	}
+	err = sendUpdate(st)
+	if err != nil {
+		return err
+	}
+
+	var next int
+	sendLogs := func() error {
+		if !withLogs {
+			return nil
+		}
+
+		evts, err := s.Logs.Read(ctx, req.Name, next)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot read logs of %s: %v", req.Name, err)
+		}
+		for _, evt := range evts {
+			err = send(evt)
+			if err != nil {
+				return err
+			}
+			next++
+		}
+		return nil
+	}
+	err = sendLogs()
+	if err != nil {
+		return err
+	}
+	if st.Phase == v1.EnginePhase_PHASE_DONE {
+		return nil
+	}
+
+	// handle processes a single event and returns true once the engine is done
+	handle := func(evt event) (done bool, err error) {
+		switch {
+		case evt.Log != nil && withLogs:
+			if evt.Log.Seq < next {
+				// we've sent this one already
+				return false, nil
+			}
+			if evt.Log.Seq > next {
+				// we've missed some events - catch up from the store
+				return false, sendLogs()
+			}
+
+			err = send(evt.Log.Event)
+			if err != nil {
+				return false, err
+			}
+			next++
+
+		case evt.Status != nil:
+			err = sendUpdate(evt.Status)
+			if err != nil {
+				return false, err
+			}
+			if evt.Status.Phase == v1.EnginePhase_PHASE_DONE {
+				// make sure we send all the log output produced before the engine finished
+				return true, sendLogs()
+			}
+		}
+		return false, nil
+	}
+
+	for {
+		var (
+			done bool
+			err  error
+		)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.Evicted:
+			return status.Error(codes.ResourceExhausted, "listener is too slow")
+		case evt := <-sub.Events:
+			done, err = handle(evt)
+		case <-sub.Resync:
+			for n := len(sub.Events); n > 0 && !done && err == nil; n-- {
+				done, err = handle(<-sub.Events)
+			}
+			if done || err != nil || len(sub.Missed()) == 0 {
+				break
+			}
+
+			// we've missed events - catch up from the store
+			st, err = s.getEngine(ctx, req.Name)
+			if err == nil {
+				done, err = handle(event{Status: st})
+			}
+			if err == nil && !done {
+				err = sendLogs()
+			}
+		}
+		if done || err != nil {
+			return err
+		}
+	}
+}
+
+// SubscriberStats returns statistics on how well Subscribe and Listen callers keep up with engine events
+func (s *Service) SubscriberStats() SubscriberStats {
+	return s.events.stats()
+}
+
+// StopEngine stops a currently running engine
+func (s *Service) StopEngine(ctx context.Context, req *v1.StopEngineRequest) (*v1.StopEngineResponse, error) {
+	st, err := s.getEngine(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if st.Phase == v1.EnginePhase_PHASE_DONE {
+		return nil, status.Errorf(codes.FailedPrecondition, "engine %s is done already", req.Name)
+	}
+	if st.Phase == v1.EnginePhase_PHASE_WAITING {
+		err = s.cancelWaiting(ctx, req.Name, "cancelled by user")
+		if err == nil {
+			return &v1.StopEngineResponse{}, nil
+		}
+		if !errors.Is(err, errNotWaiting) {
+			return nil, lifecycleError(req.Name, err)
+		}
+		// the engine has started in the meantime - stop it like any other engine
+	}
+
+	if s.Executor != nil {
+		err = s.Executor.Stop(req.Name, "stopped by user")
+		if err == nil {
+			return &v1.StopEngineResponse{}, nil
+		}
+		if !errors.Is(err, ErrNotRunning) {
+			return nil, status.Errorf(codes.Internal, "cannot stop engine %s: %v", req.Name, err)
+		}
+		// nobody runs the engine who could report it as done
+	}
+
+	_, err = s.markFailed(ctx, req.Name, "stopped by user")
+	if err != nil {
+		return nil, lifecycleError(req.Name, err)
+	}
+	return &v1.StopEngineResponse{}, nil
+}
+
+// UpdateStatus replaces the status of an engine and notifies all listeners.
+// Updates that violate the engine lifecycle are rejected.
+func (s *Service) UpdateStatus(ctx context.Context, st *v1.EngineStatus) error {
+	_, err := s.lifecycle.Update(ctx, st.Name, func(current *v1.EngineStatus) error {
+		proto.Reset(current)
+		proto.Merge(current, st)
+		return nil
+	})
+	return err
+}
+
+// appendLog stores a log event and notifies all listeners
+func (s *Service) appendLog(ctx context.Context, name string, evt *v1.LogSliceEvent) error {
+	seq, err := s.Logs.Append(ctx, name, evt)
+	if err != nil {
+		return err
+	}
+
+	s.events.publish(event{Log: &logEvent{Name: name, Seq: seq, Event: evt}})
+	return nil
+}
+
+// Output returns a writer that receives the raw log output of an engine.
+// The output is sliced using the in-band markers understood by logs.Slicer.
+func (s *Service) Output(name string) io.WriteCloser {
+	return &lineWriter{
+		Name:    name,
+		Service: s,
+	}
+}
+
+// lineWriter turns raw engine output into log events, one per line
+type lineWriter struct {
+	Name    string
+	Service *Service
+
+	buf    bytes.Buffer
+	slicer logs.Slicer
+	mu     sync.Mutex
+}
+
+// Write implements io.Writer
+func (w *lineWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, _ = w.buf.Write(p)
+	for {
+		idx := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if idx < 0 {
+			return n, nil
+		}
+
+		line := string(w.buf.Next(idx + 1))
+		err = w.emit(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close flushes the remaining incomplete line and abandons all unfinished slices
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() > 0 {
+		line := w.buf.String()
+		w.buf.Reset()
+		err := w.emit(line)
+		if err != nil {
+			return err
+		}
+	}
+	for _, evt := range w.slicer.Close() {
+		err := w.Service.appendLog(context.Background(), w.Name, evt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *lineWriter) emit(line string) error {
+	return w.Service.appendLog(context.Background(), w.Name, w.slicer.Slice(line))
+}
@@ -0,0 +1,358 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// startTestService serves a service backed by in-memory stores and returns a client talking to it
+func startTestService(t *testing.T, executor Executor, opts ...grpc.ServerOption) (*Service, v1.NetServiceClient) {
+	service := NewService(store.NewInMemoryEngineStore(), store.NewInMemoryLogStore(), executor)
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(opts...)
+	v1.RegisterNetServiceServer(srv, service)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatalf("cannot dial test service: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return service, v1.NewNetServiceClient(conn)
+}
+
+func startEngine(t *testing.T, client v1.NetServiceClient, repo string) *v1.EngineStatus {
+	resp, err := client.StartEngine(context.Background(), &v1.StartEngineRequest{
+		Metadata: &v1.EngineMetadata{
+			Owner:      "tester",
+			Repository: &v1.Repository{Host: "github.com", Owner: "bhojpur", Repo: repo, Ref: "refs/heads/main"},
+			Trigger:    v1.EngineTrigger_TRIGGER_MANUAL,
+		},
+		EnginePath: "net/build.yaml",
+	})
+	if err != nil {
+		t.Fatalf("StartEngine: %v", err)
+	}
+	return resp.Status
+}
+
+func TestStartAndGetEngine(t *testing.T) {
+	_, client := startTestService(t, nil)
+
+	first := startEngine(t, client, "Net")
+	second := startEngine(t, client, "Net")
+	if first.Name != "net-main.1" || second.Name != "net-main.2" {
+		t.Errorf("unexpected engine names: %s, %s", first.Name, second.Name)
+	}
+	if first.Phase != v1.EnginePhase_PHASE_PREPARING {
+		t.Errorf("new engine is in phase %v, expected PREPARING", first.Phase)
+	}
+
+	resp, err := client.GetEngine(context.Background(), &v1.GetEngineRequest{Name: first.Name})
+	if err != nil {
+		t.Fatalf("GetEngine: %v", err)
+	}
+	if resp.Result.Metadata.Owner != "tester" {
+		t.Errorf("unexpected owner %q", resp.Result.Metadata.Owner)
+	}
+
+	_, err = client.GetEngine(context.Background(), &v1.GetEngineRequest{Name: "does-not-exist.1"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+}
+
+func TestListEnginesPagination(t *testing.T) {
+	_, client := startTestService(t, nil)
+	for i := 0; i < 5; i++ {
+		startEngine(t, client, "net")
+	}
+
+	resp, err := client.ListEngines(context.Background(), &v1.ListEnginesRequest{Start: 3, Limit: 10})
+	if err != nil {
+		t.Fatalf("ListEngines: %v", err)
+	}
+	if resp.Total != 5 {
+		t.Errorf("expected total of 5, got %d", resp.Total)
+	}
+	if len(resp.Result) != 2 {
+		t.Errorf("expected 2 results, got %d", len(resp.Result))
+	}
+}
+
+func TestStopEngineWithoutExecutor(t *testing.T) {
+	_, client := startTestService(t, nil)
+	st := startEngine(t, client, "net")
+
+	_, err := client.StopEngine(context.Background(), &v1.StopEngineRequest{Name: st.Name})
+	if err != nil {
+		t.Fatalf("StopEngine: %v", err)
+	}
+
+	resp, err := client.GetEngine(context.Background(), &v1.GetEngineRequest{Name: st.Name})
+	if err != nil {
+		t.Fatalf("GetEngine: %v", err)
+	}
+	if resp.Result.Phase != v1.EnginePhase_PHASE_DONE || resp.Result.Conditions.Success {
+		t.Errorf("stopped engine should be done and unsuccessful: %v", resp.Result)
+	}
+
+	_, err = client.StopEngine(context.Background(), &v1.StopEngineRequest{Name: st.Name})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition when stopping a done engine, got %v", err)
+	}
+}
+
+// fakeSources records the tokens it was asked to fetch with
+type fakeSources struct {
+	tokens []string
+}
+
+func (f *fakeSources) Fetch(ctx context.Context, repo *v1.Repository, token string) (string, error) {
+	f.tokens = append(f.tokens, token)
+	return os.MkdirTemp("", "net-test-sources-")
+}
+
+func TestStartFromPreviousEngine(t *testing.T) {
+	executor := &recordingExecutor{started: make(chan StartSpec, 2)}
+	service, client := startTestService(t, executor)
+	sources := &fakeSources{}
+	service.Sources = sources
+	ctx := context.Background()
+
+	resp, err := client.StartEngine(ctx, &v1.StartEngineRequest{
+		Metadata: &v1.EngineMetadata{
+			Owner:          "tester",
+			Repository:     &v1.Repository{Host: "github.com", Owner: "bhojpur", Repo: "net", Ref: "refs/heads/main", Revision: "abc123"},
+			Trigger:        v1.EngineTrigger_TRIGGER_PUSH,
+			EngineSpecName: "build",
+			Annotations:    []*v1.Annotation{{Key: "env", Value: "staging"}},
+		},
+		EnginePath: "net/build.yaml",
+	})
+	if err != nil {
+		t.Fatalf("StartEngine: %v", err)
+	}
+	prev := resp.Status
+	<-executor.started
+
+	resp, err = client.StartFromPreviousEngine(ctx, &v1.StartFromPreviousEngineRequest{PreviousEngine: prev.Name, GitopsToken: "secret"})
+	if err != nil {
+		t.Fatalf("StartFromPreviousEngine: %v", err)
+	}
+	replay := resp.Status
+	if replay.Name == prev.Name || !replay.Conditions.CanReplay {
+		t.Errorf("unexpected replay: %v", replay)
+	}
+	if !proto.Equal(replay.Metadata.Repository, prev.Metadata.Repository) || replay.Metadata.EngineSpecName != "build" || replay.Metadata.Trigger != v1.EngineTrigger_TRIGGER_PUSH {
+		t.Errorf("replay did not copy the metadata: %v", replay.Metadata)
+	}
+	expectedAnnotations := []*v1.Annotation{{Key: "env", Value: "staging"}, {Key: ReplayOfAnnotation, Value: prev.Name}}
+	if act := replay.Metadata.Annotations; len(act) != len(expectedAnnotations) || !proto.Equal(act[0], expectedAnnotations[0]) || !proto.Equal(act[1], expectedAnnotations[1]) {
+		t.Errorf("unexpected annotations: %v", act)
+	}
+	if fmt.Sprint(sources.tokens) != "[secret]" {
+		t.Errorf("gitops token was not passed to the source fetcher: %v", sources.tokens)
+	}
+	spec := <-executor.started
+	if spec.EnginePath != "net/build.yaml" || spec.Application == "" {
+		t.Errorf("unexpected start spec: %+v", spec)
+	}
+	os.RemoveAll(spec.Application)
+
+	// replaying a replay points to the replay only
+	resp, err = client.StartFromPreviousEngine(ctx, &v1.StartFromPreviousEngineRequest{PreviousEngine: replay.Name})
+	if err != nil {
+		t.Fatalf("StartFromPreviousEngine: %v", err)
+	}
+	expectedAnnotations = []*v1.Annotation{{Key: "env", Value: "staging"}, {Key: ReplayOfAnnotation, Value: replay.Name}}
+	if act := resp.Status.Metadata.Annotations; len(act) != len(expectedAnnotations) || !proto.Equal(act[0], expectedAnnotations[0]) || !proto.Equal(act[1], expectedAnnotations[1]) {
+		t.Errorf("unexpected annotations of replayed replay: %v", act)
+	}
+	spec = <-executor.started
+	os.RemoveAll(spec.Application)
+
+	_, err = service.lifecycle.Create(ctx, &v1.EngineStatus{Name: "local.1", Phase: v1.EnginePhase_PHASE_PREPARING})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.StartFromPreviousEngine(ctx, &v1.StartFromPreviousEngineRequest{PreviousEngine: "local.1"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition for engine that cannot be replayed, got %v", err)
+	}
+
+	resp, err = client.StartEngine(ctx, &v1.StartEngineRequest{
+		Metadata: &v1.EngineMetadata{
+			Owner:      "tester",
+			Repository: &v1.Repository{Host: "github.com", Owner: "bhojpur", Repo: "net"},
+		},
+		EnginePath: "net/build.yaml",
+	})
+	if err != nil {
+		t.Fatalf("StartEngine: %v", err)
+	}
+	<-executor.started
+	_, err = client.StartFromPreviousEngine(ctx, &v1.StartFromPreviousEngineRequest{PreviousEngine: resp.Status.Name, GitopsToken: "secret"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition for engine without revision, got %v", err)
+	}
+	if len(sources.tokens) != 2 {
+		t.Errorf("sources of engine without revision were fetched: %v", sources.tokens)
+	}
+}
+
+func TestListenFollowsEngine(t *testing.T) {
+	service, client := startTestService(t, nil)
+	st := startEngine(t, client, "net")
+
+	out := service.Output(st.Name)
+	io.WriteString(out, "first line\nsecond ")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.Listen(ctx, &v1.ListenRequest{Name: st.Name, Updates: true, Logs: v1.ListenRequestLogs_LOGS_RAW})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	// wait for the initial status so that we know the listener is set up
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if msg.GetUpdate() == nil {
+		t.Fatalf("expected status update first, got %v", msg)
+	}
+
+	io.WriteString(out, "line\n")
+	out.Close()
+	done := proto.Clone(st).(*v1.EngineStatus)
+	done.Phase = v1.EnginePhase_PHASE_DONE
+	service.UpdateStatus(context.Background(), done)
+
+	var lines []string
+	var phases []v1.EnginePhase
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		if s := msg.GetSlice(); s != nil {
+			lines = append(lines, s.Payload)
+		}
+		if u := msg.GetUpdate(); u != nil {
+			phases = append(phases, u.Phase)
+		}
+	}
+
+	if len(lines) != 2 || lines[0] != "first line" || lines[1] != "second line" {
+		t.Errorf("unexpected log lines: %q", lines)
+	}
+	if len(phases) != 1 || phases[0] != v1.EnginePhase_PHASE_DONE {
+		t.Errorf("unexpected status updates: %v", phases)
+	}
+}
+
+func TestListenLogModes(t *testing.T) {
+	service, client := startTestService(t, nil)
+	st := startEngine(t, client, "net")
+
+	out := service.Output(st.Name)
+	io.WriteString(out, "[build|PHASE] Building\n[build|START]\n[build] compiling\n[test|START]\n[test] testing\n[build|DONE]\n")
+	out.Close()
+	_, err := service.markFailed(context.Background(), st.Name, "engine died")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listen := func(mode v1.ListenRequestLogs) []string {
+		stream, err := client.Listen(context.Background(), &v1.ListenRequest{Name: st.Name, Logs: mode})
+		if err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		var res []string
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				return res
+			}
+			if err != nil {
+				t.Fatalf("Recv: %v", err)
+			}
+			s := msg.GetSlice()
+			res = append(res, s.Name+"|"+s.Type.String()+"|"+s.Payload)
+		}
+	}
+
+	raw := listen(v1.ListenRequestLogs_LOGS_RAW)
+	expectedRaw := []string{
+		"build|SLICE_PHASE|Building",
+		"build|SLICE_START|",
+		"build|SLICE_CONTENT|compiling",
+		"test|SLICE_START|",
+		"test|SLICE_CONTENT|testing",
+		"build|SLICE_DONE|",
+		"test|SLICE_ABANDONED|",
+	}
+	if fmt.Sprint(raw) != fmt.Sprint(expectedRaw) {
+		t.Errorf("unexpected raw logs:\nexpected: %q\n  actual: %q", expectedRaw, raw)
+	}
+
+	unsliced := listen(v1.ListenRequestLogs_LOGS_UNSLICED)
+	expectedUnsliced := []string{
+		"|SLICE_CONTENT|phase build: Building",
+		"|SLICE_CONTENT|compiling",
+		"|SLICE_CONTENT|testing",
+		"|SLICE_CONTENT|test was abandoned",
+	}
+	if fmt.Sprint(unsliced) != fmt.Sprint(expectedUnsliced) {
+		t.Errorf("unexpected unsliced logs:\nexpected: %q\n  actual: %q", expectedUnsliced, unsliced)
+	}
+
+	html := listen(v1.ListenRequestLogs_LOGS_HTML)
+	if fmt.Sprint(html) != fmt.Sprint(expectedRaw) {
+		t.Errorf("HTML logs should keep the slices:\nexpected: %q\n  actual: %q", expectedRaw, html)
+	}
+}
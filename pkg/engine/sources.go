@@ -0,0 +1,100 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+// SourceFetcher fetches the sources of an engine's repository
+type SourceFetcher interface {
+	// Fetch checks out the repository at its revision, or its ref if the revision is unknown,
+	// into a new directory. The token may be empty and is used to authenticate with the host.
+	// The caller owns the returned directory.
+	Fetch(ctx context.Context, repo *v1.Repository, token string) (dir string, err error)
+}
+
+// GitSourceFetcher fetches sources using the git command line client
+type GitSourceFetcher struct {
+	// BaseDir is where checkouts are created. If empty, the default directory for temporary files is used.
+	BaseDir string
+}
+
+var _ SourceFetcher = GitSourceFetcher{}
+
+// Fetch performs a shallow fetch of a single revision over HTTPS
+func (f GitSourceFetcher) Fetch(ctx context.Context, repo *v1.Repository, token string) (dir string, err error) {
+	rev := repo.GetRevision()
+	if rev == "" {
+		rev = repo.GetRef()
+	}
+	if repo.GetHost() == "" || repo.GetOwner() == "" || repo.GetRepo() == "" || rev == "" {
+		return "", fmt.Errorf("incomplete repository: %v", repo)
+	}
+
+	dir, err = os.MkdirTemp(f.BaseDir, "net-sources-")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+			dir = ""
+		}
+	}()
+
+	// the token is passed through the environment so that it does not show up in the process list
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if token != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+		)
+	}
+
+	url := fmt.Sprintf("https://%s/%s/%s", repo.Host, repo.Owner, repo.Repo)
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth", "1", url, rev},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		cmd.Env = env
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	return dir, nil
+}
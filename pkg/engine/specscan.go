@@ -0,0 +1,198 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/local"
+	"github.com/bhojpur/net/pkg/spec"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultScanInterval is how often a SpecScanner checks its checkouts for changes
+const DefaultScanInterval = 30 * time.Second
+
+// SpecScanner finds the engine specs in local repository checkouts. Every .yaml or .yml file in
+// a checkout's net directory, except the config, is considered an engine spec.
+type SpecScanner struct {
+	// Checkouts are the directories of the repository checkouts to scan
+	Checkouts []string
+
+	// Interval is how often Run checks the checkouts for changes. Defaults to DefaultScanInterval.
+	Interval time.Duration
+
+	mu          sync.RWMutex
+	specs       []*v1.ListEngineSpecsResponse
+	fingerprint string
+}
+
+// Specs returns the engine specs found during the last scan
+func (s *SpecScanner) Specs() []*v1.ListEngineSpecsResponse {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make([]*v1.ListEngineSpecsResponse, len(s.specs))
+	for i, sp := range s.specs {
+		res[i] = proto.Clone(sp).(*v1.ListEngineSpecsResponse)
+	}
+	return res
+}
+
+// Lookup finds an engine spec by name. If repo is given, only specs of that repository are considered.
+func (s *SpecScanner) Lookup(repo *v1.Repository, name string) (*v1.ListEngineSpecsResponse, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, sp := range s.specs {
+		if sp.Name != name {
+			continue
+		}
+		if repo.GetRepo() != "" && (sp.Repo.GetHost() != repo.Host || sp.Repo.GetOwner() != repo.Owner || sp.Repo.GetRepo() != repo.Repo) {
+			continue
+		}
+		return proto.Clone(sp).(*v1.ListEngineSpecsResponse), true
+	}
+	return nil, false
+}
+
+// Run scans the checkouts and re-scans them whenever their engine specs change, until the context is done
+func (s *SpecScanner) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultScanInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := s.Scan()
+		if err != nil {
+			log.WithError(err).Warn("cannot scan engine specs")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan re-reads the engine specs if any of them changed since the last scan and reports whether they did
+func (s *SpecScanner) Scan() (changed bool, err error) {
+	files, fingerprint, err := s.specFiles()
+	if err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	changed = fingerprint != s.fingerprint
+	s.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	var specs []*v1.ListEngineSpecsResponse
+	repos := make(map[string]*v1.Repository)
+	for _, f := range files {
+		content, err := os.ReadFile(filepath.Join(f.Checkout, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return false, err
+		}
+		eng, err := spec.ParseEngine(content)
+		if err != nil {
+			log.WithError(err).WithField("checkout", f.Checkout).WithField("path", f.Path).Warn("skipping invalid engine spec")
+			continue
+		}
+
+		repo, ok := repos[f.Checkout]
+		if !ok {
+			repo = local.Repository(f.Checkout)
+			repos[f.Checkout] = repo
+		}
+		args := make([]*v1.DesiredAnnotation, 0, len(eng.Args))
+		for _, arg := range eng.Args {
+			args = append(args, &v1.DesiredAnnotation{
+				Name:        arg.Name,
+				Required:    arg.Required,
+				Description: arg.Description,
+			})
+		}
+		specs = append(specs, &v1.ListEngineSpecsResponse{
+			Repo:        repo,
+			Name:        spec.EngineName(f.Path),
+			Path:        f.Path,
+			Description: eng.Description,
+			Arguments:   args,
+		})
+	}
+
+	s.mu.Lock()
+	s.specs = specs
+	s.fingerprint = fingerprint
+	s.mu.Unlock()
+	log.WithField("count", len(specs)).Debug("scanned engine specs")
+	return true, nil
+}
+
+type specFile struct {
+	Checkout string
+	Path     string
+}
+
+// specFiles lists the engine spec files of all checkouts. The fingerprint changes whenever
+// a spec file is added, removed or modified.
+func (s *SpecScanner) specFiles() (files []specFile, fingerprint string, err error) {
+	var fp strings.Builder
+	for _, checkout := range s.Checkouts {
+		entries, err := os.ReadDir(filepath.Join(checkout, spec.Dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, e := range entries {
+			p := path.Join(spec.Dir, e.Name())
+			ext := path.Ext(p)
+			if !e.Type().IsRegular() || (ext != ".yaml" && ext != ".yml") || p == spec.ConfigPath {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				return nil, "", err
+			}
+			files = append(files, specFile{Checkout: checkout, Path: p})
+			fmt.Fprintf(&fp, "%s\x00%s\x00%d\x00%d\n", checkout, p, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return files, fp.String(), nil
+}
@@ -0,0 +1,86 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpecScanner(t *testing.T) {
+	checkout := t.TempDir()
+	write := func(name, content string) {
+		fn := filepath.Join(checkout, "net", name)
+		err := os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(fn, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("config.yaml", "defaultEngine: build\n")
+	write("build.yaml", "desc: Builds the application\nargs:\n- name: version\n  req: true\n")
+	write("broken.yaml", "args: nope\n")
+	write("README.md", "not a spec")
+
+	scanner := &SpecScanner{Checkouts: []string{checkout, filepath.Join(checkout, "missing")}}
+	changed, err := scanner.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("first scan should report a change")
+	}
+	specs := scanner.Specs()
+	if len(specs) != 1 {
+		t.Fatalf("expected a single engine spec, got %v", specs)
+	}
+	if sp := specs[0]; sp.Name != "build" || sp.Path != "net/build.yaml" || sp.Description != "Builds the application" ||
+		len(sp.Arguments) != 1 || sp.Arguments[0].Name != "version" || !sp.Arguments[0].Required {
+		t.Errorf("unexpected engine spec: %v", sp)
+	}
+
+	changed, err = scanner.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("scan without changes should not report a change")
+	}
+
+	write("deploy.yml", "desc: Deploys the application\n")
+	// make sure the modification is visible even on file systems with coarse timestamps
+	err = os.Chtimes(filepath.Join(checkout, "net", "deploy.yml"), time.Now(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err = scanner.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || len(scanner.Specs()) != 2 {
+		t.Errorf("scan should pick up new engine spec, got %v", scanner.Specs())
+	}
+}
@@ -0,0 +1,60 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+// UIService implements the NetUI gRPC API
+type UIService struct {
+	// Specs provides the engine specs listed by ListEngineSpecs. If nil, no specs are listed.
+	Specs *SpecScanner
+
+	// ReadOnly is reported by IsReadOnly. It does not prevent any changes by itself,
+	// see ReadOnlyUnaryInterceptor and ReadOnlyStreamInterceptor for that.
+	ReadOnly bool
+
+	v1.UnimplementedNetUIServer
+}
+
+var _ v1.NetUIServer = &UIService{}
+
+// ListEngineSpecs returns the engine specs found in the scanned repository checkouts
+func (s *UIService) ListEngineSpecs(req *v1.ListEngineSpecsRequest, srv v1.NetUI_ListEngineSpecsServer) error {
+	if s.Specs == nil {
+		return nil
+	}
+	for _, sp := range s.Specs.Specs() {
+		err := srv.Send(sp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsReadOnly returns true if the server does not allow starting or stopping engines
+func (s *UIService) IsReadOnly(ctx context.Context, req *v1.IsReadOnlyRequest) (*v1.IsReadOnlyResponse, error) {
+	return &v1.IsReadOnlyResponse{Readonly: s.ReadOnly}, nil
+}
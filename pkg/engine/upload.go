@@ -0,0 +1,426 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UploadLimits restricts the size of engines started using StartLocalEngine
+type UploadLimits struct {
+	// MaxYAMLSize is the maximum size of the config and engine YAML in bytes
+	MaxYAMLSize int64
+	// MaxArchiveSize is the maximum size of the gzipped application tar in bytes
+	MaxArchiveSize int64
+	// MaxApplicationSize is the maximum size of all files in the application tar in bytes
+	MaxApplicationSize int64
+	// MaxEntries is the maximum number of entries in the application tar
+	MaxEntries int
+}
+
+// DefaultUploadLimits are the upload limits used unless configured otherwise
+var DefaultUploadLimits = UploadLimits{
+	MaxYAMLSize:        1 << 20,
+	MaxArchiveSize:     100 << 20,
+	MaxApplicationSize: 500 << 20,
+	MaxEntries:         100000,
+}
+
+// localUpload is everything a client sent as part of StartLocalEngine, except for the
+// application which was extracted to disk
+type localUpload struct {
+	Metadata   *v1.EngineMetadata
+	ConfigYAML []byte
+	EngineYAML []byte
+}
+
+// upload stages in the order in which clients must send them
+const (
+	uploadMetadata = iota + 1
+	uploadConfig
+	uploadEngine
+	uploadApplication
+	uploadDone
+)
+
+var uploadStageNames = map[int]string{
+	uploadMetadata:    "metadata",
+	uploadConfig:      "config_yaml",
+	uploadEngine:      "engine_yaml",
+	uploadApplication: "application_tar",
+	uploadDone:        "application_tar_done",
+}
+
+// receiveUpload reads a StartLocalEngine stream and extracts the application to dir.
+// Messages must arrive in the order documented in the API: metadata, config_yaml,
+// engine_yaml, application_tar, application_tar_done. The YAML and tar content may be
+// split across several messages. All errors returned are gRPC status errors.
+func receiveUpload(srv v1.NetService_StartLocalEngineServer, dir string, limits UploadLimits) (*localUpload, error) {
+	var (
+		res   localUpload
+		stage int
+		app   *applicationWriter
+	)
+	defer func() {
+		if app != nil {
+			app.Abort()
+		}
+	}()
+
+	for {
+		req, err := srv.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var next int
+		switch req.Content.(type) {
+		case *v1.StartLocalEngineRequest_Metadata:
+			next = uploadMetadata
+		case *v1.StartLocalEngineRequest_ConfigYaml:
+			next = uploadConfig
+		case *v1.StartLocalEngineRequest_EngineYaml:
+			next = uploadEngine
+		case *v1.StartLocalEngineRequest_ApplicationTar:
+			next = uploadApplication
+		case *v1.StartLocalEngineRequest_ApplicationTarDone:
+			next = uploadDone
+		default:
+			return nil, status.Error(codes.InvalidArgument, "received a message without content")
+		}
+		switch {
+		case stage == 0 && next != uploadMetadata:
+			return nil, status.Errorf(codes.FailedPrecondition, "expected metadata first, received %s", uploadStageNames[next])
+		case stage == uploadDone:
+			return nil, status.Errorf(codes.FailedPrecondition, "received %s after application_tar_done", uploadStageNames[next])
+		case next < stage, next == stage && next == uploadMetadata:
+			return nil, status.Errorf(codes.FailedPrecondition, "received %s after %s", uploadStageNames[next], uploadStageNames[stage])
+		}
+		stage = next
+
+		switch c := req.Content.(type) {
+		case *v1.StartLocalEngineRequest_Metadata:
+			res.Metadata = c.Metadata
+		case *v1.StartLocalEngineRequest_ConfigYaml:
+			res.ConfigYAML = append(res.ConfigYAML, c.ConfigYaml...)
+			if int64(len(res.ConfigYAML)) > limits.MaxYAMLSize {
+				return nil, status.Errorf(codes.ResourceExhausted, "config YAML exceeds %d bytes", limits.MaxYAMLSize)
+			}
+		case *v1.StartLocalEngineRequest_EngineYaml:
+			res.EngineYAML = append(res.EngineYAML, c.EngineYaml...)
+			if int64(len(res.EngineYAML)) > limits.MaxYAMLSize {
+				return nil, status.Errorf(codes.ResourceExhausted, "engine YAML exceeds %d bytes", limits.MaxYAMLSize)
+			}
+		case *v1.StartLocalEngineRequest_ApplicationTar:
+			if app == nil {
+				app = newApplicationWriter(dir, limits)
+			}
+			_, err = app.Write(c.ApplicationTar)
+			if err != nil {
+				return nil, err
+			}
+		case *v1.StartLocalEngineRequest_ApplicationTarDone:
+			if !c.ApplicationTarDone {
+				return nil, status.Error(codes.InvalidArgument, "application_tar_done must be true")
+			}
+			if app != nil {
+				err = app.Close()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if stage != uploadDone {
+		return nil, status.Error(codes.FailedPrecondition, "upload ended before application_tar_done")
+	}
+	if res.Metadata == nil {
+		return nil, status.Error(codes.InvalidArgument, "metadata is required")
+	}
+	if len(res.EngineYAML) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "engine YAML is required")
+	}
+	return &res, nil
+}
+
+// errUploadAborted stops the extraction of an application whose upload failed
+var errUploadAborted = errors.New("upload aborted")
+
+// applicationWriter extracts a gzipped tar stream to a directory while it's being written
+type applicationWriter struct {
+	limits  UploadLimits
+	written int64
+	pipe    *io.PipeWriter
+	done    chan error
+
+	finished bool
+	err      error
+}
+
+func newApplicationWriter(dir string, limits UploadLimits) *applicationWriter {
+	pr, pw := io.Pipe()
+	w := &applicationWriter{
+		limits: limits,
+		pipe:   pw,
+		done:   make(chan error, 1),
+	}
+	go func() {
+		err := extractApplication(pr, dir, limits)
+		if err == nil {
+			// drain trailing data so that writers don't block
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w
+}
+
+// Write passes a chunk of the archive to the extraction
+func (w *applicationWriter) Write(p []byte) (n int, err error) {
+	w.written += int64(len(p))
+	if w.written > w.limits.MaxArchiveSize {
+		return 0, status.Errorf(codes.ResourceExhausted, "application archive exceeds %d bytes", w.limits.MaxArchiveSize)
+	}
+
+	n, err = w.pipe.Write(p)
+	if err != nil {
+		// the extraction failed - report why
+		w.pipe.Close()
+		return n, w.wait()
+	}
+	return n, nil
+}
+
+// Close waits for the extraction to finish
+func (w *applicationWriter) Close() error {
+	w.pipe.Close()
+	return w.wait()
+}
+
+// Abort stops the extraction
+func (w *applicationWriter) Abort() {
+	w.pipe.CloseWithError(errUploadAborted)
+	w.wait()
+}
+
+func (w *applicationWriter) wait() error {
+	if !w.finished {
+		w.err = <-w.done
+		w.finished = true
+	}
+	return w.err
+}
+
+// extractApplication extracts a gzipped tar stream to dir. It rejects archives that exceed
+// the limits and entries that would end up outside of dir. Regular files, directories and
+// symlinks pointing within dir are supported. All errors returned are gRPC status errors.
+func extractApplication(r io.Reader, dir string, limits UploadLimits) error {
+	invalid := func(format string, args ...interface{}) error {
+		return status.Errorf(codes.InvalidArgument, "invalid application archive: "+format, args...)
+	}
+
+	dir = filepath.Clean(dir)
+	gz, err := gzip.NewReader(r)
+	if err == io.EOF {
+		// an empty archive
+		return nil
+	}
+	if err != nil {
+		return invalid("%v", err)
+	}
+	defer gz.Close()
+
+	var (
+		tr      = tar.NewReader(gz)
+		entries int
+		size    int64
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, errUploadAborted) {
+			return err
+		}
+		if err != nil {
+			return invalid("%v", err)
+		}
+
+		entries++
+		if entries > limits.MaxEntries {
+			return status.Errorf(codes.ResourceExhausted, "application archive has more than %d entries", limits.MaxEntries)
+		}
+
+		name, err := entryPath(dir, hdr.Name)
+		if err != nil {
+			return invalid("%v", err)
+		}
+		if name == dir {
+			continue
+		}
+		err = checkNoSymlinkParents(dir, name)
+		if err != nil {
+			return invalid("%v", err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(name, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			size += hdr.Size
+			if size > limits.MaxApplicationSize {
+				return status.Errorf(codes.ResourceExhausted, "application exceeds %d bytes", limits.MaxApplicationSize)
+			}
+			err = extractFile(tr, name, hdr)
+		case tar.TypeSymlink:
+			var target string
+			target, err = symlinkTarget(dir, name, hdr.Linkname)
+			if err != nil {
+				return invalid("%v", err)
+			}
+			err = os.MkdirAll(filepath.Dir(name), 0755)
+			if err == nil {
+				err = replace(name)
+			}
+			if err == nil {
+				err = os.Symlink(target, name)
+			}
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			return invalid("entry %s has unsupported type %q", hdr.Name, hdr.Typeflag)
+		}
+		if errors.Is(err, errUploadAborted) {
+			return err
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot extract %s: %v", hdr.Name, err)
+		}
+	}
+}
+
+// entryPath returns the path an archive entry is extracted to, or an error if it would end up outside of dir
+func entryPath(dir, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("entry %s has an absolute path", name)
+	}
+	res := filepath.Join(dir, filepath.FromSlash(name))
+	if !within(dir, res) {
+		return "", fmt.Errorf("entry %s points outside of the application", name)
+	}
+	return res, nil
+}
+
+// within returns true if path is dir or lies within dir. Both paths must be clean.
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// checkNoSymlinkParents makes sure we never write through a symlink extracted earlier
+func checkNoSymlinkParents(dir, name string) error {
+	rel, err := filepath.Rel(dir, filepath.Dir(name))
+	if err != nil || rel == "." {
+		return err
+	}
+
+	p := dir
+	for _, seg := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, seg)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			rn, _ := filepath.Rel(dir, name)
+			return fmt.Errorf("entry %s is located beneath a symlink", filepath.ToSlash(rn))
+		}
+	}
+	return nil
+}
+
+// symlinkTarget validates the target of a symlink and returns the target to use. Targets are
+// cleaned so that they cannot step outside of dir through other symlinks.
+func symlinkTarget(dir, name, target string) (string, error) {
+	if target == "" || filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+		return "", fmt.Errorf("symlink %s must point to a relative path", filepath.Base(name))
+	}
+	target = filepath.Clean(filepath.FromSlash(target))
+	if !within(dir, filepath.Join(filepath.Dir(name), target)) {
+		return "", fmt.Errorf("symlink %s points outside of the application", filepath.Base(name))
+	}
+	return target, nil
+}
+
+// replace removes whatever non-directory exists at name, so that a later archive entry replaces an earlier one
+func replace(name string) error {
+	fi, err := os.Lstat(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s is a directory", name)
+	}
+	return os.Remove(name)
+}
+
+func extractFile(r io.Reader, name string, hdr *tar.Header) error {
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+	err = replace(name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(hdr.Mode)&0755|0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
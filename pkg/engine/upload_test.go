@@ -0,0 +1,185 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testArchive produces a gzipped tar. Entries are given as name/content pairs,
+// names ending in "@" produce a symlink to the content.
+func testArchive(t *testing.T, entries ...string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for i := 0; i < len(entries); i += 2 {
+		name, content := entries[i], entries[i+1]
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if name[len(name)-1] == '@' {
+			hdr = &tar.Header{Name: name[:len(name)-1], Linkname: content, Typeflag: tar.TypeSymlink}
+			content = ""
+		}
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func localEngineRequests(archive []byte) []*v1.StartLocalEngineRequest {
+	res := []*v1.StartLocalEngineRequest{
+		{Content: &v1.StartLocalEngineRequest_Metadata{Metadata: &v1.EngineMetadata{Owner: "tester", Trigger: v1.EngineTrigger_TRIGGER_MANUAL}}},
+		{Content: &v1.StartLocalEngineRequest_ConfigYaml{ConfigYaml: []byte("defaultEngine: build\n")}},
+		{Content: &v1.StartLocalEngineRequest_EngineYaml{EngineYaml: []byte("pod:\n")}},
+		{Content: &v1.StartLocalEngineRequest_EngineYaml{EngineYaml: []byte("  containers: []\n")}},
+	}
+	// send the archive in small chunks to exercise streaming
+	for len(archive) > 0 {
+		n := 64
+		if n > len(archive) {
+			n = len(archive)
+		}
+		res = append(res, &v1.StartLocalEngineRequest{Content: &v1.StartLocalEngineRequest_ApplicationTar{ApplicationTar: archive[:n]}})
+		archive = archive[n:]
+	}
+	return append(res, &v1.StartLocalEngineRequest{Content: &v1.StartLocalEngineRequest_ApplicationTarDone{ApplicationTarDone: true}})
+}
+
+func uploadLocalEngine(client v1.NetServiceClient, reqs []*v1.StartLocalEngineRequest) (*v1.StartEngineResponse, error) {
+	stream, err := client.StartLocalEngine(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range reqs {
+		err = stream.Send(req)
+		if err != nil {
+			// the server has given up on us - CloseAndRecv tells us why
+			break
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestStartLocalEngine(t *testing.T) {
+	executor := &recordingExecutor{started: make(chan StartSpec, 1)}
+	service, client := startTestService(t, executor)
+	service.UploadDir = t.TempDir()
+
+	resp, err := uploadLocalEngine(client, localEngineRequests(testArchive(t,
+		"README.md", "hello world",
+		"src/main.go", "package main",
+		"docs/main.go@", "../src/main.go",
+	)))
+	if err != nil {
+		t.Fatalf("StartLocalEngine: %v", err)
+	}
+	if resp.Status.Phase != v1.EnginePhase_PHASE_PREPARING {
+		t.Errorf("engine is in phase %v, expected PREPARING", resp.Status.Phase)
+	}
+
+	spec := <-executor.started
+	if string(spec.EngineYAML) != "pod:\n  containers: []\n" || string(spec.ConfigYAML) != "defaultEngine: build\n" {
+		t.Errorf("unexpected YAML in start spec: %+v", spec)
+	}
+	content, err := os.ReadFile(filepath.Join(spec.Application, "docs", "main.go"))
+	if err != nil {
+		t.Fatalf("cannot read extracted application: %v", err)
+	}
+	if string(content) != "package main" {
+		t.Errorf("unexpected content of extracted file: %q", content)
+	}
+}
+
+func TestStartLocalEngineRejects(t *testing.T) {
+	valid := localEngineRequests(testArchive(t, "README.md", "hello world"))
+	tests := []struct {
+		Name    string
+		Reqs    []*v1.StartLocalEngineRequest
+		Limits  *UploadLimits
+		Code    codes.Code
+		Extract bool
+	}{
+		{Name: "metadata not first", Reqs: valid[1:], Code: codes.FailedPrecondition},
+		{Name: "metadata twice", Reqs: append([]*v1.StartLocalEngineRequest{valid[0]}, valid...), Code: codes.FailedPrecondition},
+		{Name: "config after engine", Reqs: append(append([]*v1.StartLocalEngineRequest{}, valid[:3]...), valid[1]), Code: codes.FailedPrecondition},
+		{Name: "missing done marker", Reqs: valid[:len(valid)-1], Code: codes.FailedPrecondition},
+		{Name: "message after done", Reqs: append(append([]*v1.StartLocalEngineRequest{}, valid...), valid[4]), Code: codes.FailedPrecondition},
+		{Name: "missing engine YAML", Reqs: append(append([]*v1.StartLocalEngineRequest{}, valid[:2]...), valid[len(valid)-1]), Code: codes.InvalidArgument},
+		{Name: "path traversal", Reqs: localEngineRequests(testArchive(t, "../evil", "boo")), Code: codes.InvalidArgument},
+		{Name: "absolute path", Reqs: localEngineRequests(testArchive(t, "/etc/evil", "boo")), Code: codes.InvalidArgument},
+		{Name: "symlink outside", Reqs: localEngineRequests(testArchive(t, "link@", "../..")), Code: codes.InvalidArgument},
+		{Name: "write through symlink", Reqs: localEngineRequests(testArchive(t, "link@", "src", "link/evil", "boo")), Code: codes.InvalidArgument},
+		{Name: "not an archive", Reqs: localEngineRequests([]byte("this is not gzip")), Code: codes.InvalidArgument},
+		{
+			Name:   "archive too large",
+			Reqs:   valid,
+			Limits: &UploadLimits{MaxYAMLSize: 1024, MaxArchiveSize: 16, MaxApplicationSize: 1024, MaxEntries: 10},
+			Code:   codes.ResourceExhausted,
+		},
+		{
+			Name:   "application too large",
+			Reqs:   valid,
+			Limits: &UploadLimits{MaxYAMLSize: 1024, MaxArchiveSize: 1024, MaxApplicationSize: 4, MaxEntries: 10},
+			Code:   codes.ResourceExhausted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			service, client := startTestService(t, nil)
+			service.UploadDir = t.TempDir()
+			if test.Limits != nil {
+				service.UploadLimits = *test.Limits
+			}
+
+			_, err := uploadLocalEngine(client, test.Reqs)
+			if status.Code(err) != test.Code {
+				t.Errorf("expected %v, got %v", test.Code, err)
+			}
+
+			left, _ := os.ReadDir(service.UploadDir)
+			if len(left) != 0 {
+				t.Errorf("upload directory was not cleaned up: %v", left)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package filterexpr
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AnnotationPrefix is the prefix of field paths that refer to engine annotations, e.g. annotation.version
+const AnnotationPrefix = "annotation."
+
+// Kind determines which operations a field supports and how its values compare
+type Kind int
+
+const (
+	// KindString fields support all filter operations
+	KindString Kind = iota
+	// KindEnum fields support OP_EQUALS and OP_EXISTS. Values can be given with or without their enum prefix.
+	KindEnum
+	// KindBool fields support OP_EQUALS with "true" or "false"
+	KindBool
+	// KindInt fields support OP_EQUALS with a decimal number
+	KindInt
+	// KindTime fields support OP_EXISTS and ordering only
+	KindTime
+)
+
+// Field is a well-defined path into an engine status
+type Field struct {
+	Path string
+	Kind Kind
+
+	// enumPrefix is the prefix of all enum value names, e.g. PHASE_
+	enumPrefix string
+	// enumValues maps the enum value names to their numbers
+	enumValues map[string]int32
+
+	get func(st *v1.EngineStatus) value
+}
+
+// value is the value of a field of a particular engine
+type value struct {
+	Str  string
+	Bool bool
+	Int  int64
+	Time *timestamppb.Timestamp
+}
+
+var fields = []Field{
+	{Path: "name", Kind: KindString, get: func(st *v1.EngineStatus) value { return value{Str: st.Name} }},
+	{Path: "phase", Kind: KindEnum, enumPrefix: "PHASE_", enumValues: v1.EnginePhase_value, get: func(st *v1.EngineStatus) value { return value{Str: st.Phase.String()} }},
+	{Path: "details", Kind: KindString, get: func(st *v1.EngineStatus) value { return value{Str: st.Details} }},
+	{Path: "metadata.owner", Kind: KindString, get: func(st *v1.EngineStatus) value { return value{Str: st.GetMetadata().GetOwner()} }},
+	{Path: "metadata.repository.host", Kind: KindString, get: func(st *v1.EngineStatus) value { return value{Str: st.GetMetadata().GetRepository().GetHost()} }},
+	{Path: "metadata.repository.owner", Kind: KindString, get: func(st *v1.EngineStatus) value { return value{Str: st.GetMetadata().GetRepository().GetOwner()} }},
+	{Path: "metadata.repository.repo", Kind: KindString, get: func(st *v1.EngineStatus) value { return value{Str: st.GetMetadata().GetRepository().GetRepo()} }},
+	{Path: "metadata.repository.ref", Kind: KindString, get: func(st *v1.EngineStatus) value { return value{Str: st.GetMetadata().GetRepository().GetRef()} }},
+	{Path: "metadata.repository.revision", Kind: KindString, get: func(st *v1.EngineStatus) value { return value{Str: st.GetMetadata().GetRepository().GetRevision()} }},
+	{Path: "metadata.trigger", Kind: KindEnum, enumPrefix: "TRIGGER_", enumValues: v1.EngineTrigger_value, get: func(st *v1.EngineStatus) value { return value{Str: st.GetMetadata().GetTrigger().String()} }},
+	{Path: "metadata.engine_spec_name", Kind: KindString, get: func(st *v1.EngineStatus) value { return value{Str: st.GetMetadata().GetEngineSpecName()} }},
+	{Path: "metadata.created", Kind: KindTime, get: func(st *v1.EngineStatus) value { return value{Time: st.GetMetadata().GetCreated()} }},
+	{Path: "metadata.finished", Kind: KindTime, get: func(st *v1.EngineStatus) value { return value{Time: st.GetMetadata().GetFinished()} }},
+	{Path: "conditions.success", Kind: KindBool, get: func(st *v1.EngineStatus) value { return value{Bool: st.GetConditions().GetSuccess()} }},
+	{Path: "conditions.failure_count", Kind: KindInt, get: func(st *v1.EngineStatus) value { return value{Int: int64(st.GetConditions().GetFailureCount())} }},
+	{Path: "conditions.can_replay", Kind: KindBool, get: func(st *v1.EngineStatus) value { return value{Bool: st.GetConditions().GetCanReplay()} }},
+	{Path: "conditions.wait_until", Kind: KindTime, get: func(st *v1.EngineStatus) value { return value{Time: st.GetConditions().GetWaitUntil()} }},
+	{Path: "conditions.did_execute", Kind: KindBool, get: func(st *v1.EngineStatus) value { return value{Bool: st.GetConditions().GetDidExecute()} }},
+}
+
+var fieldsByPath = func() map[string]Field {
+	res := make(map[string]Field, len(fields))
+	for _, f := range fields {
+		res[f.Path] = f
+	}
+	return res
+}()
+
+// Fields returns the paths of all known fields, except for annotations
+func Fields() []string {
+	res := make([]string, len(fields))
+	for i, f := range fields {
+		res[i] = f.Path
+	}
+	return res
+}
+
+// LookupField finds a field by its path. Annotations are not fields, use AnnotationKey to detect them.
+func LookupField(path string) (Field, bool) {
+	f, ok := fieldsByPath[path]
+	return f, ok
+}
+
+// AnnotationKey returns the annotation key a field path refers to, if it refers to one at all
+func AnnotationKey(path string) (key string, ok bool) {
+	if !strings.HasPrefix(path, AnnotationPrefix) {
+		return "", false
+	}
+	key = strings.TrimPrefix(path, AnnotationPrefix)
+	return key, key != ""
+}
+
+// normalize checks that a filter value is valid for this field and returns its canonical form,
+// i.e. the form in which the value is stored.
+func (f Field) normalize(op v1.FilterOp, val string) (string, error) {
+	if op == v1.FilterOp_OP_EXISTS {
+		return "", nil
+	}
+
+	switch f.Kind {
+	case KindString:
+		return val, nil
+	case KindEnum:
+		if op != v1.FilterOp_OP_EQUALS {
+			return "", fmt.Errorf("field %s only supports equals and exists", f.Path)
+		}
+		name := strings.ToUpper(val)
+		if !strings.HasPrefix(name, f.enumPrefix) {
+			name = f.enumPrefix + name
+		}
+		if _, ok := f.enumValues[name]; !ok {
+			return "", fmt.Errorf("invalid value %q for field %s", val, f.Path)
+		}
+		return name, nil
+	case KindBool:
+		if op != v1.FilterOp_OP_EQUALS {
+			return "", fmt.Errorf("field %s only supports equals and exists", f.Path)
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return "", fmt.Errorf("invalid value %q for field %s: expected true or false", val, f.Path)
+		}
+		return strconv.FormatBool(b), nil
+	case KindInt:
+		if op != v1.FilterOp_OP_EQUALS {
+			return "", fmt.Errorf("field %s only supports equals and exists", f.Path)
+		}
+		i, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid value %q for field %s: expected a number", val, f.Path)
+		}
+		return strconv.FormatInt(i, 10), nil
+	case KindTime:
+		return "", fmt.Errorf("field %s only supports exists", f.Path)
+	}
+	return "", fmt.Errorf("unknown field kind %d", f.Kind)
+}
+
+// exists returns true if the field is set, i.e. has a non-zero value
+func (f Field) exists(v value) bool {
+	switch f.Kind {
+	case KindString:
+		return v.Str != ""
+	case KindEnum:
+		return f.enumValues[v.Str] != 0
+	case KindBool:
+		return v.Bool
+	case KindInt:
+		return v.Int != 0
+	case KindTime:
+		return v.Time != nil
+	}
+	return false
+}
+
+// text returns the field value in its canonical string form
+func (f Field) text(v value) string {
+	switch f.Kind {
+	case KindBool:
+		return strconv.FormatBool(v.Bool)
+	case KindInt:
+		return strconv.FormatInt(v.Int, 10)
+	case KindTime:
+		if v.Time == nil {
+			return ""
+		}
+		return v.Time.AsTime().Format(time.RFC3339Nano)
+	default:
+		return v.Str
+	}
+}
@@ -0,0 +1,242 @@
+package filterexpr
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+// ErrInvalid is returned for filter or order expressions that cannot be evaluated
+var ErrInvalid = errors.New("invalid expression")
+
+// Validate checks that all filter terms and order expressions refer to known fields
+// and use operations those fields support.
+func Validate(filter []*v1.FilterExpression, order []*v1.OrderExpression) error {
+	for _, expr := range filter {
+		if len(expr.Terms) == 0 {
+			return fmt.Errorf("%w: filter expression without terms", ErrInvalid)
+		}
+		for _, term := range expr.Terms {
+			_, err := normalizeTerm(term)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, o := range order {
+		_, err := orderField(o)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// term is a filter term whose field was resolved and whose value was normalized
+type term struct {
+	Field         Field
+	AnnotationKey string
+	Operation     v1.FilterOp
+	Value         string
+	Negate        bool
+}
+
+func normalizeTerm(t *v1.FilterTerm) (*term, error) {
+	if _, ok := v1.FilterOp_name[int32(t.Operation)]; !ok {
+		return nil, fmt.Errorf("%w: unknown operation %d", ErrInvalid, t.Operation)
+	}
+
+	res := &term{
+		Operation: t.Operation,
+		Value:     t.Value,
+		Negate:    t.Negate,
+	}
+	if key, ok := AnnotationKey(t.Field); ok {
+		res.AnnotationKey = key
+		return res, nil
+	}
+
+	f, ok := LookupField(t.Field)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown field %q", ErrInvalid, t.Field)
+	}
+	val, err := f.normalize(t.Operation, t.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	res.Field = f
+	res.Value = val
+	return res, nil
+}
+
+func orderField(o *v1.OrderExpression) (Field, error) {
+	f, ok := LookupField(o.Field)
+	if !ok {
+		return Field{}, fmt.Errorf("%w: cannot order by unknown field %q", ErrInvalid, o.Field)
+	}
+	return f, nil
+}
+
+// MatchesFilter returns true if the engine matches the filter. All filter expressions must match
+// for the engine to match, and an expression matches if any of its terms match.
+// Invalid terms never match - use Validate to detect them beforehand.
+func MatchesFilter(st *v1.EngineStatus, filter []*v1.FilterExpression) bool {
+	for _, expr := range filter {
+		var matches bool
+		for _, t := range expr.Terms {
+			nt, err := normalizeTerm(t)
+			if err != nil {
+				continue
+			}
+			if nt.matches(st) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *term) matches(st *v1.EngineStatus) bool {
+	var res bool
+	if t.AnnotationKey != "" {
+		for _, a := range st.GetMetadata().GetAnnotations() {
+			if a.Key != t.AnnotationKey {
+				continue
+			}
+			if t.Operation == v1.FilterOp_OP_EXISTS || matchString(t.Operation, a.Value, t.Value) {
+				res = true
+				break
+			}
+		}
+	} else {
+		val := t.Field.get(st)
+		if t.Operation == v1.FilterOp_OP_EXISTS {
+			res = t.Field.exists(val)
+		} else {
+			res = matchString(t.Operation, t.Field.text(val), t.Value)
+		}
+	}
+
+	if t.Negate {
+		return !res
+	}
+	return res
+}
+
+func matchString(op v1.FilterOp, val, expectation string) bool {
+	switch op {
+	case v1.FilterOp_OP_EQUALS:
+		return val == expectation
+	case v1.FilterOp_OP_STARTS_WITH:
+		return strings.HasPrefix(val, expectation)
+	case v1.FilterOp_OP_ENDS_WITH:
+		return strings.HasSuffix(val, expectation)
+	case v1.FilterOp_OP_CONTAINS:
+		return strings.Contains(val, expectation)
+	}
+	return false
+}
+
+// DefaultOrder is used when no order is requested: newest engines first
+var DefaultOrder = []*v1.OrderExpression{{Field: "metadata.created", Ascending: false}}
+
+// Sort sorts engines according to the order expressions. Engines that are equal in all
+// order fields are sorted by name, so that pagination is stable. Unset times come last,
+// regardless of the order direction.
+func Sort(engines []*v1.EngineStatus, order []*v1.OrderExpression) error {
+	if len(order) == 0 {
+		order = DefaultOrder
+	}
+
+	fs := make([]Field, len(order))
+	for i, o := range order {
+		f, err := orderField(o)
+		if err != nil {
+			return err
+		}
+		fs[i] = f
+	}
+
+	sort.SliceStable(engines, func(i, j int) bool {
+		for k, f := range fs {
+			c := compare(f, f.get(engines[i]), f.get(engines[j]), order[k].Ascending)
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return engines[i].Name < engines[j].Name
+	})
+	return nil
+}
+
+// compare returns -1 if a comes before b, 1 if b comes before a and 0 if they're equal
+func compare(f Field, a, b value, ascending bool) int {
+	var c int
+	switch f.Kind {
+	case KindString, KindEnum:
+		c = strings.Compare(a.Str, b.Str)
+	case KindBool:
+		switch {
+		case a.Bool == b.Bool:
+		case !a.Bool:
+			c = -1
+		default:
+			c = 1
+		}
+	case KindInt:
+		switch {
+		case a.Int < b.Int:
+			c = -1
+		case a.Int > b.Int:
+			c = 1
+		}
+	case KindTime:
+		switch {
+		case a.Time == nil && b.Time == nil:
+			return 0
+		case a.Time == nil:
+			return 1
+		case b.Time == nil:
+			return -1
+		}
+		ta, tb := a.Time.AsTime(), b.Time.AsTime()
+		switch {
+		case ta.Before(tb):
+			c = -1
+		case ta.After(tb):
+			c = 1
+		}
+	}
+
+	if !ascending {
+		c = -c
+	}
+	return c
+}
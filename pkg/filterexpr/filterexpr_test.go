@@ -0,0 +1,249 @@
+package filterexpr
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func testEngine() *v1.EngineStatus {
+	return &v1.EngineStatus{
+		Name: "net-main.1",
+		Metadata: &v1.EngineMetadata{
+			Owner:      "tester",
+			Repository: &v1.Repository{Host: "github.com", Owner: "bhojpur", Repo: "net", Ref: "refs/heads/main"},
+			Trigger:    v1.EngineTrigger_TRIGGER_PUSH,
+			Created:    timestamppb.Now(),
+			Annotations: []*v1.Annotation{
+				{Key: "env", Value: "staging"},
+				{Key: "version", Value: "1.0_rc"},
+			},
+		},
+		Phase:      v1.EnginePhase_PHASE_RUNNING,
+		Conditions: &v1.EngineConditions{FailureCount: 2},
+	}
+}
+
+func TestMatchesFilter(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Filter  []*v1.FilterExpression
+		Matches bool
+	}{
+		{"no filter", nil, true},
+		{"equals", expr(&v1.FilterTerm{Field: "metadata.owner", Value: "tester"}), true},
+		{"equals mismatch", expr(&v1.FilterTerm{Field: "metadata.owner", Value: "someone"}), false},
+		{"negate", expr(&v1.FilterTerm{Field: "metadata.owner", Value: "someone", Negate: true}), true},
+		{"starts with", expr(&v1.FilterTerm{Field: "metadata.repository.ref", Value: "refs/heads/", Operation: v1.FilterOp_OP_STARTS_WITH}), true},
+		{"ends with", expr(&v1.FilterTerm{Field: "name", Value: ".1", Operation: v1.FilterOp_OP_ENDS_WITH}), true},
+		{"contains", expr(&v1.FilterTerm{Field: "metadata.repository.repo", Value: "e", Operation: v1.FilterOp_OP_CONTAINS}), true},
+		{"short enum", expr(&v1.FilterTerm{Field: "phase", Value: "running"}), true},
+		{"full enum", expr(&v1.FilterTerm{Field: "metadata.trigger", Value: "TRIGGER_PUSH"}), true},
+		{"bool", expr(&v1.FilterTerm{Field: "conditions.success", Value: "false"}), true},
+		{"int", expr(&v1.FilterTerm{Field: "conditions.failure_count", Value: "2"}), true},
+		{"time exists", expr(&v1.FilterTerm{Field: "metadata.created", Operation: v1.FilterOp_OP_EXISTS}), true},
+		{"time does not exist", expr(&v1.FilterTerm{Field: "metadata.finished", Operation: v1.FilterOp_OP_EXISTS}), false},
+		{"annotation", expr(&v1.FilterTerm{Field: "annotation.env", Value: "staging"}), true},
+		{"annotation exists", expr(&v1.FilterTerm{Field: "annotation.version", Operation: v1.FilterOp_OP_EXISTS}), true},
+		{"missing annotation negated", expr(&v1.FilterTerm{Field: "annotation.foo", Operation: v1.FilterOp_OP_EXISTS, Negate: true}), true},
+		{
+			"terms are or'ed",
+			expr(&v1.FilterTerm{Field: "phase", Value: "done"}, &v1.FilterTerm{Field: "phase", Value: "running"}),
+			true,
+		},
+		{
+			"expressions are and'ed",
+			append(expr(&v1.FilterTerm{Field: "phase", Value: "running"}), expr(&v1.FilterTerm{Field: "metadata.owner", Value: "someone"})...),
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := Validate(test.Filter, nil)
+			if err != nil {
+				t.Fatalf("filter is invalid: %v", err)
+			}
+			if act := MatchesFilter(testEngine(), test.Filter); act != test.Matches {
+				t.Errorf("MatchesFilter() = %v, expected %v", act, test.Matches)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Filter []*v1.FilterExpression
+		Order  []*v1.OrderExpression
+	}{
+		{Name: "unknown field", Filter: expr(&v1.FilterTerm{Field: "metadata.foo"})},
+		{Name: "empty annotation key", Filter: expr(&v1.FilterTerm{Field: "annotation."})},
+		{Name: "invalid enum value", Filter: expr(&v1.FilterTerm{Field: "phase", Value: "sleeping"})},
+		{Name: "prefix on enum", Filter: expr(&v1.FilterTerm{Field: "phase", Value: "run", Operation: v1.FilterOp_OP_STARTS_WITH})},
+		{Name: "invalid bool", Filter: expr(&v1.FilterTerm{Field: "conditions.success", Value: "maybe"})},
+		{Name: "equals on time", Filter: expr(&v1.FilterTerm{Field: "metadata.created", Value: "now"})},
+		{Name: "no terms", Filter: []*v1.FilterExpression{{}}},
+		{Name: "order by annotation", Order: []*v1.OrderExpression{{Field: "annotation.env"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := Validate(test.Filter, test.Order)
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("expected ErrInvalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	now := time.Now()
+	var engines []*v1.EngineStatus
+	for i, phase := range []v1.EnginePhase{v1.EnginePhase_PHASE_RUNNING, v1.EnginePhase_PHASE_DONE, v1.EnginePhase_PHASE_RUNNING} {
+		engines = append(engines, &v1.EngineStatus{
+			Name:     fmt.Sprintf("net.%d", i),
+			Phase:    phase,
+			Metadata: &v1.EngineMetadata{Created: timestamppb.New(now.Add(time.Duration(i) * time.Second))},
+		})
+	}
+	engines = append(engines, &v1.EngineStatus{Name: "net.3", Metadata: &v1.EngineMetadata{}})
+
+	names := func() string {
+		var res []string
+		for _, e := range engines {
+			res = append(res, e.Name)
+		}
+		return fmt.Sprint(res)
+	}
+
+	err := Sort(engines, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act := names(); act != "[net.2 net.1 net.0 net.3]" {
+		t.Errorf("default order should be newest first with unset times last, got %s", act)
+	}
+
+	err = Sort(engines, []*v1.OrderExpression{{Field: "phase", Ascending: true}, {Field: "metadata.created", Ascending: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act := names(); act != "[net.1 net.0 net.2 net.3]" {
+		t.Errorf("unexpected order: %s", act)
+	}
+}
+
+func TestSQLSchema(t *testing.T) {
+	schema := SQLSchema{
+		Columns:                map[string]string{"phase": "phase", "metadata.owner": "owner", "metadata.created": "created"},
+		NameColumn:             "e.name",
+		AnnotationTable:        "a",
+		AnnotationEngineColumn: "a.engine",
+		AnnotationKeyColumn:    "a.key",
+		AnnotationValueColumn:  "a.value",
+	}
+
+	where, args, err := schema.Where(append(
+		expr(&v1.FilterTerm{Field: "phase", Value: "done"}, &v1.FilterTerm{Field: "metadata.owner", Value: "50%", Operation: v1.FilterOp_OP_STARTS_WITH, Negate: true}),
+		expr(&v1.FilterTerm{Field: "annotation.env", Operation: v1.FilterOp_OP_EXISTS})...,
+	), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedWhere := "(phase = $3 OR NOT (owner LIKE $4)) AND (EXISTS (SELECT 1 FROM a WHERE a.engine = e.name AND a.key = $5))"
+	if where != expectedWhere {
+		t.Errorf("unexpected WHERE clause:\nexpected: %s\n  actual: %s", expectedWhere, where)
+	}
+	if act := fmt.Sprint(args); act != `[PHASE_DONE 50\%% env]` {
+		t.Errorf("unexpected arguments: %s", act)
+	}
+
+	orderBy, err := schema.OrderBy(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `created DESC NULLS LAST, e.name COLLATE "C" ASC`; orderBy != expected {
+		t.Errorf("unexpected ORDER BY clause:\nexpected: %s\n  actual: %s", expected, orderBy)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		Expr     string
+		Expected *v1.FilterExpression
+		Invalid  bool
+	}{
+		{Expr: "phase==running", Expected: expr(&v1.FilterTerm{Field: "phase", Value: "running"})[0]},
+		{Expr: "metadata.owner = tester", Expected: expr(&v1.FilterTerm{Field: "metadata.owner", Value: "tester"})[0]},
+		{Expr: "phase!=done", Expected: expr(&v1.FilterTerm{Field: "phase", Value: "done", Negate: true})[0]},
+		{Expr: "name^=net-", Expected: expr(&v1.FilterTerm{Field: "name", Value: "net-", Operation: v1.FilterOp_OP_STARTS_WITH})[0]},
+		{Expr: "annotation.env$=ing", Expected: expr(&v1.FilterTerm{Field: "annotation.env", Value: "ing", Operation: v1.FilterOp_OP_ENDS_WITH})[0]},
+		{Expr: "!metadata.finished", Expected: expr(&v1.FilterTerm{Field: "metadata.finished", Operation: v1.FilterOp_OP_EXISTS, Negate: true})[0]},
+		{
+			Expr: "phase==running | metadata.repository.repo~=net",
+			Expected: expr(
+				&v1.FilterTerm{Field: "phase", Value: "running"},
+				&v1.FilterTerm{Field: "metadata.repository.repo", Value: "net", Operation: v1.FilterOp_OP_CONTAINS},
+			)[0],
+		},
+		{Expr: "metadata.foo==bar", Invalid: true},
+		{Expr: "phase==running|", Invalid: true},
+		{Expr: "==running", Invalid: true},
+		{Expr: "phase!running", Invalid: true},
+	}
+	for _, test := range tests {
+		act, err := Parse(test.Expr)
+		if test.Invalid {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Parse(%q): expected ErrInvalid, got %v", test.Expr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.Expr, err)
+			continue
+		}
+		if !proto.Equal(act, test.Expected) {
+			t.Errorf("Parse(%q) = %v, expected %v", test.Expr, act, test.Expected)
+		}
+	}
+
+	order, err := ParseOrder("metadata.created:desc")
+	if err != nil || order.Field != "metadata.created" || order.Ascending {
+		t.Errorf("unexpected order %v: %v", order, err)
+	}
+	_, err = ParseOrder("phase:sideways")
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for unknown direction, got %v", err)
+	}
+}
+
+func expr(terms ...*v1.FilterTerm) []*v1.FilterExpression {
+	return []*v1.FilterExpression{{Terms: terms}}
+}
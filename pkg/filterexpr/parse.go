@@ -0,0 +1,127 @@
+package filterexpr
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+// operators maps the operators of the filter syntax to filter operations. Order matters:
+// longer operators must come before their prefixes.
+var operators = []struct {
+	Token     string
+	Operation v1.FilterOp
+	Negate    bool
+}{
+	{"==", v1.FilterOp_OP_EQUALS, false},
+	{"!=", v1.FilterOp_OP_EQUALS, true},
+	{"~=", v1.FilterOp_OP_CONTAINS, false},
+	{"^=", v1.FilterOp_OP_STARTS_WITH, false},
+	{"$=", v1.FilterOp_OP_ENDS_WITH, false},
+	{"=", v1.FilterOp_OP_EQUALS, false},
+}
+
+// Parse parses a filter expression written for humans, e.g. on the command line.
+// An expression consists of terms separated by |, any of which must match. Terms have the form
+//
+//	field==value  field=value  equals
+//	field!=value               does not equal
+//	field~=value               contains
+//	field^=value               starts with
+//	field$=value               ends with
+//	field                      exists
+//	!field                     does not exist
+//
+// Fields are those of Fields() or annotation.<key>. The result is validated.
+func Parse(expr string) (*v1.FilterExpression, error) {
+	var res v1.FilterExpression
+	for _, t := range strings.Split(expr, "|") {
+		term, err := parseTerm(strings.TrimSpace(t))
+		if err != nil {
+			return nil, err
+		}
+		res.Terms = append(res.Terms, term)
+	}
+
+	err := Validate([]*v1.FilterExpression{&res}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func parseTerm(t string) (*v1.FilterTerm, error) {
+	if t == "" {
+		return nil, fmt.Errorf("%w: empty filter term", ErrInvalid)
+	}
+
+	i := strings.IndexAny(t, "=!~^$")
+	if i < 0 {
+		return &v1.FilterTerm{Field: t, Operation: v1.FilterOp_OP_EXISTS}, nil
+	}
+	if i == 0 && t[0] == '!' && !strings.ContainsAny(t[1:], "=!~^$") {
+		return &v1.FilterTerm{Field: t[1:], Operation: v1.FilterOp_OP_EXISTS, Negate: true}, nil
+	}
+
+	field, rest := strings.TrimSpace(t[:i]), t[i:]
+	for _, op := range operators {
+		if !strings.HasPrefix(rest, op.Token) {
+			continue
+		}
+		if field == "" {
+			return nil, fmt.Errorf("%w: filter term %q has no field", ErrInvalid, t)
+		}
+		return &v1.FilterTerm{
+			Field:     field,
+			Value:     strings.TrimSpace(strings.TrimPrefix(rest, op.Token)),
+			Operation: op.Operation,
+			Negate:    op.Negate,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: filter term %q has no valid operator", ErrInvalid, t)
+}
+
+// ParseOrder parses an order expression of the form field, field:asc or field:desc.
+// Without a direction the order is ascending. The result is validated.
+func ParseOrder(expr string) (*v1.OrderExpression, error) {
+	field, dir := expr, "asc"
+	if i := strings.LastIndex(expr, ":"); i >= 0 {
+		field, dir = expr[:i], strings.ToLower(expr[i+1:])
+	}
+
+	res := &v1.OrderExpression{Field: strings.TrimSpace(field)}
+	switch dir {
+	case "asc":
+		res.Ascending = true
+	case "desc":
+	default:
+		return nil, fmt.Errorf("%w: unknown order direction %q", ErrInvalid, dir)
+	}
+
+	err := Validate(nil, []*v1.OrderExpression{res})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
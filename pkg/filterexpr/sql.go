@@ -0,0 +1,217 @@
+package filterexpr
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+// SQLSchema describes how engines are stored in a SQL database, so that filter and order
+// expressions can be translated to WHERE and ORDER BY clauses that behave exactly like
+// MatchesFilter and Sort.
+//
+// String fields are expected in text columns, enum fields as text holding the full enum value
+// name (e.g. PHASE_RUNNING), bool fields as boolean, int fields as integer and time fields as
+// nullable timestamp columns. Placeholders use the PostgreSQL $n syntax.
+type SQLSchema struct {
+	// Columns maps field paths to the columns they are stored in. All fields must be mapped.
+	Columns map[string]string
+
+	// NameColumn holds the engine name and is used to join annotations
+	NameColumn string
+
+	// AnnotationTable holds the annotations of all engines, one row per annotation
+	AnnotationTable        string
+	AnnotationEngineColumn string
+	AnnotationKeyColumn    string
+	AnnotationValueColumn  string
+}
+
+// Where translates a filter to a boolean SQL expression. Placeholders start at $firstArg.
+// An empty filter translates to TRUE.
+func (s SQLSchema) Where(filter []*v1.FilterExpression, firstArg int) (where string, args []interface{}, err error) {
+	if len(filter) == 0 {
+		return "TRUE", nil, nil
+	}
+
+	var (
+		exprs []string
+		next  = firstArg
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		next++
+		return "$" + strconv.Itoa(next-1)
+	}
+
+	for _, expr := range filter {
+		if len(expr.Terms) == 0 {
+			return "", nil, fmt.Errorf("%w: filter expression without terms", ErrInvalid)
+		}
+
+		terms := make([]string, 0, len(expr.Terms))
+		for _, t := range expr.Terms {
+			nt, err := normalizeTerm(t)
+			if err != nil {
+				return "", nil, err
+			}
+
+			var cond string
+			if nt.AnnotationKey != "" {
+				cond, err = s.annotationCondition(nt, arg)
+			} else {
+				cond, err = s.fieldCondition(nt, arg)
+			}
+			if err != nil {
+				return "", nil, err
+			}
+			if nt.Negate {
+				cond = "NOT (" + cond + ")"
+			}
+			terms = append(terms, cond)
+		}
+		exprs = append(exprs, "("+strings.Join(terms, " OR ")+")")
+	}
+
+	return strings.Join(exprs, " AND "), args, nil
+}
+
+func (s SQLSchema) column(f Field) (string, error) {
+	col, ok := s.Columns[f.Path]
+	if !ok {
+		return "", fmt.Errorf("field %s has no column", f.Path)
+	}
+	return col, nil
+}
+
+func (s SQLSchema) fieldCondition(t *term, arg func(interface{}) string) (string, error) {
+	col, err := s.column(t.Field)
+	if err != nil {
+		return "", err
+	}
+
+	if t.Operation == v1.FilterOp_OP_EXISTS {
+		switch t.Field.Kind {
+		case KindString:
+			return col + " <> ''", nil
+		case KindEnum:
+			var zero string
+			for name, nr := range t.Field.enumValues {
+				if nr == 0 {
+					zero = name
+				}
+			}
+			return fmt.Sprintf("%s NOT IN ('', %s)", col, arg(zero)), nil
+		case KindBool:
+			return col, nil
+		case KindInt:
+			return col + " <> 0", nil
+		case KindTime:
+			return col + " IS NOT NULL", nil
+		}
+	}
+
+	if t.Operation == v1.FilterOp_OP_EQUALS {
+		switch t.Field.Kind {
+		case KindBool:
+			b, _ := strconv.ParseBool(t.Value)
+			return col + " = " + arg(b), nil
+		case KindInt:
+			i, _ := strconv.ParseInt(t.Value, 10, 64)
+			return col + " = " + arg(i), nil
+		}
+	}
+
+	return stringCondition(col, t.Operation, t.Value, arg)
+}
+
+func (s SQLSchema) annotationCondition(t *term, arg func(interface{}) string) (string, error) {
+	cond := fmt.Sprintf("%s = %s AND %s = %s", s.AnnotationEngineColumn, s.NameColumn, s.AnnotationKeyColumn, arg(t.AnnotationKey))
+	if t.Operation != v1.FilterOp_OP_EXISTS {
+		vc, err := stringCondition(s.AnnotationValueColumn, t.Operation, t.Value, arg)
+		if err != nil {
+			return "", err
+		}
+		cond += " AND " + vc
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s)", s.AnnotationTable, cond), nil
+}
+
+func stringCondition(col string, op v1.FilterOp, val string, arg func(interface{}) string) (string, error) {
+	switch op {
+	case v1.FilterOp_OP_EQUALS:
+		return col + " = " + arg(val), nil
+	case v1.FilterOp_OP_STARTS_WITH:
+		return col + " LIKE " + arg(escapeLike(val)+"%"), nil
+	case v1.FilterOp_OP_ENDS_WITH:
+		return col + " LIKE " + arg("%"+escapeLike(val)), nil
+	case v1.FilterOp_OP_CONTAINS:
+		return col + " LIKE " + arg("%"+escapeLike(val)+"%"), nil
+	}
+	return "", fmt.Errorf("%w: unsupported operation %v", ErrInvalid, op)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes all LIKE wildcards using the default escape character
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// OrderBy translates order expressions to the expression list of an ORDER BY clause.
+// Like Sort, it falls back to DefaultOrder and breaks ties using the engine name.
+func (s SQLSchema) OrderBy(order []*v1.OrderExpression) (string, error) {
+	if len(order) == 0 {
+		order = DefaultOrder
+	}
+
+	res := make([]string, 0, len(order)+1)
+	for _, o := range order {
+		f, err := orderField(o)
+		if err != nil {
+			return "", err
+		}
+		col, err := s.column(f)
+		if err != nil {
+			return "", err
+		}
+
+		dir := "DESC"
+		if o.Ascending {
+			dir = "ASC"
+		}
+		switch f.Kind {
+		case KindString, KindEnum:
+			// byte-wise comparison, just like Sort
+			res = append(res, fmt.Sprintf(`%s COLLATE "C" %s`, col, dir))
+		case KindTime:
+			res = append(res, fmt.Sprintf("%s %s NULLS LAST", col, dir))
+		default:
+			res = append(res, col+" "+dir)
+		}
+	}
+	res = append(res, s.NameColumn+` COLLATE "C" ASC`)
+	return strings.Join(res, ", "), nil
+}
@@ -0,0 +1,233 @@
+package gateway
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// maxMessageSize is the largest request message the gateway accepts, just like gRPC's default
+const maxMessageSize = 4 * 1024 * 1024
+
+// Gateway serves gRPC services to clients that cannot speak native gRPC, i.e. browsers.
+// It offers all registered services via gRPC-Web and, for the routes in Routes, as JSON over HTTP.
+//
+// Services are registered just like with a grpc.Server, e.g. using v1.RegisterNetServiceServer.
+// Calls are dispatched to the service implementations directly and pass through the gateway's
+// interceptors, which should be the same as those of the gRPC server.
+type Gateway struct {
+	UnaryInterceptor  grpc.UnaryServerInterceptor
+	StreamInterceptor grpc.StreamServerInterceptor
+
+	// Routes maps HTTP requests to gRPC methods. Defaults to DefaultRoutes.
+	Routes []Route
+
+	methods  map[string]*method
+	services []string
+	mu       sync.RWMutex
+}
+
+var _ grpc.ServiceRegistrar = &Gateway{}
+
+type method struct {
+	FullName string
+	Impl     interface{}
+	Unary    *grpc.MethodDesc
+	Stream   *grpc.StreamDesc
+}
+
+// RegisterService registers a service and its implementation with the gateway
+func (g *Gateway) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.methods == nil {
+		g.methods = make(map[string]*method)
+	}
+	for i := range desc.Methods {
+		m := &desc.Methods[i]
+		name := "/" + desc.ServiceName + "/" + m.MethodName
+		g.methods[name] = &method{FullName: name, Impl: impl, Unary: m}
+	}
+	for i := range desc.Streams {
+		s := &desc.Streams[i]
+		name := "/" + desc.ServiceName + "/" + s.StreamName
+		g.methods[name] = &method{FullName: name, Impl: impl, Stream: s}
+	}
+	g.services = append(g.services, desc.ServiceName)
+}
+
+// Mount registers the gateway with a mux: gRPC-Web is served below the path of each
+// registered service, JSON routes below /v1/.
+func (g *Gateway) Mount(mux *http.ServeMux) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	for _, svc := range g.services {
+		mux.Handle("/"+svc+"/", g)
+	}
+	mux.Handle("/v1/", g)
+}
+
+// ServeHTTP serves gRPC-Web requests and JSON routes
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isGRPCWeb(r) {
+		g.serveGRPCWeb(w, r)
+		return
+	}
+	g.serveREST(w, r)
+}
+
+func (g *Gateway) lookup(fullMethod string) (*method, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	m, ok := g.methods[fullMethod]
+	return m, ok
+}
+
+// invokeUnary calls a unary method. dec decodes the request into the message it's given.
+func (g *Gateway) invokeUnary(ctx context.Context, m *method, dec func(interface{}) error) (interface{}, error) {
+	return m.Unary.Handler(m.Impl, ctx, dec, g.UnaryInterceptor)
+}
+
+// invokeStream calls a streaming method
+func (g *Gateway) invokeStream(m *method, stream *serverStream) error {
+	if g.StreamInterceptor == nil {
+		return m.Stream.Handler(m.Impl, stream)
+	}
+	info := &grpc.StreamServerInfo{
+		FullMethod:     m.FullName,
+		IsClientStream: m.Stream.ClientStreams,
+		IsServerStream: m.Stream.ServerStreams,
+	}
+	return g.StreamInterceptor(m.Impl, stream, info, m.Stream.Handler)
+}
+
+// serverStream adapts an HTTP request to grpc.ServerStream
+type serverStream struct {
+	ctx  context.Context
+	recv func(m interface{}) error
+	send func(m interface{}) error
+
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+var _ grpc.ServerStream = &serverStream{}
+
+func (s *serverStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *serverStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *serverStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	return s.send(m)
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	return s.recv(m)
+}
+
+// incomingContext makes the request headers available as incoming gRPC metadata and
+// applies the grpc-timeout header, if any
+func incomingContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	md := make(metadata.MD, len(r.Header))
+	for k, v := range r.Header {
+		md[strings.ToLower(k)] = v
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+
+	timeout := r.Header.Get("grpc-timeout")
+	if timeout == "" {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+	d, err := parseTimeout(timeout)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid grpc-timeout: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	return ctx, cancel, nil
+}
+
+var timeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseTimeout parses the value of a grpc-timeout header, e.g. 10S
+func parseTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, fmt.Errorf("malformed timeout %q", s)
+	}
+	unit, ok := timeoutUnits[s[len(s)-1]]
+	if !ok {
+		return 0, fmt.Errorf("unknown timeout unit in %q", s)
+	}
+	v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("malformed timeout %q", s)
+	}
+	return time.Duration(v) * unit, nil
+}
+
+// WithGRPC returns a handler that serves native gRPC requests using grpcServer and everything
+// else using h. HTTP/2 is accepted without TLS, so that gRPC clients, gRPC-Web and HTTP clients
+// can share a single listener.
+func WithGRPC(grpcServer *grpc.Server, h http.Handler) http.Handler {
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") && !isGRPCWeb(r) {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
@@ -0,0 +1,313 @@
+package gateway
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/engine"
+	"github.com/bhojpur/net/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func startTestGateway(t *testing.T, readOnly bool) (*engine.Service, *httptest.Server) {
+	service := engine.NewService(store.NewInMemoryEngineStore(), store.NewInMemoryLogStore(), nil)
+	gw := &Gateway{}
+	if readOnly {
+		gw.UnaryInterceptor = engine.ReadOnlyUnaryInterceptor()
+		gw.StreamInterceptor = engine.ReadOnlyStreamInterceptor()
+	}
+	v1.RegisterNetServiceServer(gw, service)
+	v1.RegisterNetUIServer(gw, &engine.UIService{ReadOnly: readOnly})
+
+	mux := http.NewServeMux()
+	gw.Mount(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return service, srv
+}
+
+func TestREST(t *testing.T) {
+	_, srv := startTestGateway(t, false)
+
+	resp, err := http.Post(srv.URL+"/v1/engines", "application/json", strings.NewReader(`{"metadata":{"owner":"tester","repository":{"repo":"net"}},"enginePath":"net/build.yaml"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var started v1.StartEngineResponse
+	readJSON(t, resp, http.StatusOK, &started)
+	name := started.Status.Name
+
+	resp, err = http.Get(srv.URL + "/v1/engines/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var get v1.GetEngineResponse
+	readJSON(t, resp, http.StatusOK, &get)
+	if get.Result.Metadata.Owner != "tester" {
+		t.Errorf("unexpected engine: %v", get.Result)
+	}
+
+	resp, err = http.Get(srv.URL + "/v1/engines?limit=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list v1.ListEnginesResponse
+	readJSON(t, resp, http.StatusOK, &list)
+	if list.Total != 1 || len(list.Result) != 1 {
+		t.Errorf("unexpected list: %v", &list)
+	}
+
+	resp, err = http.Get(srv.URL + "/v1/engines/does-not-exist.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown engine, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/v1/engines?limit=lots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid query parameter, got %d", resp.StatusCode)
+	}
+
+	// listen to the engine as it's stopped
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/engines/"+name+":listen?updates=true", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	listen, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listen.Body.Close()
+	if ct := listen.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	events := bufio.NewReader(listen.Body)
+	readEvent(t, events)
+
+	resp, err = http.Post(srv.URL+"/v1/engines/"+name+":stop", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readJSON(t, resp, http.StatusOK, &v1.StopEngineResponse{})
+
+	for {
+		var update v1.ListenResponse
+		err = protojson.Unmarshal(readEvent(t, events), &update)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if update.GetUpdate().GetPhase() == v1.EnginePhase_PHASE_DONE {
+			break
+		}
+	}
+}
+
+func TestRESTReadOnly(t *testing.T) {
+	_, srv := startTestGateway(t, true)
+
+	resp, err := http.Post(srv.URL+"/v1/engines", "application/json", strings.NewReader(`{"metadata":{},"enginePath":"net/build.yaml"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/v1/readonly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ro v1.IsReadOnlyResponse
+	readJSON(t, resp, http.StatusOK, &ro)
+	if !ro.Readonly {
+		t.Error("gateway should report read-only mode")
+	}
+}
+
+func TestGRPCWeb(t *testing.T) {
+	service, srv := startTestGateway(t, false)
+	st, err := service.StartEngine(context.Background(), &v1.StartEngineRequest{
+		Metadata:   &v1.EngineMetadata{Owner: "tester"},
+		EnginePath: "net/build.yaml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []bool{false, true} {
+		contentType := "application/grpc-web+proto"
+		if text {
+			contentType = "application/grpc-web-text"
+		}
+		t.Run(contentType, func(t *testing.T) {
+			frames := grpcWebCall(t, srv.URL+"/v1.NetService/GetEngine", text, &v1.GetEngineRequest{Name: st.Status.Name})
+			if len(frames) != 2 {
+				t.Fatalf("expected a message and a trailer frame, got %d frames", len(frames))
+			}
+			var resp v1.GetEngineResponse
+			err := proto.Unmarshal(frames[0], &resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Result.Name != st.Status.Name {
+				t.Errorf("unexpected response: %v", &resp)
+			}
+			if trailer := string(frames[1]); !strings.Contains(trailer, "grpc-status: 0\r\n") {
+				t.Errorf("unexpected trailer: %q", trailer)
+			}
+
+			frames = grpcWebCall(t, srv.URL+"/v1.NetService/GetEngine", text, &v1.GetEngineRequest{Name: "does-not-exist.1"})
+			if len(frames) != 1 || !strings.Contains(string(frames[0]), "grpc-status: 5\r\n") {
+				t.Errorf("expected a NotFound trailer, got %q", frames)
+			}
+		})
+	}
+}
+
+// grpcWebCall makes a gRPC-Web call and returns the payloads of all response frames
+func grpcWebCall(t *testing.T, url string, text bool, req proto.Message) [][]byte {
+	t.Helper()
+
+	payload, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(payload)))
+	copy(body[5:], payload)
+	contentType := "application/grpc-web+proto"
+	if text {
+		body = []byte(base64.StdEncoding.EncodeToString(body))
+		contentType = "application/grpc-web-text"
+	}
+
+	resp, err := http.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var r io.Reader = resp.Body
+	if text {
+		r = &textReader{r: bufio.NewReader(resp.Body)}
+	}
+
+	var frames [][]byte
+	for {
+		var hdr [5]byte
+		_, err := io.ReadFull(r, hdr[:])
+		if err == io.EOF {
+			return frames
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(hdr[1:]))
+		_, err = io.ReadFull(r, frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func readJSON(t *testing.T, resp *http.Response, code int, msg proto.Message) {
+	t.Helper()
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != code {
+		t.Fatalf("expected status %d, got %d: %s", code, resp.StatusCode, body)
+	}
+	err = protojson.Unmarshal(body, msg)
+	if err != nil {
+		t.Fatalf("cannot parse %s: %v", body, err)
+	}
+}
+
+// readEvent returns the data of the next server-sent event
+func readEvent(t *testing.T, r *bufio.Reader) []byte {
+	t.Helper()
+
+	var data []byte
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("cannot read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return data
+		}
+		if strings.HasPrefix(line, "event: error") {
+			t.Fatalf("received error event")
+		}
+		data = append(data, strings.TrimPrefix(line, "data: ")...)
+	}
+}
+
+func TestWithGRPC(t *testing.T) {
+	service := engine.NewService(store.NewInMemoryEngineStore(), store.NewInMemoryLogStore(), nil)
+	grpcServer := grpc.NewServer()
+	v1.RegisterNetServiceServer(grpcServer, service)
+	srv := httptest.NewServer(WithGRPC(grpcServer, http.NotFoundHandler()))
+	t.Cleanup(srv.Close)
+
+	conn, err := grpc.Dial(strings.TrimPrefix(srv.URL, "http://"), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = v1.NewNetServiceClient(conn).ListEngines(context.Background(), &v1.ListEnginesRequest{})
+	if err != nil {
+		t.Errorf("native gRPC call failed: %v", err)
+	}
+
+	resp, err := http.Get(srv.URL + "/v1/engines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("HTTP requests should be passed on, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,278 @@
+package gateway
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	contentTypeGRPCWeb     = "application/grpc-web"
+	contentTypeGRPCWebText = "application/grpc-web-text"
+
+	// trailerFlag marks the frame carrying the trailers of a gRPC-Web response
+	trailerFlag = 0x80
+)
+
+func isGRPCWeb(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), contentTypeGRPCWeb)
+}
+
+// serveGRPCWeb serves a gRPC-Web call. Both the binary and the base64 encoded text format are supported.
+func (g *Gateway) serveGRPCWeb(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "gRPC-Web requests must use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		text    = strings.HasPrefix(r.Header.Get("Content-Type"), contentTypeGRPCWebText)
+		body    io.Reader
+		resp    = &grpcWebWriter{w: w, text: text, contentType: contentTypeGRPCWeb + "+proto"}
+		flusher http.Flusher
+	)
+	if text {
+		resp.contentType = contentTypeGRPCWebText + "+proto"
+		body = &textReader{r: bufio.NewReader(r.Body)}
+	} else {
+		body = bufio.NewReader(r.Body)
+	}
+	if f, ok := w.(http.Flusher); ok {
+		flusher = f
+	}
+
+	m, ok := g.lookup(r.URL.Path)
+	if !ok {
+		resp.finish(status.Errorf(codes.Unimplemented, "unknown method %s", r.URL.Path), nil)
+		return
+	}
+	ctx, cancel, err := incomingContext(r)
+	if err != nil {
+		resp.finish(err, nil)
+		return
+	}
+	defer cancel()
+
+	if m.Unary != nil {
+		res, err := g.invokeUnary(ctx, m, func(msg interface{}) error {
+			err := readFrame(body, msg)
+			if err == io.EOF {
+				return status.Error(codes.InvalidArgument, "request message is missing")
+			}
+			return err
+		})
+		if err == nil {
+			err = resp.writeMessage(res, nil)
+		}
+		resp.finish(err, nil)
+		return
+	}
+
+	stream := &serverStream{
+		ctx:  ctx,
+		recv: func(msg interface{}) error { return readFrame(body, msg) },
+	}
+	stream.send = func(msg interface{}) error {
+		err := resp.writeMessage(msg, stream.header)
+		if err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	err = g.invokeStream(m, stream)
+	resp.finish(err, stream.trailer)
+}
+
+// readFrame reads a single length-prefixed message. It returns io.EOF if there are no more messages.
+func readFrame(r io.Reader, msg interface{}) error {
+	var hdr [5]byte
+	_, err := io.ReadFull(r, hdr[:])
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot read message: %v", err)
+	}
+	if hdr[0] != 0 {
+		return status.Error(codes.Unimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > maxMessageSize {
+		return status.Errorf(codes.ResourceExhausted, "message of %d bytes exceeds the limit of %d bytes", size, maxMessageSize)
+	}
+	buf := make([]byte, size)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot read message: %v", err)
+	}
+
+	pm, ok := msg.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "%T is not a protobuf message", msg)
+	}
+	err = proto.Unmarshal(buf, pm)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "cannot unmarshal message: %v", err)
+	}
+	return nil
+}
+
+// grpcWebWriter writes the frames of a gRPC-Web response
+type grpcWebWriter struct {
+	w           http.ResponseWriter
+	text        bool
+	contentType string
+
+	wroteHeader bool
+}
+
+func (g *grpcWebWriter) writeHeader(md metadata.MD) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+
+	h := g.w.Header()
+	h.Set("Content-Type", g.contentType)
+	for k, vs := range md {
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+	g.w.WriteHeader(http.StatusOK)
+}
+
+func (g *grpcWebWriter) writeFrame(flag byte, payload []byte) error {
+	frame := make([]byte, 5+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	copy(frame[5:], payload)
+	if g.text {
+		frame = []byte(base64.StdEncoding.EncodeToString(frame))
+	}
+	_, err := g.w.Write(frame)
+	return err
+}
+
+func (g *grpcWebWriter) writeMessage(msg interface{}, header metadata.MD) error {
+	pm, ok := msg.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "%T is not a protobuf message", msg)
+	}
+	payload, err := proto.Marshal(pm)
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot marshal message: %v", err)
+	}
+	g.writeHeader(header)
+	return g.writeFrame(0, payload)
+}
+
+// finish writes the trailer frame which carries the status of the call
+func (g *grpcWebWriter) finish(err error, trailer metadata.MD) {
+	g.writeHeader(nil)
+
+	st := status.Convert(err)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "grpc-status: %d\r\n", st.Code())
+	if msg := st.Message(); msg != "" {
+		fmt.Fprintf(&buf, "grpc-message: %s\r\n", encodeGRPCMessage(msg))
+	}
+	if len(st.Details()) > 0 {
+		details, err := proto.Marshal(st.Proto())
+		if err == nil {
+			fmt.Fprintf(&buf, "grpc-status-details-bin: %s\r\n", base64.RawStdEncoding.EncodeToString(details))
+		}
+	}
+	for k, vs := range trailer {
+		for _, v := range vs {
+			fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+		}
+	}
+	_ = g.writeFrame(trailerFlag, buf.Bytes())
+}
+
+// encodeGRPCMessage percent-encodes a status message as the gRPC spec demands
+func encodeGRPCMessage(msg string) string {
+	var res strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			res.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&res, "%%%02X", c)
+	}
+	return res.String()
+}
+
+// textReader decodes a gRPC-Web text body. Clients may send several base64 chunks, each with
+// its own padding, so every quantum of four characters is decoded on its own.
+type textReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func (t *textReader) Read(p []byte) (int, error) {
+	for len(t.buf) == 0 {
+		var quantum [4]byte
+		n := 0
+		for n < len(quantum) {
+			c, err := t.r.ReadByte()
+			if err == io.EOF && n == 0 {
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, io.ErrUnexpectedEOF
+			}
+			if c == '\r' || c == '\n' {
+				continue
+			}
+			quantum[n] = c
+			n++
+		}
+
+		var dec [3]byte
+		m, err := base64.StdEncoding.Decode(dec[:], quantum[:])
+		if err != nil {
+			return 0, err
+		}
+		t.buf = dec[:m]
+	}
+
+	n := copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
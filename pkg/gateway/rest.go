@@ -0,0 +1,399 @@
+package gateway
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Route maps HTTP requests to a gRPC method.
+//
+// The request message is built from the JSON body (if Body is set), the query parameters and
+// the path parameters, in that order. Path and query parameters are named after the fields they
+// set and may only refer to scalar fields and timestamps. Streaming responses are sent as
+// server-sent events if the client accepts text/event-stream, and as newline delimited JSON otherwise.
+type Route struct {
+	// Method is the HTTP method, e.g. GET
+	Method string
+
+	// Pattern is the path of the route, e.g. /v1/engines/{name}:stop
+	Pattern string
+
+	// RPC is the full name of the gRPC method, e.g. /v1.NetService/StopEngine
+	RPC string
+
+	// Body is true if the request body holds the JSON encoded request message
+	Body bool
+}
+
+// DefaultRoutes expose NetService and NetUI as JSON over HTTP. StartLocalEngine is not
+// available, because it requires a client stream.
+var DefaultRoutes = []Route{
+	{Method: http.MethodGet, Pattern: "/v1/engines", RPC: "/v1.NetService/ListEngines"},
+	{Method: http.MethodPost, Pattern: "/v1/engines", RPC: "/v1.NetService/StartEngine", Body: true},
+	{Method: http.MethodPost, Pattern: "/v1/engines:search", RPC: "/v1.NetService/ListEngines", Body: true},
+	{Method: http.MethodGet, Pattern: "/v1/engines:subscribe", RPC: "/v1.NetService/Subscribe"},
+	{Method: http.MethodPost, Pattern: "/v1/engines:subscribe", RPC: "/v1.NetService/Subscribe", Body: true},
+	{Method: http.MethodGet, Pattern: "/v1/engines/{name}", RPC: "/v1.NetService/GetEngine"},
+	{Method: http.MethodGet, Pattern: "/v1/engines/{name}:listen", RPC: "/v1.NetService/Listen"},
+	{Method: http.MethodPost, Pattern: "/v1/engines/{name}:stop", RPC: "/v1.NetService/StopEngine"},
+	{Method: http.MethodPost, Pattern: "/v1/engines/{previous_engine}:replay", RPC: "/v1.NetService/StartFromPreviousEngine", Body: true},
+	{Method: http.MethodGet, Pattern: "/v1/specs", RPC: "/v1.NetUI/ListEngineSpecs"},
+	{Method: http.MethodGet, Pattern: "/v1/readonly", RPC: "/v1.NetUI/IsReadOnly"},
+}
+
+// serveREST serves a JSON route
+func (g *Gateway) serveREST(w http.ResponseWriter, r *http.Request) {
+	routes := g.Routes
+	if routes == nil {
+		routes = DefaultRoutes
+	}
+
+	var (
+		route     *Route
+		params    map[string]string
+		wrongVerb bool
+	)
+	for i := range routes {
+		p, ok := matchPattern(routes[i].Pattern, r.URL.Path)
+		if !ok {
+			continue
+		}
+		if routes[i].Method != r.Method {
+			wrongVerb = true
+			continue
+		}
+		route, params = &routes[i], p
+		break
+	}
+	if route == nil {
+		if wrongVerb {
+			writeError(w, status.Errorf(codes.Unimplemented, "method %s is not allowed for %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+			return
+		}
+		writeError(w, status.Errorf(codes.NotFound, "no route for %s", r.URL.Path), http.StatusNotFound)
+		return
+	}
+
+	m, ok := g.lookup(route.RPC)
+	if !ok {
+		writeError(w, status.Errorf(codes.Unimplemented, "method %s is not registered", route.RPC), 0)
+		return
+	}
+	ctx, cancel, err := incomingContext(r)
+	if err != nil {
+		writeError(w, err, 0)
+		return
+	}
+	defer cancel()
+
+	decode := func(msg interface{}) error {
+		pm, ok := msg.(proto.Message)
+		if !ok {
+			return status.Errorf(codes.Internal, "%T is not a protobuf message", msg)
+		}
+		return decodeRequest(r, route, params, pm)
+	}
+
+	if m.Unary != nil {
+		res, err := g.invokeUnary(ctx, m, decode)
+		if err != nil {
+			writeError(w, err, 0)
+			return
+		}
+		body, err := marshalJSON(res)
+		if err != nil {
+			writeError(w, err, 0)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+		return
+	}
+
+	if m.Stream.ClientStreams {
+		writeError(w, status.Errorf(codes.Unimplemented, "%s requires a client stream and is only available via gRPC-Web", route.RPC), 0)
+		return
+	}
+	var (
+		sse     = strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+		started bool
+		decoded bool
+	)
+	stream := &serverStream{ctx: ctx}
+	stream.recv = func(msg interface{}) error {
+		if decoded {
+			return io.EOF
+		}
+		decoded = true
+		return decode(msg)
+	}
+	stream.send = func(msg interface{}) error {
+		body, err := marshalJSON(msg)
+		if err != nil {
+			return err
+		}
+		if !started {
+			started = true
+			if sse {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+			} else {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+		if sse {
+			_, err = fmt.Fprintf(w, "data: %s\n\n", body)
+		} else {
+			_, err = fmt.Fprintf(w, "{\"result\":%s}\n", body)
+		}
+		if err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	err = g.invokeStream(m, stream)
+	if err == nil {
+		return
+	}
+	if !started {
+		writeError(w, err, 0)
+		return
+	}
+	// the response has started already, hence the error becomes part of the stream
+	body := statusJSON(err)
+	if sse {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", body)
+	} else {
+		fmt.Fprintf(w, "{\"error\":%s}\n", body)
+	}
+}
+
+// matchPattern matches a path against a route pattern and returns the path parameters
+func matchPattern(pattern, path string) (map[string]string, bool) {
+	pp := strings.Split(strings.Trim(pattern, "/"), "/")
+	ps := strings.Split(strings.Trim(path, "/"), "/")
+	if len(pp) != len(ps) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, seg := range pp {
+		if !strings.HasPrefix(seg, "{") {
+			if seg != ps[i] {
+				return nil, false
+			}
+			continue
+		}
+
+		end := strings.Index(seg, "}")
+		name, verb := seg[1:end], seg[end+1:]
+		val := ps[i]
+		if verb != "" {
+			if !strings.HasSuffix(val, verb) {
+				return nil, false
+			}
+			val = strings.TrimSuffix(val, verb)
+		} else if strings.Contains(val, ":") {
+			// a path like /v1/engines/foo:stop must not match /v1/engines/{name}
+			return nil, false
+		}
+		if val == "" {
+			return nil, false
+		}
+		params[name] = val
+	}
+	return params, true
+}
+
+// decodeRequest builds a request message from the body, query and path parameters of r
+func decodeRequest(r *http.Request, route *Route, params map[string]string, msg proto.Message) error {
+	if route.Body {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "cannot read request: %v", err)
+		}
+		if len(body) > maxMessageSize {
+			return status.Errorf(codes.ResourceExhausted, "request exceeds the limit of %d bytes", maxMessageSize)
+		}
+		if len(body) > 0 {
+			err = protojson.Unmarshal(body, msg)
+			if err != nil {
+				return status.Errorf(codes.InvalidArgument, "cannot parse request: %v", err)
+			}
+		}
+	}
+
+	for k, vs := range r.URL.Query() {
+		if len(vs) == 0 {
+			continue
+		}
+		err := setField(msg, k, vs[len(vs)-1])
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid query parameter %s: %v", k, err)
+		}
+	}
+	for k, v := range params {
+		err := setField(msg, k, v)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid path parameter %s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+// setField sets a scalar or timestamp field of msg from its string representation
+func setField(msg proto.Message, name, value string) error {
+	m := msg.ProtoReflect()
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		fd = m.Descriptor().Fields().ByJSONName(name)
+	}
+	if fd == nil {
+		return fmt.Errorf("unknown field")
+	}
+	if fd.IsList() || fd.IsMap() {
+		return fmt.Errorf("repeated fields cannot be set this way")
+	}
+
+	var v protoreflect.Value
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(value)
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		v = protoreflect.ValueOfInt32(int32(i))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v = protoreflect.ValueOfInt64(i)
+	case protoreflect.EnumKind:
+		ev := fd.Enum().Values().ByName(protoreflect.Name(value))
+		if ev == nil {
+			return fmt.Errorf("unknown value %s", value)
+		}
+		v = protoreflect.ValueOfEnum(ev.Number())
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() != "google.protobuf.Timestamp" {
+			return fmt.Errorf("message fields cannot be set this way")
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return err
+		}
+		v = protoreflect.ValueOfMessage(timestamppb.New(t).ProtoReflect())
+	default:
+		return fmt.Errorf("unsupported field type %s", fd.Kind())
+	}
+	m.Set(fd, v)
+	return nil
+}
+
+func marshalJSON(msg interface{}) ([]byte, error) {
+	pm, ok := msg.(proto.Message)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "%T is not a protobuf message", msg)
+	}
+	res, err := protojson.Marshal(pm)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot marshal response: %v", err)
+	}
+	return res, nil
+}
+
+// statusJSON renders an error as JSON encoded google.rpc.Status
+func statusJSON(err error) []byte {
+	st := status.Convert(err)
+	res, merr := protojson.Marshal(st.Proto())
+	if merr != nil {
+		// details we cannot marshal are left out
+		res, _ = protojson.Marshal(status.New(st.Code(), st.Message()).Proto())
+	}
+	return res
+}
+
+// writeError writes an error response. If code is 0, the HTTP status is derived from the gRPC status.
+func writeError(w http.ResponseWriter, err error, code int) {
+	if code == 0 {
+		code = httpStatus(status.Code(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(statusJSON(err))
+}
+
+// httpStatus maps gRPC status codes to HTTP status codes
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,82 @@
+package local
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+// Repository describes the Git working copy dir belongs to. Information that cannot be determined,
+// e.g. because git is not installed or dir isn't a working copy, is left empty.
+func Repository(dir string) *v1.Repository {
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	res := ParseRemote(git("config", "--get", "remote.origin.url"))
+	res.Revision = git("rev-parse", "HEAD")
+	res.Ref = git("symbolic-ref", "-q", "HEAD")
+	return res
+}
+
+var scpLikeRemote = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// ParseRemote extracts host, owner and repo from a Git remote URL, e.g.
+// https://github.com/bhojpur/net.git or git@github.com:bhojpur/net.git
+func ParseRemote(remote string) *v1.Repository {
+	var host, p string
+	if i := strings.Index(remote, "://"); i >= 0 {
+		rest := remote[i+3:]
+		if j := strings.Index(rest, "/"); j >= 0 {
+			host, p = rest[:j], rest[j+1:]
+		}
+		if k := strings.LastIndex(host, "@"); k >= 0 {
+			host = host[k+1:]
+		}
+	} else if m := scpLikeRemote.FindStringSubmatch(remote); m != nil {
+		host, p = m[1], m[2]
+	}
+
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	if p == "" {
+		return &v1.Repository{}
+	}
+	owner := path.Dir(p)
+	if owner == "." {
+		owner = ""
+	}
+	return &v1.Repository{
+		Host:  host,
+		Owner: owner,
+		Repo:  path.Base(p),
+	}
+}
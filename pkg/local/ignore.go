@@ -0,0 +1,145 @@
+package local
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the file listing what's left out of the application archive
+const IgnoreFile = ".netignore"
+
+// defaultIgnore is applied before the rules of the ignore file, which can override it
+const defaultIgnore = ".git/\n"
+
+// Ignore decides which files are left out of the application archive. Its rules follow the
+// .gitignore syntax: patterns containing a slash are relative to the application directory,
+// all others match at any depth; a trailing slash matches directories only, a leading "!"
+// re-includes what an earlier pattern excluded and "**" matches any number of directories.
+type Ignore struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// LoadIgnore reads the .netignore file of an application directory.
+// A missing file is not an error, but yields the default rules which exclude .git.
+func LoadIgnore(dir string) (*Ignore, error) {
+	content, err := os.ReadFile(filepath.Join(dir, IgnoreFile))
+	if os.IsNotExist(err) {
+		return ParseIgnore(""), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseIgnore(string(content)), nil
+}
+
+// ParseIgnore parses ignore rules, one pattern per line. Empty lines and lines starting with # are skipped.
+func ParseIgnore(content string) *Ignore {
+	var res Ignore
+	scanner := bufio.NewScanner(strings.NewReader(defaultIgnore + content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			r.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		r.segments = strings.Split(line, "/")
+		res.rules = append(res.rules, r)
+	}
+	return &res
+}
+
+// Ignored returns true if the file at the slash-separated path relative to the application
+// directory is excluded. The last matching rule decides.
+func (ig *Ignore) Ignored(name string, isDir bool) bool {
+	segs := strings.Split(strings.Trim(name, "/"), "/")
+
+	var res bool
+	for _, r := range ig.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.matches(segs) {
+			res = !r.negate
+		}
+	}
+	return res
+}
+
+func (r ignoreRule) matches(segs []string) bool {
+	if r.anchored {
+		return matchSegments(r.segments, segs)
+	}
+	for i := range segs {
+		if matchSegments(r.segments, segs[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments, where "**" matches any number of segments
+func matchSegments(pattern, segs []string) bool {
+	if len(pattern) == 0 {
+		return len(segs) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegments(pattern[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], segs[0])
+	return ok && matchSegments(pattern[1:], segs[1:])
+}
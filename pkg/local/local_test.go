@@ -0,0 +1,168 @@
+package local_test
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/engine"
+	"github.com/bhojpur/net/pkg/local"
+	"github.com/bhojpur/net/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestIgnore(t *testing.T) {
+	ignore := local.ParseIgnore(`
+# build output
+/bin/
+*.log
+!important.log
+node_modules/
+docs/**/*.png
+`)
+	tests := []struct {
+		Path    string
+		IsDir   bool
+		Ignored bool
+	}{
+		{".git", true, true},
+		{"bin", true, true},
+		{"bin", false, false},
+		{"cmd/bin", true, false},
+		{"build.log", false, true},
+		{"logs/build.log", false, true},
+		{"logs/important.log", false, false},
+		{"web/node_modules", true, true},
+		{"docs/a/b/diagram.png", false, true},
+		{"docs/diagram.png", false, true},
+		{"img/diagram.png", false, false},
+		{"main.go", false, false},
+	}
+	for _, test := range tests {
+		if act := ignore.Ignored(test.Path, test.IsDir); act != test.Ignored {
+			t.Errorf("Ignored(%q, %v) = %v, expected %v", test.Path, test.IsDir, act, test.Ignored)
+		}
+	}
+}
+
+func TestParseRemote(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/bhojpur/net.git": "github.com bhojpur net",
+		"git@github.com:bhojpur/net.git":     "github.com bhojpur net",
+		"ssh://git@gitlab.com/group/sub/net": "gitlab.com group/sub net",
+		"https://user@example.com/net.git":   "example.com  net",
+		"":                                   "  ",
+	}
+	for remote, expected := range tests {
+		r := local.ParseRemote(remote)
+		if act := r.Host + " " + r.Owner + " " + r.Repo; act != expected {
+			t.Errorf("ParseRemote(%q) = %q, expected %q", remote, act, expected)
+		}
+	}
+}
+
+// applicationExecutor reads a file from the application it's asked to start
+type applicationExecutor struct {
+	File    string
+	Content chan string
+}
+
+func (e *applicationExecutor) Start(ctx context.Context, status *v1.EngineStatus, spec engine.StartSpec, rep engine.Reporter) error {
+	defer os.RemoveAll(spec.Application)
+	content, err := os.ReadFile(filepath.Join(spec.Application, e.File))
+	if err != nil {
+		return err
+	}
+	e.Content <- string(content)
+	return nil
+}
+
+func (e *applicationExecutor) Stop(name, reason string) error { return nil }
+
+func TestStart(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"net/config.yaml": "defaultEngine: build\n",
+		"net/build.yaml":  "pod: {}\n",
+		"src/main.go":     "package main\n",
+		"debug.log":       "should not be uploaded",
+		".netignore":      "*.log\n",
+	}
+	for fn, content := range files {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(fn)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, fn), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	executor := &applicationExecutor{File: "src/main.go", Content: make(chan string, 1)}
+	service := engine.NewService(store.NewInMemoryEngineStore(), store.NewInMemoryLogStore(), executor)
+	service.UploadDir = t.TempDir()
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	v1.RegisterNetServiceServer(srv, service)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ignore, err := local.LoadIgnore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent int64
+	st, err := local.Start(context.Background(), v1.NewNetServiceClient(conn), local.Engine{
+		Metadata:   &v1.EngineMetadata{Owner: "tester", EngineSpecName: "build"},
+		ConfigYAML: []byte(files["net/config.yaml"]),
+		EngineYAML: []byte(files["net/build.yaml"]),
+		Dir:        dir,
+		Ignore:     ignore,
+		Progress:   func(n int64) { sent = n },
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if st.Name != "build.1" {
+		t.Errorf("unexpected engine name %q", st.Name)
+	}
+	if sent == 0 {
+		t.Error("progress was not reported")
+	}
+	if content := <-executor.Content; content != files["src/main.go"] {
+		t.Errorf("unexpected application content: %q", content)
+	}
+}
@@ -0,0 +1,139 @@
+package local
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+// chunkSize is the maximum number of bytes sent per message
+const chunkSize = 256 * 1024
+
+// Engine is an engine to be started from a local working copy
+type Engine struct {
+	Metadata   *v1.EngineMetadata
+	ConfigYAML []byte
+	EngineYAML []byte
+
+	// Dir is the application directory that's packed and uploaded
+	Dir    string
+	Ignore *Ignore
+
+	// Progress, if set, is called with the number of application bytes sent so far
+	Progress func(sent int64)
+}
+
+// Start uploads an engine using StartLocalEngine. The messages are sent in the order the API demands:
+// metadata, config YAML, engine YAML, the gzipped application tar and its done marker.
+// The application is packed while it's being sent.
+func Start(ctx context.Context, client v1.NetServiceClient, engine Engine) (*v1.EngineStatus, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.StartLocalEngine(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = send(stream, engine)
+	if errors.Is(err, io.EOF) {
+		// the server has closed the stream - CloseAndRecv tells us why
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Status, nil
+}
+
+func send(stream v1.NetService_StartLocalEngineClient, engine Engine) error {
+	err := stream.Send(&v1.StartLocalEngineRequest{Content: &v1.StartLocalEngineRequest_Metadata{Metadata: engine.Metadata}})
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks(engine.ConfigYAML) {
+		err = stream.Send(&v1.StartLocalEngineRequest{Content: &v1.StartLocalEngineRequest_ConfigYaml{ConfigYaml: c}})
+		if err != nil {
+			return err
+		}
+	}
+	for _, c := range chunks(engine.EngineYAML) {
+		err = stream.Send(&v1.StartLocalEngineRequest{Content: &v1.StartLocalEngineRequest_EngineYaml{EngineYaml: c}})
+		if err != nil {
+			return err
+		}
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(Pack(pw, engine.Dir, engine.Ignore))
+	}()
+	defer pr.Close()
+
+	var (
+		buf  = make([]byte, chunkSize)
+		sent int64
+	)
+	for {
+		n, err := io.ReadFull(pr, buf)
+		if n > 0 {
+			serr := stream.Send(&v1.StartLocalEngineRequest{Content: &v1.StartLocalEngineRequest_ApplicationTar{ApplicationTar: append([]byte(nil), buf[:n]...)}})
+			if serr != nil {
+				return serr
+			}
+			sent += int64(n)
+			if engine.Progress != nil {
+				engine.Progress(sent)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return stream.Send(&v1.StartLocalEngineRequest{Content: &v1.StartLocalEngineRequest_ApplicationTarDone{ApplicationTarDone: true}})
+}
+
+// chunks splits content into messages of at most chunkSize bytes
+func chunks(content []byte) [][]byte {
+	var res [][]byte
+	for len(content) > 0 {
+		n := chunkSize
+		if n > len(content) {
+			n = len(content)
+		}
+		res = append(res, content[:n])
+		content = content[n:]
+	}
+	return res
+}
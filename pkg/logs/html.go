@@ -0,0 +1,310 @@
+package logs
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// maxPending limits how much of an incomplete escape sequence is kept between chunks.
+// Longer sequences are considered garbage and dropped.
+const maxPending = 256
+
+// HTMLRenderer converts text containing ANSI escape codes to HTML. Colours, bold, faint, italic and
+// underline become span elements carrying ansi-* classes (or inline colours for 256-colour and
+// true-colour codes), all other escape sequences are dropped and the text itself is HTML escaped.
+//
+// The renderer keeps the active style and incomplete escape sequences between calls to Render,
+// so text may be split into chunks anywhere. The HTML produced for each chunk is self-contained.
+type HTMLRenderer struct {
+	style   ansiStyle
+	pending string
+}
+
+// ansiStyle is the graphic rendition currently in effect
+type ansiStyle struct {
+	Bold      bool
+	Faint     bool
+	Italic    bool
+	Underline bool
+	// Foreground and Background are either empty, a class suffix like "fg-1" or a CSS colour like "#ff0000"
+	Foreground string
+	Background string
+}
+
+func (s ansiStyle) open() string {
+	var (
+		classes []string
+		css     []string
+	)
+	if s.Bold {
+		classes = append(classes, "ansi-bold")
+	}
+	if s.Faint {
+		classes = append(classes, "ansi-faint")
+	}
+	if s.Italic {
+		classes = append(classes, "ansi-italic")
+	}
+	if s.Underline {
+		classes = append(classes, "ansi-underline")
+	}
+	colour := func(prop, c string) {
+		switch {
+		case c == "":
+		case strings.HasPrefix(c, "#"):
+			css = append(css, prop+":"+c)
+		default:
+			classes = append(classes, "ansi-"+c)
+		}
+	}
+	colour("color", s.Foreground)
+	colour("background-color", s.Background)
+	if len(classes) == 0 && len(css) == 0 {
+		return ""
+	}
+
+	var res strings.Builder
+	res.WriteString("<span")
+	if len(classes) > 0 {
+		fmt.Fprintf(&res, ` class="%s"`, strings.Join(classes, " "))
+	}
+	if len(css) > 0 {
+		fmt.Fprintf(&res, ` style="%s"`, strings.Join(css, ";"))
+	}
+	res.WriteString(">")
+	return res.String()
+}
+
+// Render converts a chunk of text to HTML
+func (r *HTMLRenderer) Render(text string) string {
+	text = r.pending + text
+	r.pending = ""
+
+	var (
+		res  strings.Builder
+		open = r.style.open()
+		txt  strings.Builder
+	)
+	flush := func() {
+		if txt.Len() == 0 {
+			return
+		}
+		if open != "" {
+			res.WriteString(open)
+		}
+		res.WriteString(html.EscapeString(txt.String()))
+		if open != "" {
+			res.WriteString("</span>")
+		}
+		txt.Reset()
+	}
+
+	for i := 0; i < len(text); {
+		if text[i] != '\x1b' {
+			j := strings.IndexByte(text[i:], '\x1b')
+			if j < 0 {
+				j = len(text) - i
+			}
+			txt.WriteString(text[i : i+j])
+			i += j
+			continue
+		}
+
+		n, params, sgr := parseEscape(text[i:])
+		if n == 0 {
+			// incomplete sequence - wait for the next chunk
+			if len(text)-i <= maxPending {
+				r.pending = text[i:]
+			}
+			break
+		}
+		i += n
+		if !sgr {
+			continue
+		}
+
+		next := r.style.apply(params)
+		if next != r.style {
+			flush()
+			r.style = next
+			open = r.style.open()
+		}
+	}
+	flush()
+
+	return res.String()
+}
+
+// parseEscape parses the escape sequence at the beginning of s. It returns the length of the
+// sequence, or 0 if it's incomplete. Only SGR sequences (ESC [ ... m) yield parameters.
+func parseEscape(s string) (n int, params []int, sgr bool) {
+	if len(s) < 2 {
+		return 0, nil, false
+	}
+	switch s[1] {
+	case '[':
+		// CSI: parameter and intermediate bytes followed by a final byte
+		for i := 2; i < len(s); i++ {
+			c := s[i]
+			if c >= 0x40 && c <= 0x7e {
+				if c != 'm' {
+					return i + 1, nil, false
+				}
+				return i + 1, parseParams(s[2:i]), true
+			}
+			if c < 0x20 || c > 0x3f {
+				// not a valid CSI sequence - drop what we've seen so far
+				return i, nil, false
+			}
+		}
+		return 0, nil, false
+	case ']':
+		// OSC: terminated by BEL or ST (ESC \)
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1, nil, false
+			}
+			if s[i] == '\x1b' {
+				if i+1 == len(s) {
+					return 0, nil, false
+				}
+				if s[i+1] == '\\' {
+					return i + 2, nil, false
+				}
+			}
+		}
+		return 0, nil, false
+	default:
+		return 2, nil, false
+	}
+}
+
+func parseParams(s string) []int {
+	if s == "" {
+		return []int{0}
+	}
+	segs := strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == ':' })
+	res := make([]int, 0, len(segs))
+	for _, seg := range segs {
+		v, err := strconv.Atoi(seg)
+		if err != nil {
+			v = 0
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+// apply returns the style after applying the SGR parameters
+func (s ansiStyle) apply(params []int) ansiStyle {
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		switch {
+		case p == 0:
+			s = ansiStyle{}
+		case p == 1:
+			s.Bold = true
+		case p == 2:
+			s.Faint = true
+		case p == 3:
+			s.Italic = true
+		case p == 4:
+			s.Underline = true
+		case p == 22:
+			s.Bold, s.Faint = false, false
+		case p == 23:
+			s.Italic = false
+		case p == 24:
+			s.Underline = false
+		case p >= 30 && p <= 37:
+			s.Foreground = fmt.Sprintf("fg-%d", p-30)
+		case p >= 90 && p <= 97:
+			s.Foreground = fmt.Sprintf("fg-%d", p-90+8)
+		case p == 39:
+			s.Foreground = ""
+		case p >= 40 && p <= 47:
+			s.Background = fmt.Sprintf("bg-%d", p-40)
+		case p >= 100 && p <= 107:
+			s.Background = fmt.Sprintf("bg-%d", p-100+8)
+		case p == 49:
+			s.Background = ""
+		case p == 38 || p == 48:
+			c, n := extendedColour(params[i+1:], p == 38)
+			i += n
+			if p == 38 {
+				s.Foreground = c
+			} else {
+				s.Background = c
+			}
+		}
+	}
+	return s
+}
+
+// extendedColour parses the parameters following 38 or 48, i.e. 5;n or 2;r;g;b.
+// It returns the colour and the number of parameters consumed.
+func extendedColour(params []int, fg bool) (colour string, n int) {
+	if len(params) >= 2 && params[0] == 5 {
+		idx := params[1]
+		if idx < 16 {
+			if fg {
+				return fmt.Sprintf("fg-%d", idx), 2
+			}
+			return fmt.Sprintf("bg-%d", idx), 2
+		}
+		return palette256(idx), 2
+	}
+	if len(params) >= 4 && params[0] == 2 {
+		return fmt.Sprintf("#%02x%02x%02x", clamp(params[1]), clamp(params[2]), clamp(params[3])), 4
+	}
+	return "", len(params)
+}
+
+// palette256 returns the CSS colour of an xterm 256-colour palette entry beyond the first 16
+func palette256(idx int) string {
+	idx = clamp(idx)
+	if idx >= 232 {
+		v := 8 + (idx-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+	idx -= 16
+	level := func(v int) int {
+		if v == 0 {
+			return 0
+		}
+		return 55 + v*40
+	}
+	return fmt.Sprintf("#%02x%02x%02x", level(idx/36), level((idx/6)%6), level(idx%6))
+}
+
+func clamp(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
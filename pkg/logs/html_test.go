@@ -0,0 +1,75 @@
+package logs
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import "testing"
+
+func TestHTMLRenderer(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Chunks   []string
+		Expected []string
+	}{
+		{"plain", []string{"hello world"}, []string{"hello world"}},
+		{"escapes html", []string{`<script>alert("hi")</script> & more`}, []string{"&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt; &amp; more"}},
+		{
+			"colour and reset",
+			[]string{"\x1b[31merror\x1b[0m: boom"},
+			[]string{`<span class="ansi-fg-1">error</span>: boom`},
+		},
+		{
+			"bold underline bright",
+			[]string{"\x1b[1;4;92mok\x1b[22m still underlined"},
+			[]string{`<span class="ansi-bold ansi-underline ansi-fg-10">ok</span><span class="ansi-underline ansi-fg-10"> still underlined</span>`},
+		},
+		{
+			"style carries across chunks",
+			[]string{"\x1b[33mwarning", "continued\x1b[39m", "plain"},
+			[]string{`<span class="ansi-fg-3">warning</span>`, `<span class="ansi-fg-3">continued</span>`, "plain"},
+		},
+		{
+			"escape split across chunks",
+			[]string{"before\x1b[3", "2mgreen"},
+			[]string{"before", `<span class="ansi-fg-2">green</span>`},
+		},
+		{
+			"extended colours",
+			[]string{"\x1b[38;5;196;48;2;0;0;255mx"},
+			[]string{`<span style="color:#ff0000;background-color:#0000ff">x</span>`},
+		},
+		{
+			"other sequences are dropped",
+			[]string{"\x1b[2Kclear\x1b]0;title\aline"},
+			[]string{"clearline"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var r HTMLRenderer
+			for i, c := range test.Chunks {
+				if act := r.Render(c); act != test.Expected[i] {
+					t.Errorf("chunk %d:\nexpected: %s\n  actual: %s", i, test.Expected[i], act)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package logs
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"regexp"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+// Engines structure their output into slices using in-band markers at the beginning of a line:
+//
+//	[build|PHASE] Building the application     enters a new phase, named after the slice
+//	[build|START]                              starts the build slice
+//	[build] compiling main.go                  adds content to the build slice
+//	[build|DONE]                               finishes the build slice
+//	[build|FAIL] compilation failed            fails the build slice
+//	[url|RESULT] https://bhojpur.net           publishes a result of type url
+//
+// Lines without a marker are content of the unnamed slice. Slice names must not contain spaces or colons,
+// so that bracketed timestamps like [2024-01-01 12:00:00] are not mistaken for markers.
+var marker = regexp.MustCompile(`^\[([\w.\-/@]+)(?:\|(PHASE|START|DONE|FAIL|RESULT))?\] ?(.*)$`)
+
+var markerTypes = map[string]v1.LogSliceType{
+	"":       v1.LogSliceType_SLICE_CONTENT,
+	"PHASE":  v1.LogSliceType_SLICE_PHASE,
+	"START":  v1.LogSliceType_SLICE_START,
+	"DONE":   v1.LogSliceType_SLICE_DONE,
+	"FAIL":   v1.LogSliceType_SLICE_FAIL,
+	"RESULT": v1.LogSliceType_SLICE_RESULT,
+}
+
+// Slicer turns the raw output of an engine into log slice events, one line at a time.
+// It keeps track of started slices, so that they can be abandoned if the engine stops
+// producing output before finishing them. Content alone does not start a slice.
+type Slicer struct {
+	open  map[string]struct{}
+	order []string
+}
+
+// Slice parses a single line of output, without its line ending
+func (s *Slicer) Slice(line string) *v1.LogSliceEvent {
+	m := marker.FindStringSubmatch(line)
+	if m == nil {
+		return &v1.LogSliceEvent{Type: v1.LogSliceType_SLICE_CONTENT, Payload: line}
+	}
+
+	evt := &v1.LogSliceEvent{Name: m[1], Type: markerTypes[m[2]], Payload: m[3]}
+	switch evt.Type {
+	case v1.LogSliceType_SLICE_START:
+		s.markOpen(evt.Name)
+	case v1.LogSliceType_SLICE_DONE, v1.LogSliceType_SLICE_FAIL:
+		s.markClosed(evt.Name)
+	}
+	return evt
+}
+
+// Close abandons all slices which were started but never finished, in the order they were started
+func (s *Slicer) Close() []*v1.LogSliceEvent {
+	var res []*v1.LogSliceEvent
+	for _, name := range s.order {
+		res = append(res, &v1.LogSliceEvent{Name: name, Type: v1.LogSliceType_SLICE_ABANDONED})
+	}
+	s.open = nil
+	s.order = nil
+	return res
+}
+
+func (s *Slicer) markOpen(name string) {
+	if _, ok := s.open[name]; ok {
+		return
+	}
+	if s.open == nil {
+		s.open = make(map[string]struct{})
+	}
+	s.open[name] = struct{}{}
+	s.order = append(s.order, name)
+}
+
+func (s *Slicer) markClosed(name string) {
+	if _, ok := s.open[name]; !ok {
+		return
+	}
+	delete(s.open, name)
+	for i, n := range s.order {
+		if n == name {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Flatten turns a slice event into plain content as served for ListenRequestLogs_LOGS_UNSLICED.
+// Slice boundaries carry no content and yield nil, everything else becomes a content event
+// of the unnamed slice.
+func Flatten(evt *v1.LogSliceEvent) *v1.LogSliceEvent {
+	var payload string
+	switch evt.Type {
+	case v1.LogSliceType_SLICE_CONTENT:
+		payload = evt.Payload
+	case v1.LogSliceType_SLICE_PHASE:
+		payload = fmt.Sprintf("phase %s: %s", evt.Name, evt.Payload)
+	case v1.LogSliceType_SLICE_FAIL:
+		payload = fmt.Sprintf("%s failed: %s", evt.Name, evt.Payload)
+	case v1.LogSliceType_SLICE_RESULT:
+		payload = fmt.Sprintf("result %s: %s", evt.Name, evt.Payload)
+	case v1.LogSliceType_SLICE_ABANDONED:
+		payload = fmt.Sprintf("%s was abandoned", evt.Name)
+	default:
+		return nil
+	}
+	return &v1.LogSliceEvent{Type: v1.LogSliceType_SLICE_CONTENT, Payload: payload}
+}
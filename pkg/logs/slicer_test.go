@@ -0,0 +1,74 @@
+package logs
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+func TestSlicer(t *testing.T) {
+	tests := []struct {
+		Line    string
+		Name    string
+		Type    v1.LogSliceType
+		Payload string
+	}{
+		{"plain output", "", v1.LogSliceType_SLICE_CONTENT, "plain output"},
+		{"[build|PHASE] Building the app", "build", v1.LogSliceType_SLICE_PHASE, "Building the app"},
+		{"[build|START]", "build", v1.LogSliceType_SLICE_START, ""},
+		{"[build]   indented", "build", v1.LogSliceType_SLICE_CONTENT, "  indented"},
+		{"[build|FAIL] exit code 1", "build", v1.LogSliceType_SLICE_FAIL, "exit code 1"},
+		{"[url|RESULT] https://bhojpur.net", "url", v1.LogSliceType_SLICE_RESULT, "https://bhojpur.net"},
+		{"[build|UNKNOWN] no marker", "", v1.LogSliceType_SLICE_CONTENT, "[build|UNKNOWN] no marker"},
+		{"[] empty name", "", v1.LogSliceType_SLICE_CONTENT, "[] empty name"},
+		{"[2024-01-01 12:00:00] started", "", v1.LogSliceType_SLICE_CONTENT, "[2024-01-01 12:00:00] started"},
+		{"[12:00:00] started", "", v1.LogSliceType_SLICE_CONTENT, "[12:00:00] started"},
+		{"[INFO] listening", "INFO", v1.LogSliceType_SLICE_CONTENT, "listening"},
+	}
+
+	var s Slicer
+	for _, test := range tests {
+		evt := s.Slice(test.Line)
+		if evt.Name != test.Name || evt.Type != test.Type || evt.Payload != test.Payload {
+			t.Errorf("Slice(%q) = %v, expected %s/%v/%q", test.Line, evt, test.Name, test.Type, test.Payload)
+		}
+	}
+	if abandoned := s.Close(); len(abandoned) != 0 {
+		t.Errorf("failed slice and content without start should not be abandoned: %v", abandoned)
+	}
+}
+
+func TestSlicerAbandons(t *testing.T) {
+	var s Slicer
+	for _, l := range []string{"[a|START]", "[b] content", "[c|START]", "[c] content", "[d|START]", "[a|DONE]"} {
+		s.Slice(l)
+	}
+
+	abandoned := s.Close()
+	if len(abandoned) != 2 || abandoned[0].Name != "c" || abandoned[1].Name != "d" {
+		t.Fatalf("expected c and d to be abandoned, got %v", abandoned)
+	}
+	if abandoned[0].Type != v1.LogSliceType_SLICE_ABANDONED {
+		t.Errorf("unexpected type %v", abandoned[0].Type)
+	}
+}
@@ -0,0 +1,295 @@
+package logs
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiFaint  = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+
+	// clearLine moves the cursor to the beginning of the line and clears it
+	clearLine = "\r\x1b[K"
+)
+
+// TerminalRenderer prints the log slices and status updates of an engine, as streamed by the Listen
+// call with ListenRequestLogs_LOGS_RAW, for humans. Slices are grouped into sections below a header line,
+// results are highlighted and the engine's outcome is printed once it's done.
+//
+// In interactive mode the renderer uses colours, keeps a status line showing the engine's current
+// phase at the bottom of the output and collapses sections into a single line once they're done.
+// Otherwise all escape sequences are removed from the output, which makes it suitable for log files.
+type TerminalRenderer struct {
+	Out         io.Writer
+	Interactive bool
+	// Width is the width of the terminal in interactive mode. It's used to determine how many rows
+	// wrapped lines take up when collapsing a section. Zero means lines never wrap.
+	Width int
+
+	// current is the section whose header and content make up the end of the output, if any.
+	// Only the current section can be collapsed.
+	current     string
+	currentRows int
+	lines       map[string]int
+	results     map[string]struct{}
+
+	phase      v1.EnginePhase
+	phaseSlice string
+	status     string
+	final      *v1.EngineStatus
+}
+
+// Slice renders a log slice event
+func (r *TerminalRenderer) Slice(evt *v1.LogSliceEvent) {
+	switch evt.Type {
+	case v1.LogSliceType_SLICE_PHASE:
+		r.phaseSlice = evt.Payload
+		if r.phaseSlice == "" {
+			r.phaseSlice = evt.Name
+		}
+		r.println("", r.style(ansiBold, "== "+r.phaseSlice))
+	case v1.LogSliceType_SLICE_START:
+		r.startSection(evt.Name, evt.Payload)
+	case v1.LogSliceType_SLICE_CONTENT:
+		if evt.Name == "" {
+			r.println("", r.sanitize(evt.Payload))
+			return
+		}
+		if r.current != evt.Name {
+			// content of a section which isn't at the end of the output - repeat its header
+			r.startSection(evt.Name, "(continued)")
+		}
+		r.println(evt.Name, r.style(ansiFaint, "  │ ")+r.sanitize(evt.Payload))
+		r.lines[evt.Name]++
+	case v1.LogSliceType_SLICE_DONE:
+		line := r.style(ansiGreen, "✔ "+evt.Name)
+		if r.Interactive && r.current == evt.Name {
+			r.collapse()
+			line += r.style(ansiFaint, fmt.Sprintf(" (%d lines)", r.lines[evt.Name]))
+		}
+		r.println("", line)
+	case v1.LogSliceType_SLICE_FAIL:
+		line := "✘ " + evt.Name
+		if evt.Payload != "" {
+			line += ": " + evt.Payload
+		}
+		r.println("", r.style(ansiRed, line))
+	case v1.LogSliceType_SLICE_RESULT:
+		r.result(&v1.EngineResult{Type: evt.Name, Payload: evt.Payload})
+	case v1.LogSliceType_SLICE_ABANDONED:
+		r.println("", r.style(ansiYellow, "⚠ "+evt.Name+" was abandoned"))
+	}
+}
+
+// Update renders a status update of the engine
+func (r *TerminalRenderer) Update(st *v1.EngineStatus) {
+	r.phase = st.Phase
+	if st.Phase == v1.EnginePhase_PHASE_DONE {
+		r.final = st
+	}
+	r.redrawStatus()
+}
+
+// Close removes the status line and, if the engine is done, prints the results it reported
+// (unless they were already rendered as slices) and its outcome. Listen sends the final status
+// of a finished engine before its logs, hence the outcome is printed only once all logs are in.
+// Close returns the final status of the engine, or nil if the engine wasn't done.
+func (r *TerminalRenderer) Close() *v1.EngineStatus {
+	r.clearStatus()
+
+	st := r.final
+	if st == nil {
+		return nil
+	}
+	for _, res := range st.Results {
+		r.result(res)
+	}
+	line := "engine " + st.Name
+	if st.Conditions.GetSuccess() {
+		line = r.style(ansiGreen, "✔ "+line+" succeeded")
+	} else {
+		line = r.style(ansiRed, "✘ "+line+" failed")
+	}
+	if st.Details != "" {
+		line += ": " + st.Details
+	}
+	r.println("", line)
+	return st
+}
+
+func (r *TerminalRenderer) startSection(name, payload string) {
+	line := "▶ " + name
+	if payload != "" {
+		line += " " + payload
+	}
+	r.println(name, r.style(ansiCyan, line))
+	if r.lines == nil {
+		r.lines = make(map[string]int)
+	}
+}
+
+func (r *TerminalRenderer) result(res *v1.EngineResult) {
+	key := res.Type + "\x00" + res.Payload
+	if _, ok := r.results[key]; ok {
+		return
+	}
+	if r.results == nil {
+		r.results = make(map[string]struct{})
+	}
+	r.results[key] = struct{}{}
+
+	line := r.style(ansiBold+ansiYellow, "★ "+res.Type+": "+res.Payload)
+	if res.Description != "" {
+		line += " " + r.style(ansiFaint, res.Description)
+	}
+	r.println("", line)
+}
+
+// println prints a line which belongs to the section named section, or to no section at all if it's empty
+func (r *TerminalRenderer) println(section, line string) {
+	r.clearStatus()
+	fmt.Fprintln(r.Out, line)
+
+	if section == "" || section != r.current {
+		r.current = section
+		r.currentRows = 0
+	}
+	if section != "" {
+		r.currentRows += r.rows(line)
+	}
+	r.redrawStatus()
+}
+
+// collapse removes the current section from the output
+func (r *TerminalRenderer) collapse() {
+	r.clearStatus()
+	if r.currentRows > 0 {
+		fmt.Fprintf(r.Out, "\x1b[%dA\x1b[J", r.currentRows)
+	}
+	r.current = ""
+	r.currentRows = 0
+}
+
+func (r *TerminalRenderer) clearStatus() {
+	if r.status == "" {
+		return
+	}
+	fmt.Fprint(r.Out, clearLine)
+	r.status = ""
+}
+
+func (r *TerminalRenderer) redrawStatus() {
+	if !r.Interactive || r.phase == v1.EnginePhase_PHASE_UNKNOWN || r.phase == v1.EnginePhase_PHASE_DONE {
+		return
+	}
+	status := "● " + strings.ToLower(strings.TrimPrefix(r.phase.String(), "PHASE_"))
+	if r.phaseSlice != "" {
+		status += ": " + r.phaseSlice
+	}
+	if r.Width > 0 {
+		status = truncate(status, r.Width-1)
+	}
+	r.clearStatus()
+	fmt.Fprint(r.Out, r.style(ansiBold, status))
+	r.status = status
+}
+
+// rows returns the number of terminal rows a line takes up
+func (r *TerminalRenderer) rows(line string) int {
+	w := utf8.RuneCountInString(stripEscapes(line))
+	if r.Width <= 0 || w <= r.Width {
+		return 1
+	}
+	return (w + r.Width - 1) / r.Width
+}
+
+func (r *TerminalRenderer) style(style, text string) string {
+	if !r.Interactive {
+		return text
+	}
+	return style + text + ansiReset
+}
+
+// sanitize prepares engine output for printing. In interactive mode colours are kept and reset
+// at the end of the line, other escape sequences which could mess with the cursor are always removed.
+func (r *TerminalRenderer) sanitize(text string) string {
+	var (
+		res      strings.Builder
+		coloured bool
+	)
+	for i := 0; i < len(text); {
+		c := text[i]
+		if c == '\r' {
+			i++
+			continue
+		}
+		if c != '\x1b' {
+			res.WriteByte(c)
+			i++
+			continue
+		}
+
+		n, _, sgr := parseEscape(text[i:])
+		if n == 0 {
+			// incomplete sequence at the end of the line
+			break
+		}
+		if sgr && r.Interactive {
+			res.WriteString(text[i : i+n])
+			coloured = true
+		}
+		i += n
+	}
+	if coloured {
+		res.WriteString(ansiReset)
+	}
+	return res.String()
+}
+
+// stripEscapes removes all escape sequences from text
+func stripEscapes(text string) string {
+	if strings.IndexByte(text, '\x1b') < 0 {
+		return text
+	}
+	r := TerminalRenderer{}
+	return r.sanitize(text)
+}
+
+// truncate shortens text to at most n runes
+func truncate(text string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,128 @@
+package logs
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"testing"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+func TestTerminalRenderer(t *testing.T) {
+	slice := func(name string, tpe v1.LogSliceType, payload string) *v1.LogSliceEvent {
+		return &v1.LogSliceEvent{Name: name, Type: tpe, Payload: payload}
+	}
+	events := []interface{}{
+		&v1.EngineStatus{Name: "net.1", Phase: v1.EnginePhase_PHASE_RUNNING},
+		slice("build", v1.LogSliceType_SLICE_PHASE, "Building"),
+		slice("compile", v1.LogSliceType_SLICE_START, ""),
+		slice("compile", v1.LogSliceType_SLICE_CONTENT, "\x1b[32mmain.go\x1b[0m"),
+		slice("", v1.LogSliceType_SLICE_CONTENT, "unsliced\r"),
+		slice("compile", v1.LogSliceType_SLICE_CONTENT, "util.go"),
+		slice("compile", v1.LogSliceType_SLICE_DONE, ""),
+		slice("test", v1.LogSliceType_SLICE_START, ""),
+		slice("test", v1.LogSliceType_SLICE_FAIL, "2 tests failed"),
+		slice("url", v1.LogSliceType_SLICE_RESULT, "https://bhojpur.net"),
+		&v1.EngineStatus{
+			Name:       "net.1",
+			Phase:      v1.EnginePhase_PHASE_DONE,
+			Conditions: &v1.EngineConditions{Success: false},
+			Details:    "tests failed",
+			Results: []*v1.EngineResult{
+				{Type: "url", Payload: "https://bhojpur.net"},
+				{Type: "report", Payload: "report.html", Description: "test report"},
+			},
+		},
+	}
+	render := func(r *TerminalRenderer) *v1.EngineStatus {
+		for _, evt := range events {
+			switch evt := evt.(type) {
+			case *v1.LogSliceEvent:
+				r.Slice(evt)
+			case *v1.EngineStatus:
+				r.Update(evt)
+			}
+		}
+		return r.Close()
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		var out bytes.Buffer
+		final := render(&TerminalRenderer{Out: &out})
+		if final == nil || final.Conditions.Success {
+			t.Errorf("expected a failed final status, got %v", final)
+		}
+
+		expected := "== Building\n" +
+			"▶ compile\n" +
+			"  │ main.go\n" +
+			"unsliced\n" +
+			"▶ compile (continued)\n" +
+			"  │ util.go\n" +
+			"✔ compile\n" +
+			"▶ test\n" +
+			"✘ test: 2 tests failed\n" +
+			"★ url: https://bhojpur.net\n" +
+			"★ report: report.html test report\n" +
+			"✘ engine net.1 failed: tests failed\n"
+		if act := out.String(); act != expected {
+			t.Errorf("unexpected output:\nexpected:\n%s\nactual:\n%s", expected, act)
+		}
+	})
+
+	t.Run("interactive", func(t *testing.T) {
+		var out bytes.Buffer
+		render(&TerminalRenderer{Out: &out, Interactive: true, Width: 80})
+
+		act := out.String()
+		for _, expected := range []string{
+			// status line
+			"\x1b[1m● running: Building\x1b[0m",
+			// colours of the engine output are kept
+			"\x1b[32mmain.go\x1b[0m\x1b[0m\n",
+			// the continued compile section (header and one line) is collapsed
+			"\r\x1b[K\x1b[2A\x1b[J\x1b[32m✔ compile\x1b[0m\x1b[2m (2 lines)\x1b[0m\n",
+		} {
+			if !bytes.Contains(out.Bytes(), []byte(expected)) {
+				t.Errorf("output does not contain %q:\n%q", expected, act)
+			}
+		}
+		if bytes.HasSuffix(out.Bytes(), []byte("\x1b[0m")) {
+			t.Errorf("status line was not removed: %q", act)
+		}
+	})
+}
+
+func TestTerminalRendererRows(t *testing.T) {
+	r := &TerminalRenderer{Width: 10}
+	for line, expected := range map[string]int{
+		"":                          1,
+		"0123456789":                1,
+		"0123456789a":               2,
+		"\x1b[31m0123456789\x1b[0m": 1,
+		"ääääääääääääääääääää": 2,
+	} {
+		if act := r.rows(line); act != expected {
+			t.Errorf("rows(%q) = %d, expected %d", line, act, expected)
+		}
+	}
+}
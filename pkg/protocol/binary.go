@@ -0,0 +1,104 @@
+package protocol
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+/**
+Placeholder of a binary attachment in packet args, refers to the attachment by its index
+*/
+type Placeholder struct {
+	Placeholder bool `json:"_placeholder"`
+	Num         int  `json:"num"`
+}
+
+/**
+Decode packet args, placeholders become the []byte attachments they refer to.
+Numbers are kept as json.Number, so they can be decoded into any type later.
+*/
+func DecodeArgs(args string, attachments [][]byte) ([]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader("[" + args + "]"))
+	decoder.UseNumber()
+
+	var values []interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+
+	for i := range values {
+		var err error
+		if values[i], err = replacePlaceholders(values[i], attachments); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+/**
+Replace placeholders in packet args with the attachments they refer to. The
+result is json text, so the attachments become base64 strings in it.
+*/
+func ReplacePlaceholders(args string, attachments [][]byte) (string, error) {
+	values, err := DecodeArgs(args, attachments)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(result[1 : len(result)-1]), nil
+}
+
+func replacePlaceholders(value interface{}, attachments [][]byte) (interface{}, error) {
+	var err error
+	switch value := value.(type) {
+	case []interface{}:
+		for i := range value {
+			if value[i], err = replacePlaceholders(value[i], attachments); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		if placeholder, _ := value["_placeholder"].(bool); placeholder {
+			num, ok := value["num"].(json.Number)
+			if !ok {
+				return nil, ErrorWrongPacket
+			}
+			i, err := num.Int64()
+			if err != nil || i < 0 || i >= int64(len(attachments)) {
+				return nil, ErrorWrongPacket
+			}
+			return attachments[i], nil
+		}
+
+		for key := range value {
+			if value[key], err = replacePlaceholders(value[key], attachments); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,124 @@
+package protocol
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	/**
+	Engine.IO v3, used by socket.io v2 clients
+	*/
+	Version3 = 3
+	/**
+	Engine.IO v4, used by socket.io v3 and later clients
+	*/
+	Version4 = 4
+)
+
+var (
+	ErrorUnsupportedVersion = errors.New("unsupported protocol version")
+
+	CodecV3 = &Codec{Version: Version3}
+	CodecV4 = &Codec{Version: Version4}
+)
+
+/**
+Encodes and decodes packets of one Engine.IO protocol version, and tells
+how the handshake and heartbeat of that version work
+*/
+type Codec struct {
+	/**
+	Engine.IO protocol version, as sent in the EIO query parameter
+	*/
+	Version int
+}
+
+/**
+Get codec by protocol version
+*/
+func CodecByVersion(version int) (*Codec, error) {
+	switch version {
+	case Version3:
+		return CodecV3, nil
+	case Version4:
+		return CodecV4, nil
+	}
+	return nil, ErrorUnsupportedVersion
+}
+
+/**
+Get codec by the value of the EIO query parameter, clients which don't send
+it are assumed to speak Engine.IO v3
+*/
+func CodecByQuery(eio string) (*Codec, error) {
+	if eio == "" {
+		return CodecV3, nil
+	}
+	version, err := strconv.Atoi(eio)
+	if err != nil {
+		return nil, ErrorUnsupportedVersion
+	}
+	return CodecByVersion(version)
+}
+
+/**
+Since v4 the server sends pings and the client answers with pongs,
+before it was the other way around
+*/
+func (c *Codec) ServerPings() bool {
+	return c.Version >= Version4
+}
+
+/**
+Since v4 clients have to send a CONNECT packet, optionally carrying an
+auth payload, and the server acknowledges it with the socket id. Before
+the server sent an empty CONNECT packet right after the handshake.
+*/
+func (c *Codec) ClientConnects() bool {
+	return c.Version >= Version4
+}
+
+/**
+Encode binary attachment to binary message, before v4 binary messages
+start with the message packet type like text ones
+*/
+func (c *Codec) EncodeAttachment(data []byte) []byte {
+	if c.Version >= Version4 {
+		return data
+	}
+	return append([]byte{4}, data...)
+}
+
+/**
+Decode binary message to binary attachment
+*/
+func (c *Codec) DecodeAttachment(message string) ([]byte, error) {
+	if c.Version >= Version4 {
+		return []byte(message), nil
+	}
+	if len(message) == 0 || message[0] != 4 {
+		return nil, ErrorWrongPacket
+	}
+	return []byte(message[1:]), nil
+}
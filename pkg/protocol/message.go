@@ -38,7 +38,8 @@ const (
 	*/
 	MessageTypePong = iota
 	/**
-	Empty message
+	Empty message, i.e. the socket.io CONNECT packet. Since Engine.IO v4 its
+	arguments carry the auth payload (client) or the socket id (server).
 	*/
 	MessageTypeEmpty = iota
 	/**
@@ -53,6 +54,14 @@ const (
 	ack response
 	*/
 	MessageTypeAckResponse = iota
+	/**
+	socket.io DISCONNECT packet
+	*/
+	MessageTypeDisconnect = iota
+	/**
+	socket.io CONNECT_ERROR packet, arguments carry the error
+	*/
+	MessageTypeError = iota
 )
 
 type Message struct {
@@ -61,4 +70,13 @@ type Message struct {
 	Method string
 	Args   string
 	Source string
+	/**
+	socket.io namespace of the packet, empty or "/" is the default one
+	*/
+	Namespace string
+	/**
+	Binary attachments of the packet, referred to by placeholders in args.
+	They are sent as separate binary messages following the packet.
+	*/
+	Attachments [][]byte
 }
@@ -28,11 +28,15 @@ import (
 )
 
 const (
-	open          = "0"
-	msg           = "4"
-	emptyMessage  = "40"
-	commonMessage = "42"
-	ackMessage    = "43"
+	open               = "0"
+	msg                = "4"
+	emptyMessage       = "40"
+	disconnectMessage  = "41"
+	commonMessage      = "42"
+	ackMessage         = "43"
+	errorMessage       = "44"
+	binaryEventMessage = "45"
+	binaryAckMessage   = "46"
 
 	CloseMessage = "1"
 	PingMessage  = "2"
@@ -60,18 +64,53 @@ func typeToText(msgType int) (string, error) {
 		return commonMessage, nil
 	case MessageTypeAckResponse:
 		return ackMessage, nil
+	case MessageTypeDisconnect:
+		return disconnectMessage, nil
+	case MessageTypeError:
+		return errorMessage, nil
 	}
 	return "", ErrorWrongMessageType
 }
 
+/**
+Encode message using the Engine.IO v3 codec
+*/
 func Encode(msg *Message) (string, error) {
+	return CodecV3.Encode(msg)
+}
+
+/**
+Encode message to packet text
+*/
+func (c *Codec) Encode(msg *Message) (string, error) {
 	result, err := typeToText(msg.Type)
 	if err != nil {
 		return "", err
 	}
 
+	if len(msg.Attachments) > 0 {
+		switch msg.Type {
+		case MessageTypeEmit, MessageTypeAckRequest:
+			result = binaryEventMessage
+		case MessageTypeAckResponse:
+			result = binaryAckMessage
+		default:
+			return "", ErrorWrongMessageType
+		}
+		result += strconv.Itoa(len(msg.Attachments)) + "-"
+	}
+
+	if isSocketPacket(msg.Type) && !isDefaultNamespace(msg.Namespace) {
+		result += msg.Namespace + ","
+	}
+
+	if msg.Type == MessageTypeEmpty && c.ClientConnects() ||
+		msg.Type == MessageTypeError {
+		return result + msg.Args, nil
+	}
+
 	if msg.Type == MessageTypeEmpty || msg.Type == MessageTypePing ||
-		msg.Type == MessageTypePong {
+		msg.Type == MessageTypePong || msg.Type == MessageTypeDisconnect {
 		return result, nil
 	}
 
@@ -95,8 +134,52 @@ func Encode(msg *Message) (string, error) {
 	return result + "[" + string(jsonMethod) + "," + msg.Args + "]", nil
 }
 
+/**
+Checks that message type is a socket.io packet, which may be sent to a namespace
+*/
+func isSocketPacket(msgType int) bool {
+	switch msgType {
+	case MessageTypeEmpty, MessageTypeEmit, MessageTypeAckRequest,
+		MessageTypeAckResponse, MessageTypeDisconnect, MessageTypeError:
+		return true
+	}
+	return false
+}
+
+func isDefaultNamespace(namespace string) bool {
+	return namespace == "" || namespace == "/"
+}
+
+/**
+Get namespace of socket.io packet, if present, and the packet without it.
+Query parameters sent by Engine.IO v3 clients along with the namespace are dropped.
+*/
+func getNamespace(data string) (namespace, restData string) {
+	if len(data) < 3 || data[2] != '/' {
+		return "", data
+	}
+
+	end := strings.IndexByte(data, ',')
+	if end == -1 {
+		end = len(data)
+		restData = data[0:2]
+	} else {
+		restData = data[0:2] + data[end+1:]
+	}
+
+	namespace = data[2:end]
+	if pos := strings.IndexByte(namespace, '?'); pos != -1 {
+		namespace = namespace[0:pos]
+	}
+	return namespace, restData
+}
+
 func MustEncode(msg *Message) string {
-	result, err := Encode(msg)
+	return CodecV3.MustEncode(msg)
+}
+
+func (c *Codec) MustEncode(msg *Message) string {
+	result, err := c.Encode(msg)
 	if err != nil {
 		panic(err)
 	}
@@ -124,15 +207,36 @@ func getMessageType(data string) (int, error) {
 		switch data[0:2] {
 		case emptyMessage:
 			return MessageTypeEmpty, nil
-		case commonMessage:
+		case disconnectMessage:
+			return MessageTypeDisconnect, nil
+		case commonMessage, binaryEventMessage:
 			return MessageTypeAckRequest, nil
-		case ackMessage:
+		case ackMessage, binaryAckMessage:
 			return MessageTypeAckResponse, nil
+		case errorMessage:
+			return MessageTypeError, nil
 		}
 	}
 	return 0, ErrorWrongMessageType
 }
 
+/**
+Get amount of attachments of binary packet, and the packet without it
+*/
+func getAttachments(data string) (amount int, restData string, err error) {
+	pos := strings.IndexByte(data, '-')
+	if pos < 3 {
+		return 0, "", ErrorWrongPacket
+	}
+
+	amount, err = strconv.Atoi(data[2:pos])
+	if err != nil || amount < 0 {
+		return 0, "", ErrorWrongPacket
+	}
+
+	return amount, data[0:2] + data[pos+1:], nil
+}
+
 /**
 Get ack id of current packet, if present
 */
@@ -190,7 +294,17 @@ func getMethod(text string) (method, restText string, err error) {
 	return text[start:end], text[rest : len(text)-1], nil
 }
 
+/**
+Decode packet text using the Engine.IO v3 codec
+*/
 func Decode(data string) (*Message, error) {
+	return CodecV3.Decode(data)
+}
+
+/**
+Decode packet text to message
+*/
+func (c *Codec) Decode(data string) (*Message, error) {
 	var err error
 	msg := &Message{}
 	msg.Source = data
@@ -200,13 +314,34 @@ func Decode(data string) (*Message, error) {
 		return nil, err
 	}
 
+	if strings.HasPrefix(data, binaryEventMessage) || strings.HasPrefix(data, binaryAckMessage) {
+		amount, rest, err := getAttachments(data)
+		if err != nil {
+			return nil, err
+		}
+		//filled in from the binary messages following the packet
+		msg.Attachments = make([][]byte, amount)
+		data = rest
+	}
+
+	if isSocketPacket(msg.Type) {
+		msg.Namespace, data = getNamespace(data)
+	}
+
 	if msg.Type == MessageTypeOpen {
 		msg.Args = data[1:]
 		return msg, nil
 	}
 
+	if msg.Type == MessageTypeEmpty && c.ClientConnects() ||
+		msg.Type == MessageTypeError {
+		msg.Args = data[2:]
+		return msg, nil
+	}
+
 	if msg.Type == MessageTypeClose || msg.Type == MessageTypePing ||
-		msg.Type == MessageTypePong || msg.Type == MessageTypeEmpty {
+		msg.Type == MessageTypePong || msg.Type == MessageTypeEmpty ||
+		msg.Type == MessageTypeDisconnect {
 		return msg, nil
 	}
 
@@ -0,0 +1,191 @@
+package protocol
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Codec   *Codec
+		Message Message
+		Packet  string
+	}{
+		{"v3 connect", CodecV3, Message{Type: MessageTypeEmpty}, "40"},
+		{"v4 connect with auth", CodecV4, Message{Type: MessageTypeEmpty, Args: `{"token":"abc"}`}, `40{"token":"abc"}`},
+		{"v4 connect without auth", CodecV4, Message{Type: MessageTypeEmpty}, "40"},
+		{"disconnect", CodecV4, Message{Type: MessageTypeDisconnect}, "41"},
+		{"connect error", CodecV4, Message{Type: MessageTypeError, Args: `{"message":"not authorized"}`}, `44{"message":"not authorized"}`},
+		{"emit", CodecV4, Message{Type: MessageTypeEmit, Method: "send", Args: `{"a":1}`}, `42["send",{"a":1}]`},
+		{"ack request", CodecV3, Message{Type: MessageTypeAckRequest, AckId: 12, Method: "send", Args: `"hi"`}, `4212["send","hi"]`},
+		{"ack response", CodecV4, Message{Type: MessageTypeAckResponse, AckId: 12, Args: `"OK"`}, `4312["OK"]`},
+		{"ping", CodecV4, Message{Type: MessageTypePing}, "2"},
+		{"v3 connect to namespace", CodecV3, Message{Type: MessageTypeEmpty, Namespace: "/admin"}, "40/admin,"},
+		{"v4 connect to namespace", CodecV4, Message{Type: MessageTypeEmpty, Namespace: "/admin", Args: `{"token":"abc"}`}, `40/admin,{"token":"abc"}`},
+		{"disconnect from namespace", CodecV4, Message{Type: MessageTypeDisconnect, Namespace: "/admin"}, "41/admin,"},
+		{"emit to namespace", CodecV3, Message{Type: MessageTypeEmit, Namespace: "/admin", Method: "send", Args: `[1,2]`}, `42/admin,["send",[1,2]]`},
+		{"ack response in namespace", CodecV4, Message{Type: MessageTypeAckResponse, Namespace: "/admin", AckId: 3, Args: `"OK"`}, `43/admin,3["OK"]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			packet, err := test.Codec.Encode(&test.Message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if packet != test.Packet {
+				t.Errorf("unexpected packet: expected %s, got %s", test.Packet, packet)
+			}
+
+			msg, err := test.Codec.Decode(packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg.Source = ""
+			if !reflect.DeepEqual(*msg, test.Message) {
+				t.Errorf("unexpected message: expected %+v, got %+v", test.Message, *msg)
+			}
+		})
+	}
+}
+
+func TestDecodeNamespace(t *testing.T) {
+	for packet, expected := range map[string]string{
+		"40/admin":                "/admin",
+		"40/admin?token=abc,":     "/admin",
+		`42/admin?a=1,["send",1]`: "/admin",
+		"40/,":                    "/",
+		`42["send","/admin,"]`:    "",
+	} {
+		msg, err := CodecV3.Decode(packet)
+		if err != nil {
+			t.Errorf("%s: %v", packet, err)
+			continue
+		}
+		if msg.Namespace != expected {
+			t.Errorf("%s: expected namespace %q, got %q", packet, expected, msg.Namespace)
+		}
+	}
+}
+
+func TestBinaryPackets(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Message Message
+		Packet  string
+	}{
+		{"binary event", Message{Type: MessageTypeEmit, Method: "upload", Args: `{"_placeholder":true,"num":0}`}, `451-["upload",{"_placeholder":true,"num":0}]`},
+		{"binary ack request", Message{Type: MessageTypeAckRequest, Namespace: "/files", AckId: 7, Method: "upload", Args: `{"a":{"_placeholder":true,"num":0},"b":{"_placeholder":true,"num":1}}`}, `452-/files,7["upload",{"a":{"_placeholder":true,"num":0},"b":{"_placeholder":true,"num":1}}]`},
+		{"binary ack response", Message{Type: MessageTypeAckResponse, AckId: 7, Args: `{"_placeholder":true,"num":0}`}, `461-7[{"_placeholder":true,"num":0}]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			attachments := make([][]byte, strings.Count(test.Message.Args, "_placeholder"))
+			for i := range attachments {
+				attachments[i] = []byte{byte(i), 0xff}
+			}
+			test.Message.Attachments = attachments
+
+			packet, err := CodecV4.Encode(&test.Message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if packet != test.Packet {
+				t.Errorf("unexpected packet: expected %s, got %s", test.Packet, packet)
+			}
+
+			msg, err := CodecV4.Decode(packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msg.Attachments) != len(attachments) {
+				t.Fatalf("expected %d attachments, got %d", len(attachments), len(msg.Attachments))
+			}
+			msg.Source = ""
+			msg.Attachments = attachments
+			if !reflect.DeepEqual(*msg, test.Message) {
+				t.Errorf("unexpected message: expected %+v, got %+v", test.Message, *msg)
+			}
+
+			args, err := ReplacePlaceholders(msg.Args, attachments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(args, "_placeholder") || !strings.Contains(args, `"AP8="`) {
+				t.Errorf("placeholders were not replaced: %s", args)
+			}
+		})
+	}
+}
+
+func TestReplacePlaceholders(t *testing.T) {
+	attachments := [][]byte{[]byte("hello")}
+	for args, expected := range map[string]string{
+		`{"_placeholder":true,"num":0}`:              `"aGVsbG8="`,
+		`"text",[{"_placeholder":true,"num":0}],1.5`: `"text",["aGVsbG8="],1.5`,
+		`{"_placeholder":false,"num":0}`:             `{"_placeholder":false,"num":0}`,
+		`{"_placeholder":true,"num":1}`:              "",
+	} {
+		act, err := ReplacePlaceholders(args, attachments)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", args, act)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", args, err)
+			continue
+		}
+		if act != expected {
+			t.Errorf("%s: expected %s, got %s", args, expected, act)
+		}
+	}
+}
+
+func TestDecodeArgs(t *testing.T) {
+	values, err := DecodeArgs(`"text",{"data":[{"_placeholder":true,"num":0}],"n":1}`, [][]byte{[]byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"text", map[string]interface{}{"data": []interface{}{[]byte("hello")}, "n": json.Number("1")}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("unexpected values: expected %#v, got %#v", expected, values)
+	}
+}
+
+func TestCodecByQuery(t *testing.T) {
+	for eio, expected := range map[string]*Codec{"": CodecV3, "3": CodecV3, "4": CodecV4, "2": nil, "x": nil} {
+		codec, err := CodecByQuery(eio)
+		if codec != expected {
+			t.Errorf("EIO=%s: expected %v, got %v", eio, expected, codec)
+		}
+		if expected == nil && err != ErrorUnsupportedVersion {
+			t.Errorf("EIO=%s: expected ErrorUnsupportedVersion, got %v", eio, err)
+		}
+	}
+}
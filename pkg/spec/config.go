@@ -0,0 +1,97 @@
+package spec
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Dir is the directory within a repository that holds the Bhojpur Network configuration
+	Dir = "net"
+
+	// ConfigPath is the path of the configuration file within a repository
+	ConfigPath = Dir + "/config.yaml"
+)
+
+// Config is the content of net/config.yaml
+type Config struct {
+	// DefaultEngine is the engine YAML that's run unless a specific engine is requested.
+	// See Config.EnginePath for how it's resolved.
+	DefaultEngine string `yaml:"defaultEngine"`
+}
+
+// ParseConfig parses the content of a net/config.yaml
+func ParseConfig(content []byte) (*Config, error) {
+	var cfg Config
+	err := yaml.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", ConfigPath, err)
+	}
+	return &cfg, nil
+}
+
+// LoadConfig reads the net/config.yaml from a repository checkout. It returns the raw
+// content alongside the parsed config, so that it can be passed on verbatim.
+func LoadConfig(repoDir string) (cfg *Config, content []byte, err error) {
+	content, err = os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(ConfigPath)))
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err = ParseConfig(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, content, nil
+}
+
+// EnginePath resolves the engine YAML that should be run to a slash-separated path relative to
+// the repository root. An empty name selects the default engine. Plain names like "build" refer
+// to net/build.yaml, everything else is taken as path relative to the repository root.
+func (c *Config) EnginePath(name string) (string, error) {
+	if name == "" {
+		name = c.DefaultEngine
+	}
+	if name == "" {
+		return "", fmt.Errorf("no engine given and %s has no defaultEngine", ConfigPath)
+	}
+
+	name = filepath.ToSlash(name)
+	if !strings.Contains(name, "/") && filepath.Ext(name) == "" {
+		name = Dir + "/" + name + ".yaml"
+	}
+	name = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(name)), "./")
+	if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("engine %s lies outside of the repository", name)
+	}
+	return name, nil
+}
+
+// EngineName derives the name of an engine spec from its path, e.g. net/build.yaml becomes build
+func EngineName(path string) string {
+	base := filepath.Base(filepath.FromSlash(path))
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
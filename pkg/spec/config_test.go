@@ -0,0 +1,58 @@
+package spec
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import "testing"
+
+func TestEnginePath(t *testing.T) {
+	cfg := &Config{DefaultEngine: "build"}
+	tests := []struct {
+		Name     string
+		Expected string
+		Invalid  bool
+	}{
+		{Name: "", Expected: "net/build.yaml"},
+		{Name: "deploy", Expected: "net/deploy.yaml"},
+		{Name: "net/nightly.yml", Expected: "net/nightly.yml"},
+		{Name: "./ci/engine.yaml", Expected: "ci/engine.yaml"},
+		{Name: "../outside.yaml", Invalid: true},
+	}
+	for _, test := range tests {
+		act, err := cfg.EnginePath(test.Name)
+		if test.Invalid {
+			if err == nil {
+				t.Errorf("EnginePath(%q) should fail", test.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("EnginePath(%q): %v", test.Name, err)
+		}
+		if act != test.Expected {
+			t.Errorf("EnginePath(%q) = %q, expected %q", test.Name, act, test.Expected)
+		}
+	}
+
+	_, err := (&Config{}).EnginePath("")
+	if err == nil {
+		t.Error("EnginePath without default engine should fail")
+	}
+}
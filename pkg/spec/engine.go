@@ -0,0 +1,68 @@
+package spec
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Engine is the part of an engine YAML that describes the engine to its users and
+// tells executors what to run. All other content of the engine YAML is ignored.
+type Engine struct {
+	// Description tells users what the engine does
+	Description string `yaml:"desc"`
+
+	// Args are the annotations the engine expects when it is started
+	Args []Arg `yaml:"args"`
+
+	// Run is the shell script the process executor runs
+	Run string `yaml:"run"`
+}
+
+// Arg describes an annotation an engine expects
+type Arg struct {
+	Name        string `yaml:"name"`
+	Required    bool   `yaml:"req"`
+	Description string `yaml:"desc"`
+}
+
+// ParseEngine parses the description and arguments of an engine YAML
+func ParseEngine(content []byte) (*Engine, error) {
+	var eng Engine
+	err := yaml.Unmarshal(content, &eng)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse engine: %w", err)
+	}
+
+	seen := make(map[string]struct{}, len(eng.Args))
+	for i, arg := range eng.Args {
+		if arg.Name == "" {
+			return nil, fmt.Errorf("argument %d has no name", i)
+		}
+		if _, exists := seen[arg.Name]; exists {
+			return nil, fmt.Errorf("argument %s is declared more than once", arg.Name)
+		}
+		seen[arg.Name] = struct{}{}
+	}
+	return &eng, nil
+}
@@ -0,0 +1,60 @@
+package spec
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import "testing"
+
+func TestParseEngine(t *testing.T) {
+	eng, err := ParseEngine([]byte(`
+desc: Builds the application
+pod:
+  containers: []
+args:
+- name: version
+  req: true
+  desc: version to build
+- name: debug
+run: make build
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eng.Description != "Builds the application" || len(eng.Args) != 2 || eng.Run != "make build" {
+		t.Fatalf("unexpected engine: %+v", eng)
+	}
+	if arg := eng.Args[0]; arg.Name != "version" || !arg.Required || arg.Description != "version to build" {
+		t.Errorf("unexpected argument: %+v", arg)
+	}
+	if eng.Args[1].Required {
+		t.Error("arguments should be optional by default")
+	}
+
+	for _, content := range []string{
+		"args:\n- desc: no name\n",
+		"args:\n- name: a\n- name: a\n",
+		"args: nope\n",
+	} {
+		_, err = ParseEngine([]byte(content))
+		if err == nil {
+			t.Errorf("ParseEngine(%q) should fail", content)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package store
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"sync"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/filterexpr"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewInMemoryEngineStore creates a new in-memory engine store
+func NewInMemoryEngineStore() *InMemoryEngineStore {
+	return &InMemoryEngineStore{
+		engines: make(map[string]*v1.EngineStatus),
+		groups:  make(map[string]int),
+	}
+}
+
+// InMemoryEngineStore implements an engine store in memory. It does not survive a restart.
+type InMemoryEngineStore struct {
+	engines map[string]*v1.EngineStatus
+	groups  map[string]int
+	mu      sync.RWMutex
+}
+
+// Store stores engine information in the store.
+func (s *InMemoryEngineStore) Store(ctx context.Context, status *v1.EngineStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.engines[status.Name] = proto.Clone(status).(*v1.EngineStatus)
+	return nil
+}
+
+// Get retrieves a particular engine by its name.
+func (s *InMemoryEngineStore) Get(ctx context.Context, name string) (*v1.EngineStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res, ok := s.engines[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(res).(*v1.EngineStatus), nil
+}
+
+// Find searches for engines based on their annotations
+func (s *InMemoryEngineStore) Find(ctx context.Context, filter []*v1.FilterExpression, order []*v1.OrderExpression, start, limit int) (slice []*v1.EngineStatus, total int, err error) {
+	err = filterexpr.Validate(filter, order)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.RLock()
+	res := make([]*v1.EngineStatus, 0, len(s.engines))
+	for _, e := range s.engines {
+		if !filterexpr.MatchesFilter(e, filter) {
+			continue
+		}
+		res = append(res, proto.Clone(e).(*v1.EngineStatus))
+	}
+	s.mu.RUnlock()
+
+	err = filterexpr.Sort(res, order)
+	if err != nil {
+		return nil, 0, err
+	}
+	return paginate(res, start, limit), len(res), nil
+}
+
+// NextNumber returns the next number in a sequence group
+func (s *InMemoryEngineStore) NextNumber(ctx context.Context, group string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups[group]++
+	return s.groups[group], nil
+}
+
+// paginate returns the slice of engines between start and start+limit. A limit of zero or less means no limit.
+func paginate(res []*v1.EngineStatus, start, limit int) []*v1.EngineStatus {
+	if start < 0 {
+		start = 0
+	}
+	if start >= len(res) {
+		return []*v1.EngineStatus{}
+	}
+	res = res[start:]
+	if limit > 0 && limit < len(res) {
+		res = res[:limit]
+	}
+	return res
+}
+
+// NewInMemoryLogStore creates a new in-memory log store
+func NewInMemoryLogStore() *InMemoryLogStore {
+	return &InMemoryLogStore{
+		logs: make(map[string][]*v1.LogSliceEvent),
+	}
+}
+
+// InMemoryLogStore implements a log store in memory. It does not survive a restart.
+type InMemoryLogStore struct {
+	logs map[string][]*v1.LogSliceEvent
+	mu   sync.RWMutex
+}
+
+// Append adds an event to the log of an engine
+func (s *InMemoryLogStore) Append(ctx context.Context, name string, evt *v1.LogSliceEvent) (seq int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq = len(s.logs[name])
+	s.logs[name] = append(s.logs[name], proto.Clone(evt).(*v1.LogSliceEvent))
+	return seq, nil
+}
+
+// Read returns the log events of an engine starting at the given sequence number
+func (s *InMemoryLogStore) Read(ctx context.Context, name string, from int) ([]*v1.LogSliceEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	log := s.logs[name]
+	if from < 0 {
+		from = 0
+	}
+	if from >= len(log) {
+		return nil, nil
+	}
+
+	res := make([]*v1.LogSliceEvent, 0, len(log)-from)
+	for _, evt := range log[from:] {
+		res = append(res, proto.Clone(evt).(*v1.LogSliceEvent))
+	}
+	return res, nil
+}
+
+// NewInMemorySpecStore creates a new in-memory start specification store
+func NewInMemorySpecStore() *InMemorySpecStore {
+	return &InMemorySpecStore{
+		specs: make(map[string][]byte),
+	}
+}
+
+// InMemorySpecStore implements a start specification store in memory. It does not survive a restart.
+type InMemorySpecStore struct {
+	specs map[string][]byte
+	mu    sync.RWMutex
+}
+
+// Put stores the start specification of an engine
+func (s *InMemorySpecStore) Put(ctx context.Context, name string, spec []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.specs[name] = append([]byte(nil), spec...)
+	return nil
+}
+
+// Get retrieves the start specification of an engine
+func (s *InMemorySpecStore) Get(ctx context.Context, name string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	spec, ok := s.specs[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), spec...), nil
+}
+
+// Delete removes the start specification of an engine
+func (s *InMemorySpecStore) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.specs, name)
+	return nil
+}
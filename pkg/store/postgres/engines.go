@@ -0,0 +1,344 @@
+package postgres
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/filterexpr"
+	"github.com/bhojpur/net/pkg/store"
+	"github.com/lib/pq"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EngineStore provides PostgreSQL backed engine store
+type EngineStore struct {
+	DB *sql.DB
+}
+
+var _ store.Engines = &EngineStore{}
+
+// NewEngineStore creates a new PostgreSQL backed engine store.
+// Callers are expected to Migrate the database before using the store.
+func NewEngineStore(db *sql.DB) *EngineStore {
+	return &EngineStore{DB: db}
+}
+
+// schema describes the engine_status table for the filter expression translation
+var schema = filterexpr.SQLSchema{
+	Columns: map[string]string{
+		"name":                         "engine_status.name",
+		"phase":                        "engine_status.phase",
+		"details":                      "engine_status.details",
+		"metadata.owner":               "engine_status.owner",
+		"metadata.repository.host":     "engine_status.repo_host",
+		"metadata.repository.owner":    "engine_status.repo_owner",
+		"metadata.repository.repo":     "engine_status.repo_repo",
+		"metadata.repository.ref":      "engine_status.repo_ref",
+		"metadata.repository.revision": "engine_status.repo_revision",
+		"metadata.trigger":             "engine_status.trigger",
+		"metadata.engine_spec_name":    "engine_status.spec_name",
+		"metadata.created":             "engine_status.created",
+		"metadata.finished":            "engine_status.finished",
+		"conditions.success":           "engine_status.success",
+		"conditions.failure_count":     "engine_status.failure_count",
+		"conditions.can_replay":        "engine_status.can_replay",
+		"conditions.wait_until":        "engine_status.wait_until",
+		"conditions.did_execute":       "engine_status.did_execute",
+	},
+	NameColumn:             "engine_status.name",
+	AnnotationTable:        "engine_annotation",
+	AnnotationEngineColumn: "engine_annotation.engine_name",
+	AnnotationKeyColumn:    "engine_annotation.key",
+	AnnotationValueColumn:  "engine_annotation.value",
+}
+
+const engineColumns = `name, owner, repo_host, repo_owner, repo_repo, repo_ref, repo_revision, trigger, spec_name,
+	created, finished, phase, details, success, failure_count, can_replay, wait_until, did_execute`
+
+// Store stores engine information in the store
+func (s *EngineStore) Store(ctx context.Context, status *v1.EngineStatus) (err error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var (
+		md    = status.GetMetadata()
+		repo  = md.GetRepository()
+		conds = status.GetConditions()
+	)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO engine_status (`+engineColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		ON CONFLICT (name) DO UPDATE SET
+			owner = EXCLUDED.owner,
+			repo_host = EXCLUDED.repo_host,
+			repo_owner = EXCLUDED.repo_owner,
+			repo_repo = EXCLUDED.repo_repo,
+			repo_ref = EXCLUDED.repo_ref,
+			repo_revision = EXCLUDED.repo_revision,
+			trigger = EXCLUDED.trigger,
+			spec_name = EXCLUDED.spec_name,
+			created = EXCLUDED.created,
+			finished = EXCLUDED.finished,
+			phase = EXCLUDED.phase,
+			details = EXCLUDED.details,
+			success = EXCLUDED.success,
+			failure_count = EXCLUDED.failure_count,
+			can_replay = EXCLUDED.can_replay,
+			wait_until = EXCLUDED.wait_until,
+			did_execute = EXCLUDED.did_execute`,
+		status.Name,
+		md.GetOwner(),
+		repo.GetHost(),
+		repo.GetOwner(),
+		repo.GetRepo(),
+		repo.GetRef(),
+		repo.GetRevision(),
+		md.GetTrigger().String(),
+		md.GetEngineSpecName(),
+		toTime(md.GetCreated()),
+		toTime(md.GetFinished()),
+		status.Phase.String(),
+		status.Details,
+		conds.GetSuccess(),
+		conds.GetFailureCount(),
+		conds.GetCanReplay(),
+		toTime(conds.GetWaitUntil()),
+		conds.GetDidExecute(),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM engine_annotation WHERE engine_name = $1", status.Name)
+	if err != nil {
+		return err
+	}
+	for i, a := range md.GetAnnotations() {
+		_, err = tx.ExecContext(ctx, "INSERT INTO engine_annotation (engine_name, position, key, value) VALUES ($1, $2, $3, $4)",
+			status.Name, i, a.Key, a.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM engine_result WHERE engine_name = $1", status.Name)
+	if err != nil {
+		return err
+	}
+	for i, r := range status.Results {
+		channels := r.Channels
+		if channels == nil {
+			channels = []string{}
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO engine_result (engine_name, position, type, payload, description, channels) VALUES ($1, $2, $3, $4, $5, $6)",
+			status.Name, i, r.Type, r.Payload, r.Description, pq.Array(channels))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Get retrieves a particular engine by its name
+func (s *EngineStore) Get(ctx context.Context, name string) (*v1.EngineStatus, error) {
+	res, err := s.query(ctx, "SELECT "+engineColumns+" FROM engine_status WHERE name = $1", name)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return res[0], nil
+}
+
+// Find searches for engines based on their annotations
+func (s *EngineStore) Find(ctx context.Context, filter []*v1.FilterExpression, order []*v1.OrderExpression, start, limit int) (slice []*v1.EngineStatus, total int, err error) {
+	where, args, err := schema.Where(filter, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	orderBy, err := schema.OrderBy(order)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = s.DB.QueryRowContext(ctx, "SELECT COUNT(1) FROM engine_status WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM engine_status WHERE %s ORDER BY %s OFFSET $%d", engineColumns, where, orderBy, len(args)+1)
+	args = append(args, start)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, limit)
+	}
+	slice, err = s.query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return slice, total, nil
+}
+
+// NextNumber returns the next number in a sequence group
+func (s *EngineStore) NextNumber(ctx context.Context, group string) (nr int, err error) {
+	err = s.DB.QueryRowContext(ctx, `
+		INSERT INTO number_group (name, val) VALUES ($1, 1)
+		ON CONFLICT (name) DO UPDATE SET val = number_group.val + 1
+		RETURNING val`, group).Scan(&nr)
+	return
+}
+
+// query runs a query selecting engineColumns and loads the annotations and results of all engines it returned
+func (s *EngineStore) query(ctx context.Context, query string, args ...interface{}) ([]*v1.EngineStatus, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		res   []*v1.EngineStatus
+		idx   = make(map[string]*v1.EngineStatus)
+		names []string
+	)
+	for rows.Next() {
+		var (
+			st                           = &v1.EngineStatus{Metadata: &v1.EngineMetadata{Repository: &v1.Repository{}}, Conditions: &v1.EngineConditions{}}
+			md                           = st.Metadata
+			trigger, phase               string
+			created, finished, waitUntil sql.NullTime
+		)
+		err = rows.Scan(
+			&st.Name,
+			&md.Owner,
+			&md.Repository.Host,
+			&md.Repository.Owner,
+			&md.Repository.Repo,
+			&md.Repository.Ref,
+			&md.Repository.Revision,
+			&trigger,
+			&md.EngineSpecName,
+			&created,
+			&finished,
+			&phase,
+			&st.Details,
+			&st.Conditions.Success,
+			&st.Conditions.FailureCount,
+			&st.Conditions.CanReplay,
+			&waitUntil,
+			&st.Conditions.DidExecute,
+		)
+		if err != nil {
+			return nil, err
+		}
+		md.Trigger = v1.EngineTrigger(v1.EngineTrigger_value[trigger])
+		md.Created = fromTime(created)
+		md.Finished = fromTime(finished)
+		st.Phase = v1.EnginePhase(v1.EnginePhase_value[phase])
+		st.Conditions.WaitUntil = fromTime(waitUntil)
+		if proto.Equal(md.Repository, &v1.Repository{}) {
+			md.Repository = nil
+		}
+
+		res = append(res, st)
+		idx[st.Name] = st
+		names = append(names, st.Name)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return res, nil
+	}
+
+	annotations, err := s.DB.QueryContext(ctx, "SELECT engine_name, key, value FROM engine_annotation WHERE engine_name = ANY($1) ORDER BY engine_name, position", pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer annotations.Close()
+	for annotations.Next() {
+		var (
+			name string
+			a    = &v1.Annotation{}
+		)
+		err = annotations.Scan(&name, &a.Key, &a.Value)
+		if err != nil {
+			return nil, err
+		}
+		md := idx[name].Metadata
+		md.Annotations = append(md.Annotations, a)
+	}
+	if err = annotations.Err(); err != nil {
+		return nil, err
+	}
+
+	results, err := s.DB.QueryContext(ctx, "SELECT engine_name, type, payload, description, channels FROM engine_result WHERE engine_name = ANY($1) ORDER BY engine_name, position", pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	for results.Next() {
+		var (
+			name string
+			r    = &v1.EngineResult{}
+		)
+		err = results.Scan(&name, &r.Type, &r.Payload, &r.Description, pq.Array(&r.Channels))
+		if err != nil {
+			return nil, err
+		}
+		st := idx[name]
+		st.Results = append(st.Results, r)
+	}
+	if err = results.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func toTime(ts *timestamppb.Timestamp) sql.NullTime {
+	if ts == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: ts.AsTime(), Valid: true}
+}
+
+func fromTime(t sql.NullTime) *timestamppb.Timestamp {
+	if !t.Valid {
+		return nil
+	}
+	return timestamppb.New(t.Time.In(time.UTC))
+}
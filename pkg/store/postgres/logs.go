@@ -0,0 +1,96 @@
+package postgres
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"database/sql"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/store"
+)
+
+// LogStore provides PostgreSQL backed log store
+type LogStore struct {
+	DB *sql.DB
+}
+
+var _ store.Logs = &LogStore{}
+
+// NewLogStore creates a new PostgreSQL backed log store.
+// Callers are expected to Migrate the database before using the store.
+func NewLogStore(db *sql.DB) *LogStore {
+	return &LogStore{DB: db}
+}
+
+// Append adds an event to the log of an engine. Appends to the same engine are serialized
+// by an advisory lock, so that concurrent appends don't pick the same sequence number.
+func (s *LogStore) Append(ctx context.Context, name string, evt *v1.LogSliceEvent) (seq int, err error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", name)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO log_slice_event (engine_name, seq, name, type, payload)
+		SELECT $1, COALESCE(MAX(seq) + 1, 0), $2, $3, $4 FROM log_slice_event WHERE engine_name = $1
+		RETURNING seq`,
+		name, evt.Name, evt.Type.String(), evt.Payload,
+	).Scan(&seq)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	return seq, err
+}
+
+// Read returns the log events of an engine starting at the given sequence number
+func (s *LogStore) Read(ctx context.Context, name string, from int) ([]*v1.LogSliceEvent, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT name, type, payload FROM log_slice_event WHERE engine_name = $1 AND seq >= $2 ORDER BY seq", name, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*v1.LogSliceEvent
+	for rows.Next() {
+		var (
+			evt = &v1.LogSliceEvent{}
+			tpe string
+		)
+		err = rows.Scan(&evt.Name, &tpe, &evt.Payload)
+		if err != nil {
+			return nil, err
+		}
+		evt.Type = v1.LogSliceType(v1.LogSliceType_value[tpe])
+		res = append(res, evt)
+	}
+	return res, rows.Err()
+}
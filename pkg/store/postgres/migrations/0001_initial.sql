@@ -0,0 +1,55 @@
+CREATE TABLE engine_status (
+    name              varchar(255) NOT NULL PRIMARY KEY,
+    owner             varchar(255) NOT NULL DEFAULT '',
+    repo_host         varchar(255) NOT NULL DEFAULT '',
+    repo_owner        varchar(255) NOT NULL DEFAULT '',
+    repo_repo         varchar(255) NOT NULL DEFAULT '',
+    repo_ref          varchar(255) NOT NULL DEFAULT '',
+    repo_revision     varchar(255) NOT NULL DEFAULT '',
+    trigger           varchar(32) NOT NULL DEFAULT '',
+    spec_name         varchar(255) NOT NULL DEFAULT '',
+    created           timestamp with time zone,
+    finished          timestamp with time zone,
+    phase             varchar(32) NOT NULL DEFAULT '',
+    details           text NOT NULL DEFAULT '',
+    success           boolean NOT NULL DEFAULT false,
+    failure_count     integer NOT NULL DEFAULT 0,
+    can_replay        boolean NOT NULL DEFAULT false,
+    wait_until        timestamp with time zone,
+    did_execute       boolean NOT NULL DEFAULT false
+);
+CREATE INDEX engine_status_created ON engine_status (created);
+CREATE INDEX engine_status_phase ON engine_status (phase);
+
+CREATE TABLE engine_annotation (
+    engine_name       varchar(255) NOT NULL REFERENCES engine_status (name) ON DELETE CASCADE,
+    position          integer NOT NULL,
+    key               varchar(255) NOT NULL,
+    value             text NOT NULL DEFAULT '',
+    PRIMARY KEY (engine_name, position)
+);
+CREATE INDEX engine_annotation_key ON engine_annotation (key, value);
+
+CREATE TABLE engine_result (
+    engine_name       varchar(255) NOT NULL REFERENCES engine_status (name) ON DELETE CASCADE,
+    position          integer NOT NULL,
+    type              varchar(255) NOT NULL DEFAULT '',
+    payload           text NOT NULL DEFAULT '',
+    description       text NOT NULL DEFAULT '',
+    channels          text[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (engine_name, position)
+);
+
+CREATE TABLE log_slice_event (
+    engine_name       varchar(255) NOT NULL,
+    seq               integer NOT NULL,
+    name              varchar(255) NOT NULL DEFAULT '',
+    type              varchar(32) NOT NULL DEFAULT '',
+    payload           text NOT NULL DEFAULT '',
+    PRIMARY KEY (engine_name, seq)
+);
+
+CREATE TABLE number_group (
+    name              varchar(255) NOT NULL PRIMARY KEY,
+    val               integer NOT NULL
+);
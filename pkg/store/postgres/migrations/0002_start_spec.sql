@@ -0,0 +1,4 @@
+CREATE TABLE engine_start_spec (
+    engine_name       varchar(255) NOT NULL PRIMARY KEY,
+    spec              bytea NOT NULL
+);
@@ -0,0 +1,116 @@
+package postgres
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/store"
+	"github.com/bhojpur/net/pkg/store/storetest"
+)
+
+// testDB connects to the database named in NET_TEST_POSTGRES_DSN and empties it.
+// Tests are skipped if no database is configured.
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("NET_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("NET_TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("cannot connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = Migrate(context.Background(), db)
+	if err != nil {
+		t.Fatalf("cannot migrate database: %v", err)
+	}
+	_, err = db.Exec("TRUNCATE engine_status, engine_annotation, engine_result, log_slice_event, number_group, engine_start_spec")
+	if err != nil {
+		t.Fatalf("cannot empty database: %v", err)
+	}
+	return db
+}
+
+func TestEngineStore(t *testing.T) {
+	storetest.TestEngines(t, func(t *testing.T) store.Engines { return NewEngineStore(testDB(t)) })
+}
+
+func TestLogStore(t *testing.T) {
+	storetest.TestLogs(t, func(t *testing.T) store.Logs { return NewLogStore(testDB(t)) })
+}
+
+func TestLogStoreConcurrentAppend(t *testing.T) {
+	logs := NewLogStore(testDB(t))
+	ctx := context.Background()
+
+	const n = 20
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := logs.Append(ctx, "net.1", &v1.LogSliceEvent{Name: "build", Type: v1.LogSliceType_SLICE_CONTENT, Payload: "line"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Append: %v", err)
+		}
+	}
+
+	evts, err := logs.Read(ctx, "net.1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evts) != n {
+		t.Errorf("expected %d events, got %d", n, len(evts))
+	}
+}
+
+func TestSpecStore(t *testing.T) {
+	storetest.TestSpecs(t, func(t *testing.T) store.Specs { return NewSpecStore(testDB(t)) })
+}
+
+func TestLoadMigrations(t *testing.T) {
+	ms, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	for i, m := range ms {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, expected %d", m.Name, m.Version, i+1)
+		}
+	}
+}
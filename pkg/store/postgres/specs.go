@@ -0,0 +1,71 @@
+package postgres
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/bhojpur/net/pkg/store"
+)
+
+// SpecStore provides PostgreSQL backed start specification store
+type SpecStore struct {
+	DB *sql.DB
+}
+
+var _ store.Specs = &SpecStore{}
+
+// NewSpecStore creates a new PostgreSQL backed start specification store.
+// Callers are expected to Migrate the database before using the store.
+func NewSpecStore(db *sql.DB) *SpecStore {
+	return &SpecStore{DB: db}
+}
+
+// Put stores the start specification of an engine
+func (s *SpecStore) Put(ctx context.Context, name string, spec []byte) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO engine_start_spec (engine_name, spec) VALUES ($1, $2)
+		ON CONFLICT (engine_name) DO UPDATE SET spec = EXCLUDED.spec`,
+		name, spec,
+	)
+	return err
+}
+
+// Get retrieves the start specification of an engine
+func (s *SpecStore) Get(ctx context.Context, name string) ([]byte, error) {
+	var spec []byte
+	err := s.DB.QueryRowContext(ctx, "SELECT spec FROM engine_start_spec WHERE engine_name = $1", name).Scan(&spec)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Delete removes the start specification of an engine
+func (s *SpecStore) Delete(ctx context.Context, name string) error {
+	_, err := s.DB.ExecContext(ctx, "DELETE FROM engine_start_spec WHERE engine_name = $1", name)
+	return err
+}
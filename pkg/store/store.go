@@ -0,0 +1,81 @@
+package store
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+)
+
+var (
+	// ErrNotFound is returned by Get if the engine does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrAlreadyExists is returned when attempting to store an engine that exists already
+	ErrAlreadyExists = errors.New("exists already")
+)
+
+// Engines stores the status of engines
+type Engines interface {
+	// Store stores engine information in the store.
+	// Storing an engine whose name already exists replaces the previous status.
+	Store(ctx context.Context, status *v1.EngineStatus) error
+
+	// Get retrieves a particular engine by its name.
+	// If the engine is not known, ErrNotFound is returned.
+	Get(ctx context.Context, name string) (*v1.EngineStatus, error)
+
+	// Find searches for engines matching the filter (see filterexpr.MatchesFilter). The result is the
+	// page of matching engines between start and start+limit in the requested order (see filterexpr.Sort),
+	// and the total number of matches. A limit of zero or less means no limit.
+	Find(ctx context.Context, filter []*v1.FilterExpression, order []*v1.OrderExpression, start, limit int) (slice []*v1.EngineStatus, total int, err error)
+
+	// NextNumber returns the next number in a sequence group. Sequences start at 1.
+	NextNumber(ctx context.Context, group string) (int, error)
+}
+
+// Logs stores the log slices produced by engines
+type Logs interface {
+	// Append adds an event to the log of an engine and returns its sequence number.
+	// Sequence numbers start at 0 and increase by one for each event of an engine.
+	Append(ctx context.Context, name string, evt *v1.LogSliceEvent) (seq int, err error)
+
+	// Read returns the log events of an engine starting at the given sequence number.
+	// Reading the log of an engine that has not produced any output yields no events.
+	Read(ctx context.Context, name string, from int) ([]*v1.LogSliceEvent, error)
+}
+
+// Specs stores the start specification of engines that have not started yet,
+// e.g. because they are waiting for their wait_until time.
+type Specs interface {
+	// Put stores the start specification of an engine, replacing any previous one.
+	Put(ctx context.Context, name string, spec []byte) error
+
+	// Get retrieves the start specification of an engine.
+	// If the engine has no specification stored, ErrNotFound is returned.
+	Get(ctx context.Context, name string) ([]byte, error)
+
+	// Delete removes the start specification of an engine.
+	// Deleting a specification that does not exist is not an error.
+	Delete(ctx context.Context, name string) error
+}
@@ -0,0 +1,299 @@
+package storetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/bhojpur/net/pkg/api/v1"
+	"github.com/bhojpur/net/pkg/store"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Engine produces a fully populated engine status for testing. Timestamps are truncated
+// to microseconds, which is the best precision all store implementations support.
+func Engine(name string, created time.Time) *v1.EngineStatus {
+	created = created.UTC().Truncate(time.Microsecond)
+	return &v1.EngineStatus{
+		Name: name,
+		Metadata: &v1.EngineMetadata{
+			Owner:      "tester",
+			Repository: &v1.Repository{Host: "github.com", Owner: "bhojpur", Repo: "net", Ref: "refs/heads/main", Revision: "cafebabe"},
+			Trigger:    v1.EngineTrigger_TRIGGER_PUSH,
+			Created:    timestamppb.New(created),
+			Finished:   timestamppb.New(created.Add(time.Minute)),
+			Annotations: []*v1.Annotation{
+				{Key: "version", Value: "1.0"},
+				{Key: "env", Value: "staging"},
+			},
+			EngineSpecName: "build",
+		},
+		Phase: v1.EnginePhase_PHASE_DONE,
+		Conditions: &v1.EngineConditions{
+			Success:      true,
+			FailureCount: 1,
+			CanReplay:    true,
+			DidExecute:   true,
+		},
+		Details: "all went well",
+		Results: []*v1.EngineResult{
+			{Type: "url", Payload: "https://bhojpur.net", Description: "the website", Channels: []string{"github"}},
+		},
+	}
+}
+
+// TestEngines runs the conformance tests for engine stores. The factory must return an empty store.
+func TestEngines(t *testing.T, factory func(t *testing.T) store.Engines) {
+	ctx := context.Background()
+
+	t.Run("store and get", func(t *testing.T) {
+		s := factory(t)
+		expected := Engine("net.1", time.Now())
+		err := s.Store(ctx, expected)
+		if err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+
+		act, err := s.Get(ctx, expected.Name)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if !proto.Equal(expected, act) {
+			t.Errorf("stored engine differs:\nexpected: %v\n  actual: %v", expected, act)
+		}
+	})
+
+	t.Run("store replaces", func(t *testing.T) {
+		s := factory(t)
+		st := Engine("net.1", time.Now())
+		err := s.Store(ctx, st)
+		if err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+
+		st = proto.Clone(st).(*v1.EngineStatus)
+		st.Phase = v1.EnginePhase_PHASE_RUNNING
+		st.Metadata.Annotations = st.Metadata.Annotations[:1]
+		st.Results = nil
+		err = s.Store(ctx, st)
+		if err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+
+		act, err := s.Get(ctx, st.Name)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if !proto.Equal(st, act) {
+			t.Errorf("stored engine was not replaced:\nexpected: %v\n  actual: %v", st, act)
+		}
+	})
+
+	t.Run("get unknown", func(t *testing.T) {
+		s := factory(t)
+		_, err := s.Get(ctx, "does-not-exist.1")
+		if !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("find paginates", func(t *testing.T) {
+		s := factory(t)
+		now := time.Now()
+		for i := 0; i < 5; i++ {
+			err := s.Store(ctx, Engine(fmt.Sprintf("net.%d", i), now.Add(time.Duration(i)*time.Second)))
+			if err != nil {
+				t.Fatalf("Store: %v", err)
+			}
+		}
+
+		res, total, err := s.Find(ctx, nil, nil, 1, 2)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if total != 5 {
+			t.Errorf("expected a total of 5, got %d", total)
+		}
+		var names []string
+		for _, r := range res {
+			names = append(names, r.Name)
+		}
+		if fmt.Sprint(names) != "[net.3 net.2]" {
+			t.Errorf("unexpected page, newest engines should come first: %v", names)
+		}
+	})
+
+	t.Run("find filters and orders", func(t *testing.T) {
+		s := factory(t)
+		now := time.Now()
+		for i := 0; i < 6; i++ {
+			st := Engine(fmt.Sprintf("net.%d", i), now)
+			if i%2 == 0 {
+				st.Phase = v1.EnginePhase_PHASE_RUNNING
+			}
+			if i%3 == 0 {
+				st.Metadata.Annotations = append(st.Metadata.Annotations, &v1.Annotation{Key: "release", Value: "100%_done"})
+			}
+			err := s.Store(ctx, st)
+			if err != nil {
+				t.Fatalf("Store: %v", err)
+			}
+		}
+
+		filter := []*v1.FilterExpression{
+			{Terms: []*v1.FilterTerm{
+				{Field: "phase", Value: "running"},
+				{Field: "annotation.release", Value: "%_", Operation: v1.FilterOp_OP_CONTAINS},
+			}},
+			{Terms: []*v1.FilterTerm{
+				{Field: "name", Value: "net.4", Negate: true},
+			}},
+		}
+		order := []*v1.OrderExpression{{Field: "name", Ascending: false}}
+		res, total, err := s.Find(ctx, filter, order, 0, 0)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if total != 3 {
+			t.Errorf("expected a total of 3, got %d", total)
+		}
+		var names []string
+		for _, r := range res {
+			names = append(names, r.Name)
+		}
+		if fmt.Sprint(names) != "[net.3 net.2 net.0]" {
+			t.Errorf("unexpected result: %v", names)
+		}
+	})
+
+	t.Run("next number", func(t *testing.T) {
+		s := factory(t)
+		for _, expected := range []int{1, 2, 3} {
+			nr, err := s.NextNumber(ctx, "net")
+			if err != nil {
+				t.Fatalf("NextNumber: %v", err)
+			}
+			if nr != expected {
+				t.Errorf("expected %d, got %d", expected, nr)
+			}
+		}
+		nr, err := s.NextNumber(ctx, "other")
+		if err != nil {
+			t.Fatalf("NextNumber: %v", err)
+		}
+		if nr != 1 {
+			t.Errorf("groups should count independently, got %d", nr)
+		}
+	})
+}
+
+// TestLogs runs the conformance tests for log stores. The factory must return an empty store.
+func TestLogs(t *testing.T, factory func(t *testing.T) store.Logs) {
+	ctx := context.Background()
+
+	t.Run("append and read", func(t *testing.T) {
+		s := factory(t)
+		evts := []*v1.LogSliceEvent{
+			{Name: "build", Type: v1.LogSliceType_SLICE_START},
+			{Name: "build", Type: v1.LogSliceType_SLICE_CONTENT, Payload: "hello world"},
+			{Name: "build", Type: v1.LogSliceType_SLICE_DONE},
+		}
+		for i, evt := range evts {
+			seq, err := s.Append(ctx, "net.1", evt)
+			if err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			if seq != i {
+				t.Errorf("expected sequence number %d, got %d", i, seq)
+			}
+		}
+		_, err := s.Append(ctx, "net.2", evts[0])
+		if err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+
+		act, err := s.Read(ctx, "net.1", 1)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		if len(act) != 2 || !proto.Equal(act[0], evts[1]) || !proto.Equal(act[1], evts[2]) {
+			t.Errorf("unexpected events: %v", act)
+		}
+	})
+
+	t.Run("read unknown", func(t *testing.T) {
+		s := factory(t)
+		act, err := s.Read(ctx, "does-not-exist.1", 0)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		if len(act) != 0 {
+			t.Errorf("expected no events, got %v", act)
+		}
+	})
+}
+
+// TestSpecs runs the conformance tests for start specification stores. The factory must return an empty store.
+func TestSpecs(t *testing.T, factory func(t *testing.T) store.Specs) {
+	ctx := context.Background()
+
+	t.Run("put get delete", func(t *testing.T) {
+		s := factory(t)
+		err := s.Put(ctx, "net.1", []byte("first"))
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		err = s.Put(ctx, "net.1", []byte("second"))
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+
+		act, err := s.Get(ctx, "net.1")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if string(act) != "second" {
+			t.Errorf("expected the last spec put, got %q", act)
+		}
+
+		err = s.Delete(ctx, "net.1")
+		if err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		_, err = s.Get(ctx, "net.1")
+		if !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("expected ErrNotFound after Delete, got %v", err)
+		}
+	})
+
+	t.Run("delete unknown", func(t *testing.T) {
+		s := factory(t)
+		err := s.Delete(ctx, "does-not-exist.1")
+		if err != nil {
+			t.Errorf("Delete: %v", err)
+		}
+	})
+}
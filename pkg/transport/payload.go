@@ -0,0 +1,209 @@
+package transport
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	/**
+	Separates the messages of an Engine.IO v4 polling payload
+	*/
+	recordSeparator = "\x1e"
+)
+
+var (
+	ErrorWrongPayload = errors.New("wrong payload")
+)
+
+/**
+Message of a polling payload
+*/
+type payloadMessage struct {
+	data   string
+	binary bool
+}
+
+/**
+Encode messages to polling payload. Since Engine.IO v4 messages are separated
+by a record separator, before they were prefixed by their length. Binary
+messages are base64 encoded in both.
+*/
+func encodePayload(version int, messages []payloadMessage) string {
+	var b strings.Builder
+	for i, msg := range messages {
+		text := msg.data
+		if msg.binary {
+			text = encodeBinaryMessage(version, msg.data)
+		}
+
+		if version >= 4 {
+			if i > 0 {
+				b.WriteString(recordSeparator)
+			}
+		} else {
+			b.WriteString(strconv.Itoa(utf16Len(text)))
+			b.WriteByte(':')
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+/**
+Decode polling payload to messages
+*/
+func decodePayload(version int, payload string) ([]payloadMessage, error) {
+	var texts []string
+	if version >= 4 {
+		texts = strings.Split(payload, recordSeparator)
+	} else {
+		for len(payload) > 0 {
+			pos := strings.IndexByte(payload, ':')
+			if pos < 1 {
+				return nil, ErrorWrongPayload
+			}
+			length, err := strconv.Atoi(payload[:pos])
+			if err != nil || length < 0 {
+				return nil, ErrorWrongPayload
+			}
+			payload = payload[pos+1:]
+
+			end, ok := utf16Offset(payload, length)
+			if !ok {
+				return nil, ErrorWrongPayload
+			}
+			texts = append(texts, payload[:end])
+			payload = payload[end:]
+		}
+	}
+
+	messages := make([]payloadMessage, 0, len(texts))
+	for _, text := range texts {
+		if len(text) == 0 {
+			return nil, ErrorWrongPayload
+		}
+		if text[0] != 'b' {
+			messages = append(messages, payloadMessage{data: text})
+			continue
+		}
+
+		data, err := decodeBinaryMessage(version, text)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, payloadMessage{data: data, binary: true})
+	}
+	return messages, nil
+}
+
+/**
+Decode binary payload, which Engine.IO v3 clients send if they support binary
+data. Every message is prefixed by a byte telling whether it's binary and
+by its length as digits, ended by 255.
+*/
+func decodeBinaryPayload(payload []byte) ([]payloadMessage, error) {
+	var messages []payloadMessage
+	for len(payload) > 0 {
+		binary := payload[0] == 1
+
+		length, i := 0, 1
+		for ; i < len(payload) && payload[i] != 255; i++ {
+			if payload[i] > 9 || i > 10 {
+				return nil, ErrorWrongPayload
+			}
+			length = length*10 + int(payload[i])
+		}
+		if i == 1 || i >= len(payload) || length > len(payload)-i-1 {
+			return nil, ErrorWrongPayload
+		}
+		payload = payload[i+1:]
+
+		messages = append(messages, payloadMessage{data: string(payload[:length]), binary: binary})
+		payload = payload[length:]
+	}
+	return messages, nil
+}
+
+/**
+Since v4 binary messages are plain data, before they started with the packet
+type byte, which is a digit in base64 encoding
+*/
+func encodeBinaryMessage(version int, data string) string {
+	if version >= 4 || len(data) == 0 {
+		return "b" + base64.StdEncoding.EncodeToString([]byte(data))
+	}
+	return "b" + strconv.Itoa(int(data[0])) + base64.StdEncoding.EncodeToString([]byte(data[1:]))
+}
+
+func decodeBinaryMessage(version int, text string) (string, error) {
+	prefix := ""
+	text = text[1:]
+	if version < 4 {
+		if len(text) == 0 || text[0] < '0' || text[0] > '9' {
+			return "", ErrorWrongPayload
+		}
+		prefix = string([]byte{text[0] - '0'})
+		text = text[1:]
+	}
+
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return "", ErrorWrongPayload
+	}
+	return prefix + string(data), nil
+}
+
+/**
+Length of text in UTF-16 code units, as Engine.IO v3 clients count it
+*/
+func utf16Len(text string) int {
+	n := 0
+	for _, r := range text {
+		n += utf16Units(r)
+	}
+	return n
+}
+
+/**
+Byte offset of the end of the first length UTF-16 code units of text
+*/
+func utf16Offset(text string, length int) (int, bool) {
+	n, pos := 0, 0
+	for pos < len(text) && n < length {
+		r, size := utf8.DecodeRuneInString(text[pos:])
+		n += utf16Units(r)
+		pos += size
+	}
+	return pos, n == length
+}
+
+func utf16Units(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
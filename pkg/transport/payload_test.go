@@ -0,0 +1,79 @@
+package transport
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPayload(t *testing.T) {
+	messages := []payloadMessage{
+		{data: "0{\"sid\":\"abc\"}"},
+		{data: `42["send","😀ä"]`},
+		{data: "\x04\x00\x01\xff", binary: true},
+	}
+	tests := []struct {
+		Version  int
+		Messages []payloadMessage
+		Payload  string
+	}{
+		{3, messages, "14:0{\"sid\":\"abc\"}" + `16:42["send","😀ä"]` + "6:b4AAH/"},
+		{4, messages, "0{\"sid\":\"abc\"}\x1e" + `42["send","😀ä"]` + "\x1ebBAAB/w=="},
+	}
+
+	for _, test := range tests {
+		payload := encodePayload(test.Version, test.Messages)
+		if payload != test.Payload {
+			t.Errorf("v%d: expected payload %q, got %q", test.Version, test.Payload, payload)
+		}
+		act, err := decodePayload(test.Version, payload)
+		if err != nil {
+			t.Errorf("v%d: %v", test.Version, err)
+			continue
+		}
+		if !reflect.DeepEqual(act, test.Messages) {
+			t.Errorf("v%d: expected messages %+v, got %+v", test.Version, test.Messages, act)
+		}
+	}
+
+	for _, payload := range []string{"5:42", "x:42", "2", ":"} {
+		if _, err := decodePayload(3, payload); err == nil {
+			t.Errorf("expected an error for payload %q", payload)
+		}
+	}
+}
+
+func TestDecodeBinaryPayload(t *testing.T) {
+	payload := []byte{0, 2, 255, '4', '2', 1, 3, 255, 4, 0, 1}
+	act, err := decodeBinaryPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []payloadMessage{{data: "42"}, {data: "\x04\x00\x01", binary: true}}
+	if !reflect.DeepEqual(act, expected) {
+		t.Errorf("expected messages %+v, got %+v", expected, act)
+	}
+
+	if _, err := decodeBinaryPayload([]byte{0, 5, 255, '4'}); err == nil {
+		t.Error("expected an error for truncated payload")
+	}
+}
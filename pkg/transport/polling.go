@@ -0,0 +1,586 @@
+package transport
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	PollingDefaultPingInterval   = 30 * time.Second
+	PollingDefaultPingTimeout    = 60 * time.Second
+	PollingDefaultReceiveTimeout = 60 * time.Second
+	PollingDefaultSendTimeout    = 60 * time.Second
+	PollingDefaultMaxPayload     = 1000000
+
+	transportPolling   = "polling"
+	transportWebsocket = "websocket"
+
+	closeMessage   = "1"
+	pingMessage    = "2"
+	pongMessage    = "3"
+	upgradeMessage = "5"
+	noopMessage    = "6"
+	probe          = "probe"
+)
+
+var (
+	ErrorSessionClosed  = errors.New("session closed")
+	ErrorReceiveTimeout = errors.New("receive timeout")
+)
+
+/**
+Engine.IO error codes, sent to clients along with a bad request status
+*/
+const (
+	errorCodeUnknownTransport = 0
+	errorCodeUnknownSid       = 1
+	errorCodeBadRequest       = 3
+)
+
+/**
+HTTP long-polling transport. Clients receive messages by polling with GET
+requests, which are answered once there are messages, and send messages with
+POST requests. Sessions are kept by the sid query parameter.
+
+Sessions are upgraded to websocket if the client asks for it, unless Websocket
+is nil. Websocket connections which don't upgrade a session are handled by
+Websocket as well, so this transport serves all clients.
+*/
+type PollingTransport struct {
+	PingInterval   time.Duration
+	PingTimeout    time.Duration
+	ReceiveTimeout time.Duration
+	SendTimeout    time.Duration
+
+	/**
+	Largest payload clients may send with one request
+	*/
+	MaxPayload int64
+
+	/**
+	Allow JSONP polling, which old browsers without CORS support use
+	*/
+	EnableJSONP bool
+
+	/**
+	Transport to upgrade sessions to, nil disables upgrades
+	*/
+	Websocket *WebsocketTransport
+
+	RequestHeader http.Header
+
+	sessions     map[string]*PollingConnection
+	sessionsLock sync.RWMutex
+}
+
+/**
+Server side of a polling session
+*/
+type PollingConnection struct {
+	transport *PollingTransport
+	sid       string
+	version   int
+
+	in        chan payloadMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	out      []payloadMessage
+	outReady chan struct{}
+	polling  bool
+	ws       *WebsocketConnection
+	lock     sync.Mutex
+
+	//keeps messages in order while the session is upgraded
+	writeLock sync.Mutex
+}
+
+func (plc *PollingConnection) GetMessage() (message string, binary bool, err error) {
+	return receive(plc.in, plc.closed, plc.transport.ReceiveTimeout)
+}
+
+func (plc *PollingConnection) WriteMessage(message string) error {
+	return plc.write(payloadMessage{data: message})
+}
+
+func (plc *PollingConnection) WriteBinary(message []byte) error {
+	return plc.write(payloadMessage{data: string(message), binary: true})
+}
+
+/**
+Queue message for the next poll, or send it through websocket once the session is upgraded
+*/
+func (plc *PollingConnection) write(msg payloadMessage) error {
+	plc.writeLock.Lock()
+	defer plc.writeLock.Unlock()
+
+	plc.lock.Lock()
+	ws := plc.ws
+	if ws == nil {
+		plc.out = append(plc.out, msg)
+		plc.notify()
+	}
+	plc.lock.Unlock()
+
+	select {
+	case <-plc.closed:
+		return ErrorSessionClosed
+	default:
+	}
+	if ws == nil {
+		return nil
+	}
+	if msg.binary {
+		return ws.WriteBinary([]byte(msg.data))
+	}
+	return ws.WriteMessage(msg.data)
+}
+
+/**
+Wake up the pending poll, lock must be held
+*/
+func (plc *PollingConnection) notify() {
+	select {
+	case plc.outReady <- struct{}{}:
+	default:
+	}
+}
+
+func (plc *PollingConnection) Close() {
+	plc.closeOnce.Do(func() {
+		close(plc.closed)
+
+		plc.lock.Lock()
+		if plc.ws != nil {
+			plc.ws.Close()
+		}
+		plc.lock.Unlock()
+
+		plc.transport.removeSession(plc.sid)
+	})
+}
+
+func (plc *PollingConnection) PingParams() (interval, timeout time.Duration) {
+	return plc.transport.PingInterval, plc.transport.PingTimeout
+}
+
+func (plc *PollingConnection) Sid() string {
+	return plc.sid
+}
+
+func (plc *PollingConnection) Upgrades() []string {
+	if plc.transport.Websocket == nil {
+		return []string{}
+	}
+	return []string{transportWebsocket}
+}
+
+/**
+Answer GET request with the queued messages, wait for some if there are none
+*/
+func (plc *PollingConnection) poll(w http.ResponseWriter, r *http.Request) {
+	plc.lock.Lock()
+	if plc.polling || plc.ws != nil {
+		plc.lock.Unlock()
+		writeError(w, errorCodeBadRequest, "Overlapping or upgraded poll")
+		return
+	}
+	plc.polling = true
+	plc.lock.Unlock()
+
+	var messages []payloadMessage
+	for messages == nil {
+		plc.lock.Lock()
+		if len(plc.out) > 0 {
+			messages, plc.out = plc.out, nil
+		}
+		plc.lock.Unlock()
+		if messages != nil {
+			break
+		}
+
+		select {
+		case <-plc.outReady:
+		case <-plc.closed:
+			messages = []payloadMessage{{data: closeMessage}}
+		case <-r.Context().Done():
+			messages = []payloadMessage{}
+		}
+	}
+
+	plc.lock.Lock()
+	plc.polling = false
+	plc.lock.Unlock()
+
+	plc.transport.writePayload(w, r, encodePayload(plc.version, messages))
+}
+
+/**
+Receive messages of POST request
+*/
+func (plc *PollingConnection) receive(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, plc.transport.MaxPayload))
+	if err != nil {
+		writeError(w, errorCodeBadRequest, err.Error())
+		return
+	}
+
+	var messages []payloadMessage
+	switch {
+	case r.URL.Query().Get("j") != "":
+		var payload string
+		payload, err = parseJSONPForm(body)
+		if err == nil {
+			messages, err = decodePayload(plc.version, payload)
+		}
+	case r.Header.Get("Content-Type") == "application/octet-stream":
+		messages, err = decodeBinaryPayload(body)
+	default:
+		messages, err = decodePayload(plc.version, string(body))
+	}
+	if err != nil {
+		writeError(w, errorCodeBadRequest, err.Error())
+		return
+	}
+
+	for _, msg := range messages {
+		if msg.data == closeMessage && !msg.binary {
+			plc.Close()
+			break
+		}
+		select {
+		case plc.in <- msg:
+		case <-plc.closed:
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Write([]byte("ok"))
+}
+
+/**
+Upgrade session to websocket. The client probes the websocket first, then
+the pending poll is answered with a noop and the client finishes the upgrade.
+*/
+func (plc *PollingConnection) upgrade(w http.ResponseWriter, r *http.Request) {
+	wst := plc.transport.Websocket
+	if wst == nil {
+		writeError(w, errorCodeUnknownTransport, "Transport unknown")
+		return
+	}
+
+	socket, err := websocket.Upgrade(w, r, nil, wst.BufferSize, wst.BufferSize)
+	if err != nil {
+		http.Error(w, upgradeFailed+err.Error(), 503)
+		return
+	}
+	ws := &WebsocketConnection{socket, wst}
+
+	go func() {
+		msg, _, err := ws.GetMessage()
+		if err != nil || msg != pingMessage+probe {
+			ws.Close()
+			return
+		}
+		if err := ws.WriteMessage(pongMessage + probe); err != nil {
+			ws.Close()
+			return
+		}
+		plc.WriteMessage(noopMessage)
+
+		msg, _, err = ws.GetMessage()
+		if err != nil || msg != upgradeMessage {
+			ws.Close()
+			return
+		}
+		if err := plc.switchTo(ws); err != nil {
+			plc.Close()
+			return
+		}
+
+		for {
+			data, binary, err := ws.GetMessage()
+			if err != nil {
+				plc.Close()
+				return
+			}
+			select {
+			case plc.in <- payloadMessage{data: data, binary: binary}:
+			case <-plc.closed:
+				return
+			}
+		}
+	}()
+}
+
+/**
+Send all further messages through websocket, including the ones nobody polled yet
+*/
+func (plc *PollingConnection) switchTo(ws *WebsocketConnection) error {
+	plc.writeLock.Lock()
+	defer plc.writeLock.Unlock()
+
+	plc.lock.Lock()
+	pending := plc.out
+	plc.out = nil
+	plc.ws = ws
+	plc.lock.Unlock()
+
+	for _, msg := range pending {
+		if msg.data == noopMessage && !msg.binary {
+			continue
+		}
+		var err error
+		if msg.binary {
+			err = ws.WriteBinary([]byte(msg.data))
+		} else {
+			err = ws.WriteMessage(msg.data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+Wait for incoming message, which fails if the connection was closed or
+nothing came in during timeout
+*/
+func receive(in chan payloadMessage, closed <-chan struct{}, timeout time.Duration) (string, bool, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case msg := <-in:
+		return msg.data, msg.binary, nil
+	case <-closed:
+		return "", false, ErrorSessionClosed
+	case <-timer.C:
+		return "", false, ErrorReceiveTimeout
+	}
+}
+
+/**
+New polling session for handshake request. Websocket connections without session
+are handled by the websocket transport.
+*/
+func (plt *PollingTransport) HandleConnection(
+	w http.ResponseWriter, r *http.Request) (conn Connection, err error) {
+
+	query := r.URL.Query()
+	if query.Get("sid") != "" {
+		//request of an existing session, see Serve
+		return nil, nil
+	}
+
+	switch query.Get("transport") {
+	case transportPolling:
+	case transportWebsocket:
+		if plt.Websocket != nil {
+			return plt.Websocket.HandleConnection(w, r)
+		}
+		fallthrough
+	default:
+		writeError(w, errorCodeUnknownTransport, "Transport unknown")
+		return nil, ErrorPacketWrong
+	}
+
+	if r.Method != "GET" {
+		writeError(w, errorCodeBadRequest, ErrorMethodNotAllowed.Error())
+		return nil, ErrorMethodNotAllowed
+	}
+	if err := plt.checkJSONP(query); err != nil {
+		writeError(w, errorCodeBadRequest, err.Error())
+		return nil, err
+	}
+
+	version := 3
+	if query.Get("EIO") == "4" {
+		version = 4
+	}
+	plc := &PollingConnection{
+		transport: plt,
+		sid:       generateSid(),
+		version:   version,
+		in:        make(chan payloadMessage, 100),
+		closed:    make(chan struct{}),
+		outReady:  make(chan struct{}, 1),
+	}
+	plt.addSession(plc)
+
+	//the handshake is answered like the first poll of the session
+	query.Set("sid", plc.sid)
+	r.URL.RawQuery = query.Encode()
+
+	return plc, nil
+}
+
+/**
+Serve polls and messages of sessions, and upgrades them to websocket
+*/
+func (plt *PollingTransport) Serve(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sid := query.Get("sid")
+	if sid == "" {
+		//websocket connection, nothing to do
+		return
+	}
+
+	plc, ok := plt.session(sid)
+	if !ok {
+		writeError(w, errorCodeUnknownSid, "Session ID unknown")
+		return
+	}
+
+	if err := plt.checkJSONP(query); err != nil {
+		writeError(w, errorCodeBadRequest, err.Error())
+		return
+	}
+
+	switch {
+	case query.Get("transport") == transportWebsocket:
+		plc.upgrade(w, r)
+	case r.Method == "GET":
+		plc.poll(w, r)
+	case r.Method == "POST":
+		plc.receive(w, r)
+	default:
+		writeError(w, errorCodeBadRequest, ErrorMethodNotAllowed.Error())
+	}
+}
+
+/**
+JSONP requests carry the index of the callback in the j parameter
+*/
+func (plt *PollingTransport) checkJSONP(query map[string][]string) error {
+	j, ok := query["j"]
+	if !ok {
+		return nil
+	}
+	if !plt.EnableJSONP {
+		return errors.New("JSONP disabled")
+	}
+	if _, err := strconv.Atoi(j[0]); err != nil {
+		return errors.New("invalid JSONP index")
+	}
+	return nil
+}
+
+func (plt *PollingTransport) writePayload(w http.ResponseWriter, r *http.Request, payload string) {
+	j := r.URL.Query().Get("j")
+	if j == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		w.Write([]byte(payload))
+		return
+	}
+
+	//json string is a valid and safe javascript string
+	jsonPayload, _ := json.Marshal(payload)
+	w.Header().Set("Content-Type", "text/javascript; charset=UTF-8")
+	w.Write([]byte("___eio[" + j + "](" + string(jsonPayload) + ");"))
+}
+
+/**
+JSONP clients post the payload as form field d, with escaped newlines
+*/
+func parseJSONPForm(body []byte) (string, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(values.Get("d"), "\\\\n", "\n"), nil
+}
+
+func (plt *PollingTransport) addSession(plc *PollingConnection) {
+	plt.sessionsLock.Lock()
+	defer plt.sessionsLock.Unlock()
+
+	if plt.sessions == nil {
+		plt.sessions = make(map[string]*PollingConnection)
+	}
+	plt.sessions[plc.sid] = plc
+}
+
+func (plt *PollingTransport) removeSession(sid string) {
+	plt.sessionsLock.Lock()
+	defer plt.sessionsLock.Unlock()
+
+	delete(plt.sessions, sid)
+}
+
+func (plt *PollingTransport) session(sid string) (*PollingConnection, bool) {
+	plt.sessionsLock.RLock()
+	defer plt.sessionsLock.RUnlock()
+
+	plc, ok := plt.sessions[sid]
+	return plc, ok
+}
+
+/**
+Write error in the format Engine.IO clients expect
+*/
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(&struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{code, message})
+}
+
+/**
+Generate random session id
+*/
+func generateSid() string {
+	buf := make([]byte, 15)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.URLEncoding.EncodeToString(buf)
+}
+
+/**
+Returns polling transport with default params, which upgrades to websocket
+*/
+func GetDefaultPollingTransport() *PollingTransport {
+	return &PollingTransport{
+		PingInterval:   PollingDefaultPingInterval,
+		PingTimeout:    PollingDefaultPingTimeout,
+		ReceiveTimeout: PollingDefaultReceiveTimeout,
+		SendTimeout:    PollingDefaultSendTimeout,
+		MaxPayload:     PollingDefaultMaxPayload,
+		Websocket:      GetDefaultWebsocketTransport(),
+	}
+}
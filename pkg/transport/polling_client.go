@@ -0,0 +1,218 @@
+package transport
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+Client side of a polling session
+*/
+type PollingClientConnection struct {
+	transport *PollingTransport
+	url       string
+	version   int
+
+	pollClient *http.Client
+	sendClient *http.Client
+
+	in        chan payloadMessage
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+func (plc *PollingClientConnection) GetMessage() (message string, binary bool, err error) {
+	return receive(plc.in, plc.ctx.Done(), plc.transport.ReceiveTimeout)
+}
+
+func (plc *PollingClientConnection) WriteMessage(message string) error {
+	return plc.post(payloadMessage{data: message})
+}
+
+func (plc *PollingClientConnection) WriteBinary(message []byte) error {
+	return plc.post(payloadMessage{data: string(message), binary: true})
+}
+
+func (plc *PollingClientConnection) Close() {
+	plc.closeOnce.Do(func() {
+		//tell the server, but don't wait for it
+		go plc.post(payloadMessage{data: closeMessage})
+		plc.cancel()
+	})
+}
+
+func (plc *PollingClientConnection) PingParams() (interval, timeout time.Duration) {
+	return plc.transport.PingInterval, plc.transport.PingTimeout
+}
+
+/**
+Poll messages until the session is closed
+*/
+func (plc *PollingClientConnection) pollLoop() {
+	for {
+		messages, err := plc.get()
+		if err != nil {
+			plc.Close()
+			return
+		}
+
+		for _, msg := range messages {
+			if msg.binary {
+				plc.push(msg)
+				continue
+			}
+			switch msg.data {
+			case noopMessage:
+			case closeMessage:
+				plc.Close()
+				return
+			default:
+				plc.push(msg)
+			}
+		}
+
+		if plc.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (plc *PollingClientConnection) push(msg payloadMessage) {
+	select {
+	case plc.in <- msg:
+	case <-plc.ctx.Done():
+	}
+}
+
+func (plc *PollingClientConnection) get() ([]payloadMessage, error) {
+	req, err := http.NewRequestWithContext(plc.ctx, "GET", plc.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := plc.do(plc.pollClient, req)
+	if err != nil {
+		return nil, err
+	}
+	return decodePayload(plc.version, body)
+}
+
+func (plc *PollingClientConnection) post(msg payloadMessage) error {
+	payload := encodePayload(plc.version, []payloadMessage{msg})
+	req, err := http.NewRequest("POST", plc.url, strings.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+
+	_, err = plc.do(plc.sendClient, req)
+	return err
+}
+
+func (plc *PollingClientConnection) do(client *http.Client, req *http.Request) (string, error) {
+	for key, values := range plc.transport.RequestHeader {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", ErrorBadBuffer
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("polling request failed: " + resp.Status)
+	}
+	return string(body), nil
+}
+
+/**
+Connect to server with polling, url may be a websocket one like those chat.GetUrl returns
+*/
+func (plt *PollingTransport) Connect(rawUrl string) (conn Connection, err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	query := u.Query()
+	query.Set("transport", transportPolling)
+	query.Del("sid")
+	u.RawQuery = query.Encode()
+
+	plc := &PollingClientConnection{
+		transport:  plt,
+		url:        u.String(),
+		version:    3,
+		pollClient: &http.Client{Timeout: plt.ReceiveTimeout},
+		sendClient: &http.Client{Timeout: plt.SendTimeout},
+		in:         make(chan payloadMessage, 100),
+	}
+	if query.Get("EIO") == "4" {
+		plc.version = 4
+	}
+	plc.ctx, plc.cancel = context.WithCancel(context.Background())
+
+	//the handshake response carries the open packet with the sid
+	messages, err := plc.get()
+	if err != nil {
+		plc.cancel()
+		return nil, err
+	}
+	var hdr struct {
+		Sid string `json:"sid"`
+	}
+	if len(messages) == 0 || !strings.HasPrefix(messages[0].data, "0") ||
+		json.Unmarshal([]byte(messages[0].data[1:]), &hdr) != nil || hdr.Sid == "" {
+		plc.cancel()
+		return nil, ErrorPacketWrong
+	}
+
+	query.Set("sid", hdr.Sid)
+	u.RawQuery = query.Encode()
+	plc.url = u.String()
+
+	for _, msg := range messages {
+		plc.push(msg)
+	}
+	go plc.pollLoop()
+
+	return plc, nil
+}
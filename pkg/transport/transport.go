@@ -30,15 +30,21 @@ End-point connection for given transport
 */
 type Connection interface {
 	/**
-	Receive one more message, block until received
+	Receive one more message, block until received. Binary messages carry
+	the attachments of binary packets.
 	*/
-	GetMessage() (message string, err error)
+	GetMessage() (message string, binary bool, err error)
 
 	/**
 	Send given message, block until sent
 	*/
 	WriteMessage(message string) error
 
+	/**
+	Send given binary message, block until sent
+	*/
+	WriteBinary(message []byte) error
+
 	/**
 	Close current connection
 	*/
@@ -50,6 +56,25 @@ type Connection interface {
 	PingParams() (interval, timeout time.Duration)
 }
 
+/**
+Server connection of a transport which keeps sessions across requests, like
+polling. The session id is the sid of the connection, and the transports it
+can be upgraded to are advertised in the handshake.
+*/
+type SessionConnection interface {
+	Connection
+
+	/**
+	Get id of the session
+	*/
+	Sid() string
+
+	/**
+	Get names of the transports the session can be upgraded to
+	*/
+	Upgrades() []string
+}
+
 /**
 Connection factory for given transport
 */
@@ -60,7 +85,8 @@ type Transport interface {
 	Connect(url string) (conn Connection, err error)
 
 	/**
-	Handle one server connection
+	Handle one server connection. Requests of an existing session don't make
+	a new connection, nil is returned and Serve handles them.
 	*/
 	HandleConnection(w http.ResponseWriter, r *http.Request) (conn Connection, err error)
 
@@ -40,7 +40,6 @@ const (
 )
 
 var (
-	ErrorBinaryMessage     = errors.New("binary messages are not supported")
 	ErrorBadBuffer         = errors.New("buffer error")
 	ErrorPacketWrong       = errors.New("wrong packet type error")
 	ErrorMethodNotAllowed  = errors.New("method not allowed")
@@ -52,40 +51,49 @@ type WebsocketConnection struct {
 	transport *WebsocketTransport
 }
 
-func (wsc *WebsocketConnection) GetMessage() (message string, err error) {
+func (wsc *WebsocketConnection) GetMessage() (message string, binary bool, err error) {
 	wsc.socket.SetReadDeadline(time.Now().Add(wsc.transport.ReceiveTimeout))
 	msgType, reader, err := wsc.socket.NextReader()
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
-	//support only text messages exchange
-	if msgType != websocket.TextMessage {
-		return "", ErrorBinaryMessage
+	//text messages are packets, binary ones their attachments
+	if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
+		return "", false, ErrorPacketWrong
 	}
+	binary = msgType == websocket.BinaryMessage
 
 	data, err := ioutil.ReadAll(reader)
 	if err != nil {
-		return "", ErrorBadBuffer
+		return "", false, ErrorBadBuffer
 	}
 	text := string(data)
 
-	//empty messages are not allowed
-	if len(text) == 0 {
-		return "", ErrorPacketWrong
+	//empty packets are not allowed, attachments may be empty
+	if len(text) == 0 && !binary {
+		return "", false, ErrorPacketWrong
 	}
 
-	return text, nil
+	return text, binary, nil
 }
 
 func (wsc *WebsocketConnection) WriteMessage(message string) error {
+	return wsc.write(websocket.TextMessage, []byte(message))
+}
+
+func (wsc *WebsocketConnection) WriteBinary(message []byte) error {
+	return wsc.write(websocket.BinaryMessage, message)
+}
+
+func (wsc *WebsocketConnection) write(msgType int, data []byte) error {
 	wsc.socket.SetWriteDeadline(time.Now().Add(wsc.transport.SendTimeout))
-	writer, err := wsc.socket.NextWriter(websocket.TextMessage)
+	writer, err := wsc.socket.NextWriter(msgType)
 	if err != nil {
 		return err
 	}
 
-	if _, err := writer.Write([]byte(message)); err != nil {
+	if _, err := writer.Write(data); err != nil {
 		return err
 	}
 	if err := writer.Close(); err != nil {
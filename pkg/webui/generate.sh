@@ -0,0 +1,43 @@
+#!/bin/sh
+# Fills dist with the built web UI and brotli and gzip compressed variants of its text assets.
+#
+# The UI sources are not part of this repository. Either NET_WEBUI_BUILD points to an already
+# built bundle, or NET_WEBUI_SRC points to a checkout of the UI sources, which is built with npm
+# into its build directory. The bundler is expected to put a content hash into the names of the
+# assets, e.g. main.3f2a1b9c.js, so that clients may cache them forever.
+# Without either variable dist keeps the placeholder page.
+set -eu
+
+build="${NET_WEBUI_BUILD:-}"
+if [ -z "$build" ] && [ -n "${NET_WEBUI_SRC:-}" ]; then
+    (cd "$NET_WEBUI_SRC" && npm ci && npm run build)
+    build="$NET_WEBUI_SRC/build"
+fi
+if [ -z "$build" ]; then
+    echo "neither NET_WEBUI_BUILD nor NET_WEBUI_SRC is set - keeping the placeholder UI" >&2
+    exit 0
+fi
+if [ ! -f "$build/index.html" ]; then
+    echo "$build does not contain a UI bundle" >&2
+    exit 1
+fi
+for tool in gzip brotli; do
+    if ! command -v $tool >/dev/null; then
+        echo "$tool is required to precompress the UI bundle" >&2
+        exit 1
+    fi
+done
+
+rm -rf dist
+cp -R "$build" dist
+# source maps would only bloat the binary
+find dist -type f -name '*.map' -delete
+
+find dist -type f \( -name '*.js' -o -name '*.css' \) | grep -Ev '\.[0-9a-f]{8,}\.[a-z]+$' | while read -r f; do
+    echo "warning: $f has no content hash in its name, clients revalidate it on every load" >&2
+done
+
+find dist -type f \( -name '*.html' -o -name '*.js' -o -name '*.css' -o -name '*.json' -o -name '*.svg' -o -name '*.txt' \) | while read -r f; do
+    gzip -9 -k -n -f "$f"
+    brotli -q 11 -k -f "$f"
+done
@@ -0,0 +1,169 @@
+package webui
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dist holds the built UI bundle
+//
+//go:embed dist
+var dist embed.FS
+
+// Assets returns the embedded UI bundle
+func Assets() fs.FS {
+	res, err := fs.Sub(dist, "dist")
+	if err != nil {
+		// cannot happen: dist is always embedded
+		panic(err)
+	}
+	return res
+}
+
+// hashedName matches file names that contain a content hash, e.g. main.3f2a1b9c.js
+var hashedName = regexp.MustCompile(`\.[0-9a-f]{8,}\.`)
+
+// encodings are the precompressed variants we look for, in order of preference
+var encodings = []struct {
+	Name string
+	Ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Handler serves a single page application from fsys.
+//
+// Paths that don't exist are client-side routes and are answered with index.html, unless they have a
+// file extension and the client does not ask for HTML. Engine names contain dots, after all.
+// Assets with a content hash in their name are cached forever, everything else must be revalidated.
+// If the client accepts it, a precompressed variant (.br or .gz) of a file is served.
+func Handler(fsys fs.FS) http.Handler {
+	return &handler{fs: fsys}
+}
+
+type handler struct {
+	fs    fs.FS
+	etags sync.Map
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || h.isDir(name) {
+		name = path.Join(name, "index.html")
+	}
+	if !h.isFile(name) {
+		if path.Ext(name) != "" && !strings.Contains(r.Header.Get("Accept"), "text/html") {
+			// a missing asset rather than a page
+			http.NotFound(w, r)
+			return
+		}
+		name = "index.html"
+	}
+
+	hdr := w.Header()
+	hdr.Add("Vary", "Accept-Encoding")
+	if hashedName.MatchString(path.Base(name)) {
+		hdr.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		hdr.Set("Cache-Control", "no-cache")
+	}
+
+	file, encoding := name, ""
+	accepted := r.Header.Get("Accept-Encoding")
+	for _, enc := range encodings {
+		if acceptsEncoding(accepted, enc.Name) && h.isFile(name+enc.Ext) {
+			file, encoding = name+enc.Ext, enc.Name
+			break
+		}
+	}
+
+	content, err := fs.ReadFile(h.fs, file)
+	if err != nil {
+		http.Error(w, "cannot read "+name, http.StatusInternalServerError)
+		return
+	}
+	if encoding != "" {
+		hdr.Set("Content-Encoding", encoding)
+	}
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		hdr.Set("Content-Type", ct)
+	}
+	hdr.Set("ETag", h.etag(file, content))
+
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// etag returns the entity tag of a file. The bundle never changes while we're running,
+// hence the tags are computed only once.
+func (h *handler) etag(name string, content []byte) string {
+	if tag, ok := h.etags.Load(name); ok {
+		return tag.(string)
+	}
+	sum := sha256.Sum256(content)
+	tag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	h.etags.Store(name, tag)
+	return tag
+}
+
+func (h *handler) isFile(name string) bool {
+	stat, err := fs.Stat(h.fs, name)
+	return err == nil && stat.Mode().IsRegular()
+}
+
+func (h *handler) isDir(name string) bool {
+	stat, err := fs.Stat(h.fs, name)
+	return err == nil && stat.IsDir()
+}
+
+// acceptsEncoding returns true if an Accept-Encoding header value allows the encoding
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params := strings.TrimSpace(part), ""
+		if i := strings.Index(name, ";"); i >= 0 {
+			name, params = name[:i], name[i+1:]
+		}
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
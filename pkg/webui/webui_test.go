@@ -0,0 +1,106 @@
+package webui
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHandler(t *testing.T) {
+	h := Handler(fstest.MapFS{
+		"index.html":                 {Data: []byte("<html>")},
+		"static/main.3f2a1b9c.js":    {Data: []byte("main()")},
+		"static/main.3f2a1b9c.js.gz": {Data: []byte("gzipped")},
+		"static/main.3f2a1b9c.js.br": {Data: []byte("brotli")},
+		"favicon.ico":                {Data: []byte("icon")},
+	})
+
+	tests := []struct {
+		Path           string
+		Accept         string
+		AcceptEncoding string
+		Status         int
+		Body           string
+		Encoding       string
+		CacheControl   string
+	}{
+		{Path: "/", Status: http.StatusOK, Body: "<html>", CacheControl: "no-cache"},
+		{Path: "/engines/build", Status: http.StatusOK, Body: "<html>", CacheControl: "no-cache"},
+		{Path: "/engines/net.1", Accept: "text/html,application/xhtml+xml", Status: http.StatusOK, Body: "<html>", CacheControl: "no-cache"},
+		{Path: "/favicon.ico", Status: http.StatusOK, Body: "icon", CacheControl: "no-cache"},
+		{Path: "/static/missing.js", Status: http.StatusNotFound},
+		{Path: "/static/main.3f2a1b9c.js", Status: http.StatusOK, Body: "main()", CacheControl: "public, max-age=31536000, immutable"},
+		{Path: "/static/main.3f2a1b9c.js", AcceptEncoding: "gzip, deflate", Status: http.StatusOK, Body: "gzipped", Encoding: "gzip"},
+		{Path: "/static/main.3f2a1b9c.js", AcceptEncoding: "gzip, br", Status: http.StatusOK, Body: "brotli", Encoding: "br"},
+		{Path: "/static/main.3f2a1b9c.js", AcceptEncoding: "gzip, br;q=0", Status: http.StatusOK, Body: "gzipped", Encoding: "gzip"},
+		{Path: "/../index.html", Status: http.StatusOK, Body: "<html>"},
+	}
+	for _, test := range tests {
+		t.Run(test.Path+" "+test.AcceptEncoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost"+test.Path, nil)
+			if test.Accept != "" {
+				req.Header.Set("Accept", test.Accept)
+			}
+			if test.AcceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", test.AcceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != test.Status {
+				t.Fatalf("expected status %d, got %d", test.Status, rec.Code)
+			}
+			if test.Status != http.StatusOK {
+				return
+			}
+			if act := rec.Body.String(); act != test.Body {
+				t.Errorf("expected body %q, got %q", test.Body, act)
+			}
+			if act := rec.Header().Get("Content-Encoding"); act != test.Encoding {
+				t.Errorf("expected content encoding %q, got %q", test.Encoding, act)
+			}
+			if act := rec.Header().Get("Cache-Control"); test.CacheControl != "" && act != test.CacheControl {
+				t.Errorf("expected cache control %q, got %q", test.CacheControl, act)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("expected revalidation to yield 304, got %d", rec.Code)
+	}
+}
+
+func TestAssets(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler(Assets()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("embedded bundle has no index.html: %d", rec.Code)
+	}
+}
@@ -26,7 +26,6 @@ package main
 import (
 	cmd "github.com/bhojpur/net/cmd/server"
 
-	_ "github.com/bhojpur/net/pkg/webui"
 	_ "github.com/lib/pq"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 )